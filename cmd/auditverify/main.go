@@ -0,0 +1,68 @@
+// Command auditverify walks the audit log hash chains and reports every break.
+// It exits with status 1 when a chain or checkpoint does not verify. Checkpoints are
+// checked against the public key alone, so the verifier never holds the signing key.
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	core "project/internal"
+	"project/internal/db/sqlc"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func main() {
+	companyID := flag.Int("company", 0, "verify only this company (default: all companies)")
+	publicKey := flag.String("public-key", os.Getenv("AUDIT_PUBLIC_KEY"),
+		"base64 Ed25519 public key of the checkpoints, as GET /v1/audit-events/checkpoints reports it (default: $AUDIT_PUBLIC_KEY)")
+	flag.Parse()
+
+	pub, err := base64.StdEncoding.DecodeString(*publicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		log.Fatal("-public-key or AUDIT_PUBLIC_KEY must be a base64 encoded 32 byte Ed25519 public key")
+	}
+	// LoadConfig is not used: outside dev it requires the signing key
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		log.Fatal("DATABASE_URL is required")
+	}
+	sqlDB, err := sql.Open("pgx", dsn)
+	if err != nil {
+		log.Fatalf("sql.Open: %v", err)
+	}
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	q := sqlc.New(sqlDB)
+
+	companies := []int32{int32(*companyID)}
+	if *companyID == 0 {
+		if companies, err = q.ListAuditCompanies(ctx); err != nil {
+			log.Fatalf("list companies: %v", err)
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	broken := false
+	for _, id := range companies {
+		report, err := core.VerifyAuditChain(ctx, q, id, ed25519.PublicKey(pub))
+		if err != nil {
+			log.Fatalf("verify company %d: %v", id, err)
+		}
+		if len(report.Breaks) > 0 {
+			broken = true
+		}
+		enc.Encode(report)
+	}
+	if broken {
+		os.Exit(1)
+	}
+}
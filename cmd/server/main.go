@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	core "project/internal"
 	"project/internal/api"
@@ -18,6 +20,8 @@ func main() {
 	defer sqlDB.Close()
 
 	app := core.NewApp(cfg, sqlDB)
+	go app.RunAuditCheckpoints(context.Background(), time.Hour)
+	go app.RunEmailOutbox(context.Background(), 5*time.Second)
 	r := api.Build(app)
 
 	port := "8080" // Hardcoded port
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/db/sqlc"
+)
+
+// Actor types recorded on audit events
+const (
+	auditActorUser   = "user"
+	auditActorSCIM   = "scim"
+	auditActorImport = "import"
+	auditActorSystem = "system"
+)
+
+// auditEntry describes one audit event. The actor, IP and user agent come from the request;
+// ActorID is only needed on routes where user_id is not yet in the context, such as login.
+type auditEntry struct {
+	CompanyID  int32
+	ActorID    int32
+	Action     string
+	TargetType string
+	TargetID   int32
+	Before     any
+	After      any
+}
+
+// AuditEventResponse represents an audit event in API responses
+type AuditEventResponse struct {
+	ID          int32           `json:"id"`
+	ActorType   string          `json:"actor_type"`
+	ActorUserID *int32          `json:"actor_user_id,omitempty"`
+	ActorEmail  string          `json:"actor_email,omitempty"`
+	Action      string          `json:"action"`
+	TargetType  string          `json:"target_type,omitempty"`
+	TargetID    *int32          `json:"target_id,omitempty"`
+	IP          string          `json:"ip,omitempty"`
+	UserAgent   string          `json:"user_agent,omitempty"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	Hash        string          `json:"hash,omitempty"`
+	CreatedAt   string          `json:"created_at"`
+}
+
+// AuditCheckpointResponse is a signed audit checkpoint as exported to auditors
+type AuditCheckpointResponse struct {
+	ID int32 `json:"id"`
+	core.AuditCheckpointPayload
+	Signature string `json:"signature"`
+}
+
+// AuditHandler serves the company audit log
+type AuditHandler struct {
+	App *core.App
+}
+
+// NewAuditHandler creates a new AuditHandler instance
+func NewAuditHandler(app *core.App) *AuditHandler {
+	return &AuditHandler{App: app}
+}
+
+// recordAudit appends an event to the company's audit log. A failed write is logged
+// rather than failing the request that triggered it.
+func recordAudit(c *gin.Context, app *core.App, e auditEntry) {
+	if e.CompanyID == 0 {
+		return
+	}
+	appendAudit(c, app, newAuditRecord(c, e))
+}
+
+// recordAccountAudit records a change to a user's account, which every company the user
+// belongs to shares, in the audit log of each of those companies
+func recordAccountAudit(c *gin.Context, app *core.App, userID int32, action string, before, after any) {
+	companies, err := app.Queries.GetUserCompanies(c, userID)
+	if err != nil {
+		log.Printf("Failed to record audit event %s for user %d: %v", action, userID, err)
+		return
+	}
+	for _, company := range companies {
+		recordAudit(c, app, auditEntry{
+			CompanyID:  company.CompanyID,
+			Action:     action,
+			TargetType: "user",
+			TargetID:   userID,
+			Before:     before,
+			After:      after,
+		})
+	}
+}
+
+// newAuditRecord builds the audit record of e, taking the actor, IP and user agent from
+// the request
+func newAuditRecord(c *gin.Context, e auditEntry) core.AuditRecord {
+	record := core.AuditRecord{
+		CompanyID:  e.CompanyID,
+		ActorType:  auditActorSystem,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IP:         c.ClientIP(),
+		UserAgent:  truncateRunes(c.Request.UserAgent(), 500),
+		Before:     auditState(e.Before),
+		After:      auditState(e.After),
+	}
+	if e.ActorID == 0 {
+		if v, ok := c.Get("user_id"); ok {
+			e.ActorID = v.(int32)
+		}
+	}
+	if e.ActorID != 0 {
+		record.ActorType = auditActorUser
+		record.ActorUserID = e.ActorID
+	} else if _, ok := c.Get("scim_token_id"); ok {
+		record.ActorType = auditActorSCIM
+	}
+	return record
+}
+
+// appendAudit writes record to the audit log, logging a failure
+func appendAudit(ctx context.Context, app *core.App, record core.AuditRecord) {
+	if err := app.Audit.Append(ctx, record); err != nil {
+		log.Printf("Failed to record audit event %s for company %d: %v", record.Action, record.CompanyID, err)
+	}
+}
+
+// auditState serializes a before/after snapshot, using an empty object when there is none
+func auditState(v any) json.RawMessage {
+	if v == nil {
+		return json.RawMessage("{}")
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage("{}")
+	}
+	return b
+}
+
+// truncateRunes shortens s to at most n runes
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// ListAuditEvents returns the company's audit events, newest first (admin only)
+func (h *AuditHandler) ListAuditEvents(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+
+	params, err := parseListAuditEventsParams(c, companyID.(int32))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+	limit := params.PageLimit
+	params.PageLimit = limit + 1 // fetch one extra row to know whether another page exists
+
+	events, err := h.App.Queries.ListAuditEvents(c, params)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "audit_events_fetch_failed")
+		return
+	}
+
+	var nextCursor *string
+	if int32(len(events)) > limit {
+		events = events[:limit]
+		cur := encodeCursor(pageCursor{Sort: "id:desc", ID: events[len(events)-1].ID})
+		nextCursor = &cur
+	}
+
+	response := make([]AuditEventResponse, len(events))
+	for i, e := range events {
+		response[i] = AuditEventResponse{
+			ID:         e.ID,
+			ActorType:  e.ActorType,
+			ActorEmail: e.ActorEmail.String,
+			Action:     e.Action,
+			TargetType: e.TargetType.String,
+			IP:         e.Ip.String,
+			UserAgent:  e.UserAgent.String,
+			Before:     e.Before,
+			After:      e.After,
+			Hash:       e.Hash.String,
+			CreatedAt:  e.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		}
+		if e.ActorUserID.Valid {
+			actorID := e.ActorUserID.Int32
+			response[i].ActorUserID = &actorID
+		}
+		if e.TargetID.Valid {
+			targetID := e.TargetID.Int32
+			response[i].TargetID = &targetID
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response, "next_cursor": nextCursor})
+}
+
+// ExportAuditCheckpoints returns the company's signed audit checkpoints with the public key
+// needed to verify them (admin only)
+func (h *AuditHandler) ExportAuditCheckpoints(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+
+	checkpoints, err := h.App.Queries.ListAuditCheckpoints(c, companyID.(int32))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "audit_checkpoints_fetch_failed")
+		return
+	}
+
+	response := make([]AuditCheckpointResponse, len(checkpoints))
+	for i, cp := range checkpoints {
+		response[i] = AuditCheckpointResponse{
+			ID:                     cp.ID,
+			AuditCheckpointPayload: core.NewAuditCheckpointPayload(cp),
+			Signature:              cp.Signature,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       response,
+		"algorithm":  "ed25519",
+		"public_key": base64.StdEncoding.EncodeToString(h.App.Cfg.AuditSigningKey().Public().(ed25519.PublicKey)),
+	})
+}
+
+// parseListAuditEventsParams validates the ListAuditEvents query parameters
+func parseListAuditEventsParams(c *gin.Context, companyID int32) (*sqlc.ListAuditEventsParams, error) {
+	params := &sqlc.ListAuditEventsParams{CompanyID: companyID}
+
+	limit, err := parseLimit(c.Query("limit"))
+	if err != nil {
+		return nil, err
+	}
+	params.PageLimit = limit
+
+	if v := c.Query("actor_user_id"); v != "" {
+		actorID, err := parseID(v)
+		if err != nil {
+			return nil, newAPIError("invalid_actor_filter")
+		}
+		params.ActorUserID = sql.NullInt32{Int32: actorID, Valid: true}
+	}
+	if v := c.Query("action"); v != "" {
+		params.Action = sql.NullString{String: v, Valid: true}
+	}
+	if v := c.Query("target_type"); v != "" {
+		params.TargetType = sql.NullString{String: v, Valid: true}
+	}
+	if v := c.Query("target_id"); v != "" {
+		targetID, err := parseID(v)
+		if err != nil {
+			return nil, newAPIError("invalid_target_filter")
+		}
+		params.TargetID = sql.NullInt32{Int32: targetID, Valid: true}
+	}
+	for name, dst := range map[string]*sql.NullTime{"since": &params.Since, "until": &params.Until} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, newAPIError("invalid_time_filter", name)
+			}
+			*dst = sql.NullTime{Time: t.UTC(), Valid: true}
+		}
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		cur, err := decodeCursor(v, "id:desc")
+		if err != nil {
+			return nil, err
+		}
+		params.CursorID = sql.NullInt32{Int32: cur.ID, Valid: true}
+	}
+
+	return params, nil
+}
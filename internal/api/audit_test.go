@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseListAuditEventsParams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{"defaults", "", ""},
+		{"all filters", "actor_user_id=3&action=user.deleted&target_type=user&target_id=9&since=2025-01-01T00:00:00Z&until=2025-02-01T00:00:00Z", ""},
+		{"invalid actor", "actor_user_id=abc", "actor_user_id must be a positive integer"},
+		{"invalid target", "target_id=0", "target_id must be a positive integer"},
+		{"invalid since", "since=yesterday", "since must be an RFC 3339 timestamp"},
+		{"invalid cursor", "cursor=not-a-cursor!", "invalid cursor"},
+		{"cursor from another list", "cursor=" + encodeCursor(pageCursor{Sort: "name:asc", ID: 4}), "cursor does not match sort order"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request, _ = http.NewRequest("GET", "/v1/audit-events?"+tt.query, nil)
+
+			params, err := parseListAuditEventsParams(c, 7)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if params.CompanyID != 7 || params.PageLimit != defaultPageLimit {
+				t.Errorf("Unexpected params %+v", params)
+			}
+		})
+	}
+}
+
+func TestParseListAuditEventsParamsCursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/v1/audit-events?cursor="+encodeCursor(pageCursor{Sort: "id:desc", ID: 42}), nil)
+
+	params, err := parseListAuditEventsParams(c, 7)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !params.CursorID.Valid || params.CursorID.Int32 != 42 {
+		t.Errorf("Expected cursor id 42, got %+v", params.CursorID)
+	}
+}
+
+func TestAuditState(t *testing.T) {
+	if got := string(auditState(nil)); got != "{}" {
+		t.Errorf("Expected empty object for nil state, got %s", got)
+	}
+	if got := string(auditState(gin.H{"name": "Jane"})); got != `{"name":"Jane"}` {
+		t.Errorf("Unexpected state %s", got)
+	}
+}
@@ -1,11 +1,18 @@
 package api
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
 	core "project/internal"
+	"project/internal/db/sqlc"
+	"project/internal/emails"
 	"strings"
 	"time"
 
@@ -15,15 +22,34 @@ import (
 
 // Error message constants
 const (
-	ErrInvalidBody           = "invalid body"
-	ErrFailedToLoadCompanies = "failed to load companies"
+	ErrCodeNoCompany = "no_company"
 )
 
+// Errors returned by resolveCompanyAccess
+var (
+	errLoadCompanies       = newAPIError("companies_load_failed")
+	errCompanyAccessDenied = newAPIError("company_access_denied")
+	errIPNotAllowed        = newAPIError("ip_not_allowed")
+	errLoadSettings        = newAPIError("settings_load_failed")
+)
+
+// companylessRoutes are the routes a token without company_id may call. Users who belong
+// to no company get such a token at login; everything else is tenant scoped and rejected.
+// Signup and invitation acceptance routes belong here once they exist.
+var companylessRoutes = map[string]bool{
+	"GET /v1/companies":            true,
+	"POST /v1/auth/switch-company": true,
+	"GET /v1/me":                   true,
+	"PATCH /v1/me":                 true,
+	"POST /v1/me/email":            true,
+	"POST /v1/me/email/confirm":    true,
+}
+
 func AuthRequired(jwtSecret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.GetHeader("Authorization")
 		if !strings.HasPrefix(auth, "Bearer ") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+			abortError(c, http.StatusUnauthorized, "missing_bearer_token")
 			return
 		}
 		tokenStr := strings.TrimPrefix(auth, "Bearer ")
@@ -33,19 +59,19 @@ func AuthRequired(jwtSecret string) gin.HandlerFunc {
 			return []byte(jwtSecret), nil
 		})
 		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			abortError(c, http.StatusUnauthorized, "invalid_token")
 			return
 		}
 		// Extract user_id
 		if v, ok := claims["sub"]; ok {
 			n, ok := v.(float64)
 			if !ok {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid sub in token"})
+				abortError(c, http.StatusUnauthorized, "invalid_token_sub")
 				return
 			}
 			c.Set("user_id", int32(n))
 		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing sub in token"})
+			abortError(c, http.StatusUnauthorized, "missing_token_sub")
 			return
 		}
 
@@ -53,12 +79,12 @@ func AuthRequired(jwtSecret string) gin.HandlerFunc {
 		if v, ok := claims["company_id"]; ok {
 			n, ok := v.(float64)
 			if !ok {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid company_id in token"})
+				abortError(c, http.StatusUnauthorized, "invalid_token_company")
 				return
 			}
 			c.Set("company_id", int32(n))
-		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing company_id in token"})
+		} else if !companylessRoutes[c.Request.Method+" "+c.FullPath()] {
+			abortError(c, http.StatusForbidden, ErrCodeNoCompany)
 			return
 		}
 
@@ -66,39 +92,125 @@ func AuthRequired(jwtSecret string) gin.HandlerFunc {
 		if v, ok := claims["is_admin"]; ok {
 			isAdmin, ok := v.(bool)
 			if !ok {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid is_admin in token"})
+				abortError(c, http.StatusUnauthorized, "invalid_token_admin")
 				return
 			}
 			c.Set("is_admin", isAdmin)
 		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing is_admin in token"})
+			abortError(c, http.StatusUnauthorized, "missing_token_admin")
+			return
+		}
+
+		// Keep issue time for session revocation checks
+		c.Set("token_iat", tokenIssuedAt(claims))
+		c.Set("auth_time", tokenAuthTime(claims))
+
+		c.Next()
+	}
+}
+
+// SessionNotRevoked middleware rejects tokens issued before the user's sessions were revoked.
+// It must run after AuthRequired so that user_id is present in the context.
+func SessionNotRevoked(app *core.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("user_id")
+		if !ok {
+			abortError(c, http.StatusUnauthorized, "unauthorized")
 			return
 		}
+		issuedAt, _ := c.Get("token_iat")
+		iat, _ := issuedAt.(time.Time)
 
+		revoked, err := sessionRevoked(c, app, userID.(int32), iat)
+		if err != nil {
+			abortError(c, http.StatusInternalServerError, "session_check_failed")
+			return
+		}
+		if revoked {
+			abortError(c, http.StatusUnauthorized, "session_revoked")
+			return
+		}
 		c.Next()
 	}
 }
 
+// sessionRevoked reports whether a token issued at iat was issued no later than the user's
+// session revocation. The revocation timestamp is cached per user to avoid a database hit on
+// every request.
+func sessionRevoked(c *gin.Context, app *core.App, userID int32, iat time.Time) (bool, error) {
+	cacheKey := fmt.Sprintf("sessions_revoked:%d", userID)
+	var revokedAt time.Time
+	if cached, exists := app.CacheGet(cacheKey); exists {
+		revokedAt, _ = cached.(time.Time)
+	} else {
+		ts, err := app.Queries.GetUserSessionsRevokedAt(c, userID)
+		if err != nil && err != sql.ErrNoRows {
+			return false, err
+		}
+		revokedAt = ts.Time
+		app.CacheSet(cacheKey, revokedAt, time.Minute)
+	}
+	if revokedAt.IsZero() {
+		return false, nil
+	}
+	return !iat.After(revokedAt), nil
+}
+
+// revokeSessions records that all tokens issued before now are no longer valid for the user
+func revokeSessions(app *core.App, userID int32, at time.Time) {
+	app.CacheSet(fmt.Sprintf("sessions_revoked:%d", userID), at, time.Minute)
+}
+
 type AuthHandler struct{ App *core.App }
 
-// generateOTP creates a 6-digit OTP
-func generateOTP() string {
-	b := make([]byte, 3)
+// generateOTP creates a numeric OTP with the given number of digits
+func generateOTP(length int) string {
+	b := make([]byte, (length+1)/2)
 	rand.Read(b)
 	otp := ""
 	for _, v := range b {
 		otp += fmt.Sprintf("%02d", int(v)%100)
 	}
-	return otp[:6]
+	return otp[:length]
 }
 
-// createJWTToken generates a JWT token for the user with company information
-func (h *AuthHandler) createJWTToken(userID, companyID int32, isAdmin bool, tokenType string) (string, error) {
+// maxOTPAttempts is how many wrong codes an OTP survives before it is discarded
+const maxOTPAttempts = 5
+
+// otpAttemptFailed counts a wrong code for the OTP cached under key and discards the OTP
+// once maxOTPAttempts codes were wrong, so it cannot be guessed within its lifetime. It
+// reports whether the OTP was discarded.
+func otpAttemptFailed(app *core.App, key string) bool {
+	attemptsKey := key + ":attempts"
+	// The count outlives any OTP lifetime and starts over when a new OTP is issued
+	app.Cache.Add(attemptsKey, 0, time.Hour)
+	if n, err := app.Cache.IncrementInt(attemptsKey, 1); err == nil && n < maxOTPAttempts {
+		return false
+	}
+	app.Cache.Delete(key)
+	app.Cache.Delete(attemptsKey)
+	return true
+}
+
+// resetOTPAttempts starts the count of wrong codes over for a newly issued OTP
+func resetOTPAttempts(app *core.App, key string) {
+	app.Cache.Delete(key + ":attempts")
+}
+
+// createJWTToken generates a JWT token for the user with company information.
+// A companyID of 0 issues a limited token without company_id for users with no company.
+// authTime is when the user last logged in with an OTP; refreshed tokens keep it.
+// Token lifetimes come from the company's settings.
+func (h *AuthHandler) createJWTToken(ctx context.Context, userID, companyID int32, isAdmin bool, authTime time.Time, tokenType string) (string, error) {
+	settings, err := loadCompanySettings(ctx, h.App, companyID)
+	if err != nil {
+		return "", err
+	}
 	var expiration time.Duration
 	if tokenType == "refresh" {
-		expiration = 7 * 24 * time.Hour // 7 days for refresh token
+		expiration = time.Duration(settings.Int("auth.refresh_token_days")) * 24 * time.Hour
 	} else {
-		expiration = 24 * time.Hour // 24 hours for access token
+		expiration = time.Duration(settings.Int("auth.access_token_hours")) * time.Hour
 	}
 
 	claims := jwt.MapClaims{
@@ -107,24 +219,68 @@ func (h *AuthHandler) createJWTToken(userID, companyID int32, isAdmin bool, toke
 		"is_admin":   isAdmin,
 		"type":       tokenType, // "access" or "refresh"
 		"exp":        time.Now().Add(expiration).Unix(),
-		"iat":        time.Now().Unix(),
+		"iat":        float64(time.Now().UnixMicro()) / 1e6,
+	}
+	if companyID == 0 {
+		delete(claims, "company_id")
+	}
+	if !authTime.IsZero() {
+		claims["auth_time"] = authTime.Unix()
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(h.App.Cfg.JWTSecret))
 }
 
+// tokenIssuedAt returns a token's iat claim. Tokens carry it with microseconds so one issued
+// in the same second as a session revocation can be told apart; whole-second values of older
+// tokens round down and count as issued before the revocation.
+func tokenIssuedAt(claims jwt.MapClaims) time.Time {
+	v, _ := claims["iat"].(float64)
+	return time.UnixMicro(int64(math.Round(v * 1e6)))
+}
+
+// tokenAuthTime returns the login time carried by a token's auth_time claim; zero for
+// tokens issued before the claim existed
+func tokenAuthTime(claims jwt.MapClaims) time.Time {
+	if v, ok := claims["auth_time"].(float64); ok {
+		return time.Unix(int64(v), 0)
+	}
+	return time.Time{}
+}
+
+// reauthWindow is how recently the user must have logged in with an OTP to change how they
+// log in, so a stolen token cannot add a phone number or move the account to another address
+const reauthWindow = 10 * time.Minute
+
+// requireRecentLogin writes the error response and reports false unless the request's token
+// comes from a login within reauthWindow
+func requireRecentLogin(c *gin.Context) bool {
+	authTime, _ := c.Get("auth_time")
+	if t, _ := authTime.(time.Time); time.Since(t) > reauthWindow {
+		respondError(c, http.StatusForbidden, "reauthentication_required")
+		return false
+	}
+	return true
+}
+
 func (h *AuthHandler) LoginRequest(c *gin.Context) {
 	var req struct {
-		Email string `json:"email" binding:"required,email"`
+		Email   string `json:"email" binding:"required,email"`
+		Channel string `json:"channel" binding:"omitempty,oneof=email sms whatsapp"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		respondError(c, http.StatusBadRequest, "invalid_body")
 		return
 	}
+	req.Email = core.NormalizeEmail(req.Email)
+	channel := req.Channel
+	if channel == "" {
+		channel = otpChannelEmail
+	}
 
 	// Prevent test@test.com from being used in production
 	if req.Email == "test@test.com" && h.App.Cfg.Environment != "dev" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "test account not allowed in production"})
+		respondError(c, http.StatusForbidden, "test_account_forbidden")
 		return
 	}
 
@@ -132,15 +288,59 @@ func (h *AuthHandler) LoginRequest(c *gin.Context) {
 	user, err := h.App.Queries.GetUserByEmail(c, req.Email)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			respondError(c, http.StatusNotFound, "user_not_found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		respondError(c, http.StatusInternalServerError, "database_error")
+		return
+	}
+
+	// OTP behaviour follows the settings of the user's default company
+	var companyID int32
+	if comp, err := h.defaultCompany(c, user.ID); err == nil {
+		companyID = comp.CompanyID
+	} else if err != sql.ErrNoRows {
+		respondError(c, http.StatusInternalServerError, "database_error")
 		return
 	}
+	settings, err := loadCompanySettings(c, h.App, companyID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "settings_load_failed")
+		return
+	}
+	if channel == otpChannelEmail {
+		if !settings.Allows("auth.login_methods", loginMethodEmailOTP) {
+			respondError(c, http.StatusForbidden, "otp_login_disabled")
+			return
+		}
+
+		// The code would never arrive at an address that bounced or complained
+		reason, err := core.EmailSuppression(c, h.App.Queries, user.Email)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "database_error")
+			return
+		}
+		if reason != "" {
+			body := errorBody(c, "email_suppressed")
+			body["reason"] = reason
+			c.JSON(http.StatusUnprocessableEntity, body)
+			return
+		}
+	} else {
+		if !settings.Allows("auth.login_methods", loginMethodSMSOTP) {
+			respondError(c, http.StatusForbidden, "sms_login_disabled")
+			return
+		}
+		// Phones are only stored once verified
+		if !user.Phone.Valid {
+			respondError(c, http.StatusUnprocessableEntity, "phone_not_verified")
+			return
+		}
+	}
 
-	// Create cache key for OTP
-	cacheKey := fmt.Sprintf("otp:%s", user.Email)
+	// Create cache key for OTP; accounts created before emails were normalized may still
+	// be stored in mixed case, and Login looks the code up by the normalized address
+	cacheKey := fmt.Sprintf("otp:%s", req.Email)
 
 	// Check if OTP already exists in cache
 	if cachedData, exists := h.App.CacheGet(cacheKey); exists {
@@ -148,49 +348,76 @@ func (h *AuthHandler) LoginRequest(c *gin.Context) {
 			if lastSent, ok := otpData["last_sent"].(time.Time); ok {
 				// If OTP was sent less than 1 minute ago, don't send again
 				if time.Since(lastSent) < time.Minute {
-					c.JSON(http.StatusTooManyRequests, gin.H{
-						"error":       "OTP already sent, please wait before requesting again",
-						"retry_after": int((time.Minute - time.Since(lastSent)).Seconds()),
-					})
+					body := errorBody(c, "otp_already_sent")
+					body["retry_after"] = int((time.Minute - time.Since(lastSent)).Seconds())
+					c.JSON(http.StatusTooManyRequests, body)
 					return
 				}
 			}
 		}
 	}
 
-	// Generate new OTP (mock in development for test@test.com)
-	var otp string
-	if h.App.Cfg.Environment == "dev" && user.Email == "test@test.com" {
-		otp = "123456" // Mock OTP for development
-		fmt.Printf("DEV MODE: Using mock OTP '123456' for test@test.com\n")
-	} else {
-		otp = generateOTP()
-	}
+	otp := generateOTP(settings.Int("auth.otp_length"))
 
-	// Store OTP in cache for 15 minutes
+	// Store OTP in cache for the configured lifetime
 	otpData := map[string]interface{}{
 		"otp":       otp,
-		"email":     user.Email,
+		"email":     req.Email,
 		"user_id":   user.ID,
+		"channel":   channel,
 		"last_sent": time.Now(),
 	}
-	h.App.CacheSet(cacheKey, otpData, 15*time.Minute)
+	h.App.CacheSet(cacheKey, otpData, time.Duration(settings.Int("auth.otp_ttl_minutes"))*time.Minute)
+	resetOTPAttempts(h.App, cacheKey)
 
-	// Send OTP via email using the email service (skip in dev for test@test.com)
-	if h.App.Cfg.Environment == "dev" && user.Email == "test@test.com" {
-		fmt.Printf("DEV MODE: Skipping email send for test@test.com, use OTP: %s\n", otp)
-	} else {
-		err = h.App.EmailService.SendEmail(user.Email, user.Name, "Your OTP Code", h.createOTPEmailHTML(otp, user.Name))
+	if channel != otpChannelEmail {
+		if smsBudgetSpent(h.App, user.ID, user.Phone.String) {
+			h.App.Cache.Delete(cacheKey)
+			respondError(c, http.StatusTooManyRequests, "sms_daily_limit")
+			return
+		}
+		err := h.App.SMS.Send(c, core.SMSMessage{
+			To:      user.Phone.String,
+			Channel: channel,
+			Body:    smsOTPText(resolveLocale(c, user.Locale.String, settings), otp, settings.Int("auth.otp_ttl_minutes")),
+		})
 		if err != nil {
-			// Log error but don't fail the request - OTP is still cached
-			fmt.Printf("Failed to send OTP email to %s: %v\n", user.Email, err)
-			// Also log the OTP for development purposes when email fails
-			fmt.Printf("OTP for %s: %s\n", user.Email, otp)
+			log.Printf("login: send %s OTP to user %d: %v", channel, user.ID, err)
+			// Drop the OTP so the resend guard does not block a retry
+			h.App.Cache.Delete(cacheKey)
+			respondError(c, http.StatusInternalServerError, "otp_send_failed")
+			return
 		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": localize(c, "otp_sent_phone"),
+			"phone":   maskPhone(user.Phone.String),
+		})
+		return
+	}
+
+	// Queue the OTP email for the outbox worker; in dev the mailbox or log transport shows it
+	locale := resolveLocale(c, user.Locale.String, settings)
+	msg, err := otpEmail(h.App.Cfg, user.Email, user.Name, locale, emails.OTPLogin, otp, settings)
+	if err == nil {
+		// Anyone can request a login OTP, so it spends only the recipient budget
+		_, err = h.App.EnqueueEmail(c, h.App.Queries, core.OutboxEmail{
+			CompanyID:           companyID,
+			RecipientBudgetOnly: true,
+			Message:             msg,
+		})
+	}
+	if err != nil {
+		// Drop the OTP so the resend guard does not block a retry
+		h.App.Cache.Delete(cacheKey)
+		if !respondEmailBudget(c, err) {
+			respondError(c, http.StatusInternalServerError, "otp_send_failed")
+		}
+		return
 	}
+	h.App.NotifyOutbox()
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "OTP sent to your email",
+		"message": localize(c, "otp_sent"),
 		"email":   user.Email,
 	})
 }
@@ -198,16 +425,17 @@ func (h *AuthHandler) LoginRequest(c *gin.Context) {
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req struct {
 		Email string `json:"email" binding:"required,email"`
-		OTP   string `json:"otp" binding:"required,len=6"`
+		OTP   string `json:"otp" binding:"required,min=4,max=10"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		respondError(c, http.StatusBadRequest, "invalid_body")
 		return
 	}
+	req.Email = core.NormalizeEmail(req.Email)
 
 	// Prevent test@test.com from being used in production
 	if req.Email == "test@test.com" && h.App.Cfg.Environment != "dev" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "test account not allowed in production"})
+		respondError(c, http.StatusForbidden, "test_account_forbidden")
 		return
 	}
 
@@ -215,13 +443,13 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	cacheKey := fmt.Sprintf("otp:%s", req.Email)
 	cachedData, exists := h.App.CacheGet(cacheKey)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "OTP expired or not found"})
+		respondError(c, http.StatusUnauthorized, "otp_not_found")
 		return
 	}
 
 	otpData, ok := cachedData.(map[string]interface{})
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid OTP data"})
+		respondError(c, http.StatusInternalServerError, "invalid_otp_data")
 		return
 	}
 
@@ -230,37 +458,94 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	storedEmail, emailOk := otpData["email"].(string)
 	userID, userOk := otpData["user_id"].(int32)
 
-	if !otpOk || !emailOk || !userOk || storedOTP != req.OTP || storedEmail != req.Email {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid OTP or email"})
+	if !otpOk || !emailOk || !userOk || subtle.ConstantTimeCompare([]byte(storedOTP), []byte(req.OTP)) != 1 || storedEmail != req.Email {
+		if otpAttemptFailed(h.App, cacheKey) {
+			respondError(c, http.StatusTooManyRequests, "otp_attempts_exceeded")
+			return
+		}
+		respondError(c, http.StatusUnauthorized, "invalid_otp")
 		return
 	}
 
-	defaultCompany, err := h.App.Queries.GetDefaultUserCompany(c, userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get default company"})
+	// Users without any company get a limited token for the companyless routes
+	defaultCompany, err := h.defaultCompany(c, userID)
+	noCompany := err == sql.ErrNoRows
+	if err != nil && !noCompany {
+		respondError(c, http.StatusInternalServerError, "default_company_failed")
 		return
 	}
 
+	if !noCompany {
+		allowed, err := clientIPAllowed(c, h.App, defaultCompany.CompanyID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "settings_load_failed")
+			return
+		}
+		if !allowed {
+			respondError(c, http.StatusForbidden, "ip_not_allowed")
+			return
+		}
+	}
+
 	// Create JWT tokens
-	accessToken, err := h.createJWTToken(userID, defaultCompany.CompanyID, defaultCompany.IsAdmin.Bool, "access")
+	authTime := time.Now()
+	accessToken, err := h.createJWTToken(c, userID, defaultCompany.CompanyID, defaultCompany.IsAdmin, authTime, "access")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access token"})
+		respondError(c, http.StatusInternalServerError, "access_token_failed")
 		return
 	}
 
-	refreshToken, err := h.createJWTToken(userID, defaultCompany.CompanyID, defaultCompany.IsAdmin.Bool, "refresh")
+	refreshToken, err := h.createJWTToken(c, userID, defaultCompany.CompanyID, defaultCompany.IsAdmin, authTime, "refresh")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create refresh token"})
+		respondError(c, http.StatusInternalServerError, "refresh_token_failed")
 		return
 	}
 
 	// Clear OTP from cache after successful login
 	h.App.Cache.Delete(cacheKey)
 
-	c.JSON(http.StatusOK, gin.H{
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  defaultCompany.CompanyID,
+		ActorID:    userID,
+		Action:     "auth.login",
+		TargetType: "user",
+		TargetID:   userID,
+	})
+
+	response := gin.H{
 		"access_token":  accessToken,
 		"refresh_token": refreshToken,
-	})
+	}
+	if noCompany {
+		response["code"] = ErrCodeNoCompany
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// defaultCompany picks the company a new session starts in: the user's saved default while
+// they can still access it, otherwise their oldest membership. Returns sql.ErrNoRows when
+// the user has no company at all.
+func (h *AuthHandler) defaultCompany(c *gin.Context, userID int32) (sqlc.GetUserCompaniesRow, error) {
+	companies, err := h.App.Queries.GetUserCompanies(c, userID)
+	if err != nil {
+		return sqlc.GetUserCompaniesRow{}, err
+	}
+	if len(companies) == 0 {
+		return sqlc.GetUserCompaniesRow{}, sql.ErrNoRows
+	}
+
+	preferred, err := h.App.Queries.GetUserDefaultCompanyID(c, userID)
+	if err != nil && err != sql.ErrNoRows {
+		return sqlc.GetUserCompaniesRow{}, err
+	}
+	if preferred.Valid {
+		for _, comp := range companies {
+			if comp.CompanyID == preferred.Int32 {
+				return comp, nil
+			}
+		}
+	}
+	return companies[0], nil
 }
 
 // parseAndValidateRefreshToken validates and parses a refresh token, extracts user ID
@@ -270,71 +555,91 @@ func (h *AuthHandler) parseAndValidateRefreshToken(refreshToken string) (jwt.Map
 		return []byte(h.App.Cfg.JWTSecret), nil
 	})
 	if err != nil || !token.Valid {
-		return nil, 0, fmt.Errorf("invalid refresh token")
+		return nil, 0, newAPIError("invalid_refresh_token")
 	}
 
 	// Verify token type
 	if tokenType, ok := claims["type"].(string); !ok || tokenType != "refresh" {
-		return nil, 0, fmt.Errorf("invalid token type")
+		return nil, 0, newAPIError("invalid_token_type")
 	}
 
 	// Extract user ID
 	v, ok := claims["sub"]
 	if !ok {
-		return nil, 0, fmt.Errorf("missing user ID in token")
+		return nil, 0, newAPIError("missing_token_sub")
 	}
 	n, ok := v.(float64)
 	if !ok {
-		return nil, 0, fmt.Errorf("invalid user ID in token")
+		return nil, 0, newAPIError("invalid_token_sub")
 	}
 
 	return claims, int32(n), nil
 }
 
-// resolveCompanyAccess determines company ID and admin status based on request and token
+// resolveCompanyAccess determines company ID and admin status based on request and token.
+// Tokens are only issued for a company from an address on its IP allowlist.
 func (h *AuthHandler) resolveCompanyAccess(c *gin.Context, requestedCompanyID *int32, claims jwt.MapClaims, userID int32) (int32, bool, error) {
+	companyID, isAdmin, err := h.resolveCompanyMembership(c, requestedCompanyID, claims, userID)
+	if err != nil || companyID == 0 {
+		return companyID, isAdmin, err
+	}
+	allowed, err := clientIPAllowed(c, h.App, companyID)
+	if err != nil {
+		return 0, false, errLoadSettings
+	}
+	if !allowed {
+		return 0, false, errIPNotAllowed
+	}
+	return companyID, isAdmin, nil
+}
+
+// resolveCompanyMembership picks the requested or token's company and checks the user
+// still belongs to it
+func (h *AuthHandler) resolveCompanyMembership(c *gin.Context, requestedCompanyID *int32, claims jwt.MapClaims, userID int32) (int32, bool, error) {
 	if requestedCompanyID != nil {
 		// Validate user has access to requested company
 		companies, err := h.App.Queries.GetUserCompanies(c, userID)
 		if err != nil {
-			return 0, false, fmt.Errorf(ErrFailedToLoadCompanies)
+			return 0, false, errLoadCompanies
 		}
 		for _, comp := range companies {
 			if comp.CompanyID == *requestedCompanyID {
-				return *requestedCompanyID, comp.IsAdmin.Bool, nil
+				return *requestedCompanyID, comp.IsAdmin, nil
 			}
 		}
-		return 0, false, fmt.Errorf("user not in specified company")
+		return 0, false, errCompanyAccessDenied
 	}
 
-	// Use company info from token
+	// Use company info from token; limited tokens pick up a company the user has joined since
 	v, ok := claims["company_id"]
 	if !ok {
-		return 0, false, fmt.Errorf("missing company ID in token")
+		comp, err := h.defaultCompany(c, userID)
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		if err != nil {
+			return 0, false, errLoadCompanies
+		}
+		return comp.CompanyID, comp.IsAdmin, nil
 	}
 	n, ok := v.(float64)
 	if !ok {
-		return 0, false, fmt.Errorf("invalid company ID in token")
+		return 0, false, newAPIError("invalid_token_company")
 	}
 	companyID := int32(n)
 
-	// Try to get admin status from token, fallback to database
-	if v, ok := claims["is_admin"].(bool); ok {
-		return companyID, v, nil
-	}
-
-	// Lookup admin status from database
+	// Memberships can be removed, deactivated or demoted after the token was issued, so
+	// access and admin status come from the database rather than the token
 	companies, err := h.App.Queries.GetUserCompanies(c, userID)
 	if err != nil {
-		return 0, false, fmt.Errorf(ErrFailedToLoadCompanies)
+		return 0, false, errLoadCompanies
 	}
 	for _, comp := range companies {
 		if comp.CompanyID == companyID {
-			return companyID, comp.IsAdmin.Bool, nil
+			return companyID, comp.IsAdmin, nil
 		}
 	}
-
-	return companyID, false, nil
+	return 0, false, errCompanyAccessDenied
 }
 
 // RefreshToken handles refresh token requests and generates new access tokens
@@ -344,172 +649,144 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		CompanyID    *int32 `json:"company_id"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidBody})
+		respondError(c, http.StatusBadRequest, "invalid_body")
 		return
 	}
 
 	// Parse, validate token and extract user ID
 	claims, userID, err := h.parseAndValidateRefreshToken(req.RefreshToken)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		respondErr(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	// Reject refresh tokens issued before the user's sessions were revoked
+	revoked, err := sessionRevoked(c, h.App, userID, tokenIssuedAt(claims))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "session_check_failed")
+		return
+	}
+	if revoked {
+		respondError(c, http.StatusUnauthorized, "session_revoked")
 		return
 	}
 
 	// Resolve company access and admin status
 	companyID, isAdmin, err := h.resolveCompanyAccess(c, req.CompanyID, claims, userID)
 	if err != nil {
-		errorMsg := err.Error()
 		switch {
-		case errorMsg == "user not in specified company":
-			c.JSON(http.StatusForbidden, gin.H{"error": errorMsg})
-		case errorMsg == ErrFailedToLoadCompanies:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": errorMsg})
+		case errors.Is(err, errCompanyAccessDenied), errors.Is(err, errIPNotAllowed):
+			respondErr(c, http.StatusForbidden, err)
+		case errors.Is(err, errLoadCompanies), errors.Is(err, errLoadSettings):
+			respondErr(c, http.StatusInternalServerError, err)
 		default:
-			c.JSON(http.StatusUnauthorized, gin.H{"error": errorMsg})
+			respondErr(c, http.StatusUnauthorized, err)
 		}
 		return
 	}
 
 	// Generate new tokens
-	newAccessToken, err := h.createJWTToken(userID, companyID, isAdmin, "access")
+	newAccessToken, err := h.createJWTToken(c, userID, companyID, isAdmin, tokenAuthTime(claims), "access")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access token"})
+		respondError(c, http.StatusInternalServerError, "access_token_failed")
 		return
 	}
 
-	newRefreshToken, err := h.createJWTToken(userID, companyID, isAdmin, "refresh")
+	newRefreshToken, err := h.createJWTToken(c, userID, companyID, isAdmin, tokenAuthTime(claims), "refresh")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create refresh token"})
+		respondError(c, http.StatusInternalServerError, "refresh_token_failed")
 		return
 	}
 
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  companyID,
+		ActorID:    userID,
+		Action:     "auth.refresh",
+		TargetType: "user",
+		TargetID:   userID,
+	})
+
 	c.JSON(http.StatusOK, gin.H{
 		"access_token":  newAccessToken,
 		"refresh_token": newRefreshToken,
 	})
 }
 
-// ListCompanies returns all companies for the authenticated user
-func (h *AuthHandler) ListCompanies(c *gin.Context) {
-	// CompanyResponse represents a clean company response structure
-	type CompanyResponse struct {
-		CompanyID   int32  `json:"CompanyID"`
-		CompanyName string `json:"CompanyName"`
-		IsAdmin     bool   `json:"IsAdmin"`
+// SwitchCompany issues a new token pair scoped to another company the user can access.
+// Authenticated with the current access token.
+func (h *AuthHandler) SwitchCompany(c *gin.Context) {
+	var req struct {
+		CompanyID int32 `json:"company_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_body")
+		return
+	}
+
+	uid, ok := c.Get("user_id")
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	userID := uid.(int32)
+
+	companyID, isAdmin, err := h.resolveCompanyAccess(c, &req.CompanyID, nil, userID)
+	if err != nil {
+		if errors.Is(err, errLoadCompanies) || errors.Is(err, errLoadSettings) {
+			respondErr(c, http.StatusInternalServerError, err)
+			return
+		}
+		respondErr(c, http.StatusForbidden, err)
+		return
+	}
+
+	v, _ := c.Get("auth_time")
+	authTime, _ := v.(time.Time)
+	accessToken, err := h.createJWTToken(c, userID, companyID, isAdmin, authTime, "access")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "access_token_failed")
+		return
 	}
 
+	refreshToken, err := h.createJWTToken(c, userID, companyID, isAdmin, authTime, "refresh")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "refresh_token_failed")
+		return
+	}
+
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  companyID,
+		Action:     "auth.switch_company",
+		TargetType: "user",
+		TargetID:   userID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+	})
+}
+
+// ListCompanies returns the companies the authenticated user can access as a tree.
+// Subsidiaries reached through a parent company are nested under it and marked Inherited.
+func (h *AuthHandler) ListCompanies(c *gin.Context) {
 	uid, ok := c.Get("user_id")
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		respondError(c, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 	var userID int32
 	if v, ok := uid.(int32); ok {
 		userID = v
 	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id type"})
+		respondError(c, http.StatusBadRequest, "invalid_user_id")
 		return
 	}
 	companies, err := h.App.Queries.GetUserCompanies(c, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load companies"})
+		respondError(c, http.StatusInternalServerError, "companies_load_failed")
 		return
 	}
 
-	// Transform the database result to the expected JSON format
-	responseCompanies := make([]CompanyResponse, len(companies))
-	for i, company := range companies {
-		responseCompanies[i] = CompanyResponse{
-			CompanyID:   company.CompanyID,
-			CompanyName: company.CompanyName,
-			IsAdmin:     company.IsAdmin.Bool, // Extract the boolean value from sql.NullBool
-		}
-	}
-
-	c.JSON(http.StatusOK, gin.H{"data": responseCompanies})
-}
-
-// createOTPEmailHTML creates the HTML content for OTP email
-func (h *AuthHandler) createOTPEmailHTML(otpCode, userName string) string {
-	name := userName
-	if name == "" {
-		name = "User"
-	}
-
-	return fmt.Sprintf(`
-<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Your OTP Code</title>
-    <style>
-        body {
-            font-family: Arial, sans-serif;
-            line-height: 1.6;
-            color: #333;
-            max-width: 600px;
-            margin: 0 auto;
-            padding: 20px;
-        }
-        .header {
-            text-align: center;
-            background-color: #f8f9fa;
-            padding: 20px;
-            border-radius: 8px;
-            margin-bottom: 20px;
-        }
-        .otp-code {
-            font-size: 32px;
-            font-weight: bold;
-            color: #007bff;
-            text-align: center;
-            padding: 20px;
-            background-color: #e9ecef;
-            border-radius: 8px;
-            letter-spacing: 4px;
-            margin: 20px 0;
-        }
-        .warning {
-            background-color: #fff3cd;
-            border: 1px solid #ffeaa7;
-            border-radius: 4px;
-            padding: 15px;
-            margin: 20px 0;
-        }
-        .footer {
-            text-align: center;
-            color: #6c757d;
-            font-size: 14px;
-            margin-top: 30px;
-        }
-    </style>
-</head>
-<body>
-    <div class="header">
-        <h1>OTP Verification</h1>
-    </div>
-    
-    <p>Hello %s,</p>
-    
-    <p>You have requested an OTP (One-Time Password) for verification. Please use the code below:</p>
-    
-    <div class="otp-code">%s</div>
-    
-    <div class="warning">
-        <strong>Important:</strong>
-        <ul>
-            <li>This code will expire in 15 minutes</li>
-            <li>Do not share this code with anyone</li>
-            <li>If you didn't request this code, please ignore this email</li>
-        </ul>
-    </div>
-    
-    <p>If you have any questions or need assistance, please contact our support team.</p>
-    
-    <div class="footer">
-        <p>This is an automated message, please do not reply to this email.</p>
-    </div>
-</body>
-</html>`, name, otpCode)
+	c.JSON(http.StatusOK, gin.H{"data": buildCompanyTree(companies)})
 }
@@ -5,9 +5,11 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 	"project/internal/testutil"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // Constants to eliminate duplicate literals
@@ -36,43 +38,43 @@ func TestAuthRequired(t *testing.T) {
 			name:           "missing authorization header",
 			authHeader:     "",
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   `{"error":"missing bearer token"}`,
+			expectedBody:   `{"code":"missing_bearer_token","error":"missing bearer token"}`,
 		},
 		{
 			name:           "invalid bearer format",
 			authHeader:     "Invalid token-format",
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   `{"error":"missing bearer token"}`,
+			expectedBody:   `{"code":"missing_bearer_token","error":"missing bearer token"}`,
 		},
 		{
 			name:           "bearer without token",
 			authHeader:     bearerPrefix,
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   `{"error":"invalid token"}`,
+			expectedBody:   `{"code":"invalid_token","error":"invalid token"}`,
 		},
 		{
 			name:           "invalid token format",
 			authHeader:     bearerPrefix + "invalid.token.format",
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   `{"error":"invalid token"}`,
+			expectedBody:   `{"code":"invalid_token","error":"invalid token"}`,
 		},
 		{
 			name:           "expired token",
 			authHeader:     "",
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   `{"error":"invalid token"}`,
+			expectedBody:   `{"code":"invalid_token","error":"invalid token"}`,
 		},
 		{
 			name:           "token with missing sub claim",
 			authHeader:     "",
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   `{"error":"missing sub in token"}`,
+			expectedBody:   `{"code":"missing_token_sub","error":"missing sub in token"}`,
 		},
 		{
 			name:           "token with invalid sub claim type",
 			authHeader:     "",
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   `{"error":"invalid sub in token"}`,
+			expectedBody:   `{"code":"invalid_token_sub","error":"invalid sub in token"}`,
 		},
 	}
 
@@ -256,3 +258,144 @@ func createTestRouter(secret string) *gin.Engine {
 func contains(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
+
+func TestSessionNotRevoked(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	app := testutil.CreateTestApp()
+	router := gin.New()
+	router.Use(AuthRequired(app.Cfg.JWTSecret), SessionNotRevoked(app))
+	router.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+
+	token, err := testutil.CreateValidJWTToken(app.Cfg.JWTSecret, 123, 456, false, "access")
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		revokedAt      time.Time
+		expectedStatus int
+	}{
+		{"never revoked", time.Time{}, http.StatusOK},
+		{"revoked before token was issued", time.Now().Add(-time.Hour), http.StatusOK},
+		{"revoked after token was issued", time.Now().Add(time.Hour), http.StatusUnauthorized},
+		// The token's whole-second iat must not let it survive a revocation later in that second
+		{"revoked within the second the token was issued", time.Now().Truncate(time.Second).Add(500 * time.Millisecond), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.CacheSet("sessions_revoked:123", tt.revokedAt, time.Minute)
+
+			req, _ := http.NewRequest("GET", "/test", nil)
+			req.Header.Set("Authorization", bearerPrefix+token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.expectedStatus {
+				t.Errorf(statusErrMsg, tt.expectedStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestTokenIssuedAtKeepsMicroseconds(t *testing.T) {
+	revokedAt := time.Date(2025, 3, 1, 12, 0, 0, 250000000, time.UTC)
+	before := jwt.MapClaims{"iat": float64(revokedAt.Add(-time.Millisecond).UnixMicro()) / 1e6}
+	after := jwt.MapClaims{"iat": float64(revokedAt.Add(time.Millisecond).UnixMicro()) / 1e6}
+
+	if got := tokenIssuedAt(before); !got.Before(revokedAt) {
+		t.Errorf("Expected %v before %v", got, revokedAt)
+	}
+	if got := tokenIssuedAt(after); !got.After(revokedAt) {
+		t.Errorf("Expected %v after %v", got, revokedAt)
+	}
+	if got := tokenIssuedAt(jwt.MapClaims{"iat": float64(revokedAt.Unix())}); got.After(revokedAt) {
+		t.Errorf("Expected whole-second iat %v to count as issued before %v", got, revokedAt)
+	}
+}
+
+func TestSwitchCompany(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	app := testutil.CreateTestApp()
+	router := Build(app)
+
+	token, err := testutil.CreateValidJWTToken(app.Cfg.JWTSecret, 123, 456, false, "access")
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	// Sessions were never revoked; avoids a database lookup
+	app.CacheSet("sessions_revoked:123", time.Time{}, time.Minute)
+	app.CacheSet("company_settings:456", companySettings{}, time.Minute)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"missing company", `{}`, http.StatusBadRequest},
+		{"membership lookup fails without database", `{"company_id": 789}`, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/v1/auth/switch-company", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", bearerPrefix+token)
+			req.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.expectedStatus {
+				t.Errorf(statusErrMsg, tt.expectedStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestAuthRequiredWithoutCompany(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := "test-secret"
+
+	token, err := testutil.CreateValidJWTToken(secret, 123, 0, false, "access")
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(AuthRequired(secret))
+	handler := func(c *gin.Context) {
+		_, hasCompany := c.Get("company_id")
+		c.JSON(http.StatusOK, gin.H{"has_company": hasCompany})
+	}
+	router.GET("/v1/companies", handler)
+	router.GET("/v1/users", handler)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"whitelisted route", "/v1/companies", http.StatusOK, `{"has_company":false}`},
+		{"tenant route", "/v1/users", http.StatusForbidden, `{"code":"no_company","error":"this action requires a company membership"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Authorization", bearerPrefix+token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			if recorder.Code != tt.expectedStatus {
+				t.Errorf(statusErrMsg, tt.expectedStatus, recorder.Code)
+			}
+			if recorder.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,507 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/db/sqlc"
+)
+
+// maxCompanyDepth bounds the company hierarchy; the recursive queries stop at the same depth
+const maxCompanyDepth = 10
+
+// CompanyTreeNode is a company the user can access, with the accessible subsidiaries below it
+type CompanyTreeNode struct {
+	CompanyID   int32             `json:"CompanyID"`
+	CompanyName string            `json:"CompanyName"`
+	IsAdmin     bool              `json:"IsAdmin"`
+	ParentID    *int32            `json:"ParentID,omitempty"`
+	Inherited   bool              `json:"Inherited,omitempty"`
+	Children    []CompanyTreeNode `json:"Children,omitempty"`
+}
+
+// SubsidiaryResponse represents a subsidiary company in API responses
+type SubsidiaryResponse struct {
+	ID                 int32  `json:"id"`
+	Name               string `json:"name"`
+	Address            string `json:"address,omitempty"`
+	Phone              string `json:"phone,omitempty"`
+	Email              string `json:"email,omitempty"`
+	TaxID              string `json:"tax_id,omitempty"`
+	ParentID           int32  `json:"parent_id,omitempty"`
+	InheritMemberships bool   `json:"inherit_memberships"`
+	Depth              int32  `json:"depth,omitempty"`
+	CreatedAt          string `json:"created_at"`
+}
+
+// CreateSubsidiaryRequest represents the request body for creating a subsidiary
+type CreateSubsidiaryRequest struct {
+	Name               string `json:"name" binding:"required"`
+	Address            string `json:"address"`
+	Phone              string `json:"phone"`
+	Email              string `json:"email"`
+	TaxID              string `json:"tax_id"`
+	InheritMemberships bool   `json:"inherit_memberships"`
+}
+
+// UpdateSubsidiaryRequest represents a partial update of a subsidiary; omitted fields are left unchanged
+type UpdateSubsidiaryRequest struct {
+	Name               *string `json:"name"`
+	Address            *string `json:"address"`
+	Phone              *string `json:"phone"`
+	Email              *string `json:"email"`
+	TaxID              *string `json:"tax_id"`
+	InheritMemberships *bool   `json:"inherit_memberships"`
+}
+
+// CompanyHandler manages the subsidiaries of the current company
+type CompanyHandler struct {
+	App *core.App
+}
+
+// NewCompanyHandler creates a new CompanyHandler instance
+func NewCompanyHandler(app *core.App) *CompanyHandler {
+	return &CompanyHandler{App: app}
+}
+
+// buildCompanyTree nests accessible companies under their parents. Companies whose parent
+// is not accessible become roots, so the tree never reveals companies outside the list.
+func buildCompanyTree(rows []sqlc.GetUserCompaniesRow) []CompanyTreeNode {
+	accessible := make(map[int32]bool, len(rows))
+	for _, r := range rows {
+		accessible[r.CompanyID] = true
+	}
+
+	children := map[int32][]sqlc.GetUserCompaniesRow{}
+	var roots []sqlc.GetUserCompaniesRow
+	for _, r := range rows {
+		if r.ParentID.Valid && accessible[r.ParentID.Int32] {
+			children[r.ParentID.Int32] = append(children[r.ParentID.Int32], r)
+		} else {
+			roots = append(roots, r)
+		}
+	}
+
+	var build func(r sqlc.GetUserCompaniesRow, depth int) CompanyTreeNode
+	build = func(r sqlc.GetUserCompaniesRow, depth int) CompanyTreeNode {
+		node := CompanyTreeNode{
+			CompanyID:   r.CompanyID,
+			CompanyName: r.CompanyName,
+			IsAdmin:     r.IsAdmin,
+			Inherited:   r.Inherited,
+		}
+		if r.ParentID.Valid {
+			parentID := r.ParentID.Int32
+			node.ParentID = &parentID
+		}
+		if depth < maxCompanyDepth {
+			for _, child := range children[r.CompanyID] {
+				node.Children = append(node.Children, build(child, depth+1))
+			}
+		}
+		return node
+	}
+
+	tree := make([]CompanyTreeNode, len(roots))
+	for i, r := range roots {
+		tree[i] = build(r, 1)
+	}
+	return tree
+}
+
+// ListSubsidiaries returns every subsidiary below the current company (admin only)
+func (h *CompanyHandler) ListSubsidiaries(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+
+	rows, err := h.App.Queries.ListSubsidiaries(c, sql.NullInt32{Int32: companyID.(int32), Valid: true})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "subsidiaries_fetch_failed")
+		return
+	}
+
+	response := make([]SubsidiaryResponse, len(rows))
+	for i, r := range rows {
+		response[i] = newSubsidiaryResponse(sqlc.CreateSubsidiaryRow{
+			ID: r.ID, Name: r.Name, Address: r.Address, Phone: r.Phone, Email: r.Email, TaxID: r.TaxID,
+			ParentID: r.ParentID, InheritMemberships: r.InheritMemberships, CreatedAt: r.CreatedAt,
+		})
+		response[i].Depth = r.Depth
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// CreateSubsidiary creates a company directly below the current company (admin only)
+func (h *CompanyHandler) CreateSubsidiary(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+
+	var req CreateSubsidiaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "company_name_required")
+		return
+	}
+	if err := validateCompanyFields(&req.Name, &req.Address, &req.Phone, &req.Email, &req.TaxID); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	depth, err := h.App.Queries.GetCompanyDepth(c, companyID.(int32))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "company_hierarchy_load_failed")
+		return
+	}
+	if depth+1 >= maxCompanyDepth {
+		respondError(c, http.StatusBadRequest, "company_hierarchy_too_deep")
+		return
+	}
+
+	created, err := h.App.Queries.CreateSubsidiary(c, &sqlc.CreateSubsidiaryParams{
+		Name:               strings.TrimSpace(req.Name),
+		Address:            optionalString(req.Address),
+		Phone:              optionalString(req.Phone),
+		Email:              optionalString(req.Email),
+		TaxID:              optionalString(req.TaxID),
+		ParentID:           sql.NullInt32{Int32: companyID.(int32), Valid: true},
+		InheritMemberships: req.InheritMemberships,
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "subsidiary_create_failed")
+		return
+	}
+	response := newSubsidiaryResponse(created)
+	recordSubsidiaryAudit(c, h.App, companyID.(int32), created.ID, "company.subsidiary_created", nil, response)
+
+	c.JSON(http.StatusCreated, gin.H{"data": response})
+}
+
+// UpdateSubsidiary updates the details of a subsidiary of the current company (admin only)
+func (h *CompanyHandler) UpdateSubsidiary(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	subsidiaryID, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_company_id")
+		return
+	}
+
+	var req UpdateSubsidiaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	if err := validateCompanyFields(req.Name, req.Address, req.Phone, req.Email, req.TaxID); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.requireSubsidiary(c, companyID.(int32), subsidiaryID) {
+		return
+	}
+
+	params := &sqlc.UpdateCompanyParams{ID: subsidiaryID}
+	if req.Name != nil {
+		params.Name = sql.NullString{String: strings.TrimSpace(*req.Name), Valid: true}
+	}
+	if req.Address != nil {
+		params.Address = sql.NullString{String: strings.TrimSpace(*req.Address), Valid: true}
+	}
+	if req.Phone != nil {
+		params.Phone = sql.NullString{String: strings.TrimSpace(*req.Phone), Valid: true}
+	}
+	if req.Email != nil {
+		params.Email = sql.NullString{String: strings.TrimSpace(*req.Email), Valid: true}
+	}
+	if req.TaxID != nil {
+		params.TaxID = sql.NullString{String: strings.TrimSpace(*req.TaxID), Valid: true}
+	}
+	if req.InheritMemberships != nil {
+		params.InheritMemberships = sql.NullBool{Bool: *req.InheritMemberships, Valid: true}
+	}
+
+	updated, err := h.App.Queries.UpdateCompany(c, params)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "subsidiary_update_failed")
+		return
+	}
+	response := newSubsidiaryResponse(sqlc.CreateSubsidiaryRow(updated))
+	recordSubsidiaryAudit(c, h.App, companyID.(int32), subsidiaryID, "company.subsidiary_updated", req, response)
+
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// Errors returned inside the subsidiary transactions
+var (
+	errLoadHierarchy         = newAPIError("company_hierarchy_load_failed")
+	errHierarchyTooDeep      = newAPIError("company_hierarchy_too_deep")
+	errSubsidiaryCycle       = newAPIError("subsidiary_cycle")
+	errAttachSubsidiary      = newAPIError("subsidiary_attach_failed")
+	errCheckSubsidiaryAdmins = newAPIError("subsidiary_admins_check_failed")
+	errSubsidiaryNoAdmin     = newAPIError("subsidiary_no_admin")
+	errDetachSubsidiary      = newAPIError("subsidiary_detach_failed")
+)
+
+// AttachSubsidiary moves an existing company directly below the current company.
+// The caller must be an admin of both companies, and of the subsidiary through their own
+// membership: admin rights inherited from its current parent do not allow moving it.
+func (h *CompanyHandler) AttachSubsidiary(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	userID, ok := c.Get("user_id")
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	subsidiaryID, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_company_id")
+		return
+	}
+	if subsidiaryID == companyID.(int32) {
+		respondError(c, http.StatusBadRequest, "subsidiary_self")
+		return
+	}
+
+	isAdmin, err := h.App.Queries.IsDirectCompanyAdmin(c, &sqlc.IsDirectCompanyAdminParams{
+		UserID:    userID.(int32),
+		CompanyID: subsidiaryID,
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "companies_load_failed")
+		return
+	}
+	if !isAdmin {
+		respondError(c, http.StatusForbidden, "subsidiary_admin_required")
+		return
+	}
+
+	// The checks and the move happen in one transaction, with the subsidiary locked first so
+	// concurrent moves of it wait for each other
+	var previous sql.NullInt32
+	err = h.App.WithTx(c, func(tx *core.Tx) error {
+		var err error
+		if previous, err = tx.GetCompanyParent(c, subsidiaryID); err != nil {
+			return withCause(errLoadHierarchy, err)
+		}
+
+		// Reject cycles: the current company must not already sit below the new subsidiary
+		cycle, err := tx.IsCompanyDescendant(c, &sqlc.IsCompanyDescendantParams{
+			CompanyID:  companyID.(int32),
+			AncestorID: subsidiaryID,
+		})
+		if err != nil {
+			return withCause(errLoadHierarchy, err)
+		}
+		if cycle {
+			return errSubsidiaryCycle
+		}
+
+		depth, err := tx.GetCompanyDepth(c, companyID.(int32))
+		if err != nil {
+			return withCause(errLoadHierarchy, err)
+		}
+		below, err := tx.ListSubsidiaries(c, sql.NullInt32{Int32: subsidiaryID, Valid: true})
+		if err != nil {
+			return withCause(errLoadHierarchy, err)
+		}
+		var height int32
+		for _, r := range below {
+			if r.Depth > height {
+				height = r.Depth
+			}
+		}
+		if depth+1+height >= maxCompanyDepth {
+			return errHierarchyTooDeep
+		}
+
+		err = tx.SetCompanyParent(c, &sqlc.SetCompanyParentParams{
+			ID:       subsidiaryID,
+			ParentID: sql.NullInt32{Int32: companyID.(int32), Valid: true},
+		})
+		if err != nil {
+			return withCause(errAttachSubsidiary, err)
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errSubsidiaryCycle):
+			respondErr(c, http.StatusConflict, err)
+		case errors.Is(err, errHierarchyTooDeep):
+			respondErr(c, http.StatusBadRequest, err)
+		case errors.Is(err, errLoadHierarchy):
+			respondErr(c, http.StatusInternalServerError, errLoadHierarchy)
+		default:
+			respondErr(c, http.StatusInternalServerError, errAttachSubsidiary)
+		}
+		return
+	}
+	recordSubsidiaryAudit(c, h.App, companyID.(int32), subsidiaryID, "company.subsidiary_attached",
+		gin.H{"parent_id": auditParentID(previous)}, gin.H{"parent_id": companyID})
+
+	c.JSON(http.StatusOK, gin.H{"message": localize(c, "subsidiary_attached")})
+}
+
+// DetachSubsidiary makes a subsidiary of the current company a standalone company.
+// Refused while the subsidiary has no admin of its own, as nobody could manage it afterwards.
+func (h *CompanyHandler) DetachSubsidiary(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	subsidiaryID, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_company_id")
+		return
+	}
+
+	if !h.requireSubsidiary(c, companyID.(int32), subsidiaryID) {
+		return
+	}
+
+	var previous sql.NullInt32
+	err = h.App.WithTx(c, func(tx *core.Tx) error {
+		var err error
+		if previous, err = tx.GetCompanyParent(c, subsidiaryID); err != nil {
+			return withCause(errLoadHierarchy, err)
+		}
+		admins, err := tx.CountCompanyAdmins(c, subsidiaryID)
+		if err != nil {
+			return withCause(errCheckSubsidiaryAdmins, err)
+		}
+		if admins == 0 {
+			return errSubsidiaryNoAdmin
+		}
+		if err := tx.SetCompanyParent(c, &sqlc.SetCompanyParentParams{ID: subsidiaryID}); err != nil {
+			return withCause(errDetachSubsidiary, err)
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errSubsidiaryNoAdmin):
+			respondErr(c, http.StatusConflict, err)
+		case errors.Is(err, errLoadHierarchy):
+			respondErr(c, http.StatusInternalServerError, errLoadHierarchy)
+		case errors.Is(err, errCheckSubsidiaryAdmins):
+			respondErr(c, http.StatusInternalServerError, errCheckSubsidiaryAdmins)
+		default:
+			respondErr(c, http.StatusInternalServerError, errDetachSubsidiary)
+		}
+		return
+	}
+	recordSubsidiaryAudit(c, h.App, companyID.(int32), subsidiaryID, "company.subsidiary_detached",
+		gin.H{"parent_id": auditParentID(previous)}, gin.H{"parent_id": nil})
+
+	c.JSON(http.StatusOK, gin.H{"message": localize(c, "subsidiary_detached")})
+}
+
+// recordSubsidiaryAudit records a hierarchy change in the audit logs of both the current
+// company and the subsidiary, whose admins each need to see who changed it
+func recordSubsidiaryAudit(c *gin.Context, app *core.App, companyID, subsidiaryID int32, action string, before, after any) {
+	for _, id := range []int32{companyID, subsidiaryID} {
+		recordAudit(c, app, auditEntry{
+			CompanyID:  id,
+			Action:     action,
+			TargetType: "company",
+			TargetID:   subsidiaryID,
+			Before:     before,
+			After:      after,
+		})
+	}
+}
+
+// auditParentID is a parent company ID as recorded in the audit log, null for none
+func auditParentID(id sql.NullInt32) any {
+	if !id.Valid {
+		return nil
+	}
+	return id.Int32
+}
+
+// requireSubsidiary checks that subsidiaryID sits below companyID, writing the error response if not
+func (h *CompanyHandler) requireSubsidiary(c *gin.Context, companyID, subsidiaryID int32) bool {
+	below, err := h.App.Queries.IsCompanyDescendant(c, &sqlc.IsCompanyDescendantParams{
+		CompanyID:  subsidiaryID,
+		AncestorID: companyID,
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "company_hierarchy_load_failed")
+		return false
+	}
+	if !below {
+		respondError(c, http.StatusNotFound, "subsidiary_not_found")
+		return false
+	}
+	return true
+}
+
+// validateCompanyFields checks the provided company fields and returns an error if invalid
+func validateCompanyFields(name, address, phone, email, taxID *string) error {
+	if name != nil {
+		if err := validateName(*name); err != nil {
+			return err
+		}
+	}
+	limits := []struct {
+		field string
+		value *string
+		max   int
+	}{
+		{"address", address, 500},
+		{"phone", phone, 50},
+		{"email", email, 255},
+		{"tax_id", taxID, 100},
+	}
+	for _, l := range limits {
+		if l.value != nil && utf8.RuneCountInString(strings.TrimSpace(*l.value)) > l.max {
+			return newAPIError("company_field_too_long", l.field, l.max)
+		}
+	}
+	if email != nil && strings.TrimSpace(*email) != "" {
+		if _, err := mail.ParseAddress(strings.TrimSpace(*email)); err != nil {
+			return newAPIError("invalid_email")
+		}
+	}
+	return nil
+}
+
+// optionalString maps blank input to NULL
+func optionalString(s string) sql.NullString {
+	s = strings.TrimSpace(s)
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func newSubsidiaryResponse(r sqlc.CreateSubsidiaryRow) SubsidiaryResponse {
+	return SubsidiaryResponse{
+		ID:                 r.ID,
+		Name:               r.Name,
+		Address:            r.Address.String,
+		Phone:              r.Phone.String,
+		Email:              r.Email.String,
+		TaxID:              r.TaxID.String,
+		ParentID:           r.ParentID.Int32,
+		InheritMemberships: r.InheritMemberships,
+		CreatedAt:          r.CreatedAt.Time.Format("2006-01-02T15:04:05Z"),
+	}
+}
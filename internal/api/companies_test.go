@@ -1,8 +1,15 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/db/sqlc"
+	"project/internal/testutil"
 )
 
 // CompanyResponse represents a clean company response structure
@@ -118,3 +125,86 @@ func TestCompaniesListResponseStructure(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildCompanyTree(t *testing.T) {
+	parent := func(id int32) sql.NullInt32 { return sql.NullInt32{Int32: id, Valid: true} }
+	rows := []sqlc.GetUserCompaniesRow{
+		{CompanyID: 1, CompanyName: "Holding", IsAdmin: true},
+		{CompanyID: 2, CompanyName: "Subsidiary A", ParentID: parent(1), IsAdmin: true, Inherited: true},
+		{CompanyID: 3, CompanyName: "Subsidiary B", ParentID: parent(2), IsAdmin: true, Inherited: true},
+		// Parent 9 is not accessible, so this company is a root
+		{CompanyID: 4, CompanyName: "Other", ParentID: parent(9)},
+	}
+
+	tree := buildCompanyTree(rows)
+	if len(tree) != 2 {
+		t.Fatalf("Expected 2 roots, got %d", len(tree))
+	}
+	if tree[0].CompanyID != 1 || len(tree[0].Children) != 1 || tree[0].Children[0].CompanyID != 2 {
+		t.Fatalf("Unexpected tree: %+v", tree[0])
+	}
+	grandchild := tree[0].Children[0].Children
+	if len(grandchild) != 1 || grandchild[0].CompanyID != 3 || !grandchild[0].Inherited {
+		t.Errorf("Expected inherited grandchild 3, got %+v", grandchild)
+	}
+	if tree[1].CompanyID != 4 || tree[1].ParentID == nil || *tree[1].ParentID != 9 {
+		t.Errorf("Expected orphaned company 4 as root with its parent ID, got %+v", tree[1])
+	}
+
+	jsonBytes, err := json.Marshal(tree[1])
+	if err != nil {
+		t.Fatalf("Failed to marshal tree node: %v", err)
+	}
+	expectedJSON := `{"CompanyID":4,"CompanyName":"Other","IsAdmin":false,"ParentID":9}`
+	if string(jsonBytes) != expectedJSON {
+		t.Errorf("Expected JSON: %s, got: %s", expectedJSON, string(jsonBytes))
+	}
+}
+
+func TestValidateCompanyFields(t *testing.T) {
+	long := string(make([]byte, 101))
+	tests := []struct {
+		name    *string
+		email   *string
+		taxID   *string
+		wantErr bool
+	}{
+		{strPtr("ACME GmbH"), strPtr("billing@acme.example"), strPtr("DE123456789"), false},
+		{nil, strPtr(""), nil, false},
+		{strPtr(""), nil, nil, true},
+		{nil, strPtr("not-an-email"), nil, true},
+		{nil, nil, &long, true},
+	}
+
+	for _, tt := range tests {
+		err := validateCompanyFields(tt.name, nil, nil, tt.email, tt.taxID)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateCompanyFields(%v, %v, %v) = %v, wantErr %v", tt.name, tt.email, tt.taxID, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRecordSubsidiaryAudit(t *testing.T) {
+	app := testutil.CreateTestApp()
+	audit := &core.MemoryAuditLog{}
+	app.Audit = audit
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/companies/9/attach", nil)
+	c.Set("user_id", int32(3))
+
+	recordSubsidiaryAudit(c, app, 1, 9, "company.subsidiary_attached",
+		gin.H{"parent_id": auditParentID(sql.NullInt32{})}, gin.H{"parent_id": auditParentID(sql.NullInt32{Int32: 1, Valid: true})})
+
+	records := audit.Records()
+	if len(records) != 2 || records[0].CompanyID != 1 || records[1].CompanyID != 9 {
+		t.Fatalf("Expected the event in the logs of companies 1 and 9, got %+v", records)
+	}
+	for _, r := range records {
+		if r.Action != "company.subsidiary_attached" || r.TargetType != "company" || r.TargetID != 9 || r.ActorUserID != 3 {
+			t.Errorf("Unexpected audit event %+v", r)
+		}
+		if string(r.Before) != `{"parent_id":null}` || string(r.After) != `{"parent_id":1}` {
+			t.Errorf("Expected the parent change, got %s -> %s", r.Before, r.After)
+		}
+	}
+}
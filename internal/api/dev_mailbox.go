@@ -0,0 +1,217 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+)
+
+// MailboxAttachment describes an attachment of a captured email without its content
+type MailboxAttachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+}
+
+// MailboxMessageResponse is an email captured by the dev mailbox
+type MailboxMessageResponse struct {
+	ID          int                 `json:"id"`
+	ReceivedAt  string              `json:"received_at"`
+	To          string              `json:"to"`
+	ToName      string              `json:"to_name,omitempty"`
+	ExtraTo     []core.EmailAddress `json:"extra_to,omitempty"`
+	Cc          []core.EmailAddress `json:"cc,omitempty"`
+	Bcc         []core.EmailAddress `json:"bcc,omitempty"`
+	From        string              `json:"from"`
+	FromName    string              `json:"from_name,omitempty"`
+	ReplyTo     string              `json:"reply_to,omitempty"`
+	Subject     string              `json:"subject"`
+	HTML        string              `json:"html"`
+	Text        string              `json:"text"`
+	Headers     map[string]string   `json:"headers,omitempty"`
+	Attachments []MailboxAttachment `json:"attachments,omitempty"`
+}
+
+func newMailboxMessageResponse(m core.MailboxMessage) MailboxMessageResponse {
+	resp := MailboxMessageResponse{
+		ID:         m.ID,
+		ReceivedAt: m.ReceivedAt.UTC().Format("2006-01-02T15:04:05Z"),
+		To:         m.To,
+		ToName:     m.ToName,
+		ExtraTo:    m.ExtraTo,
+		Cc:         m.Cc,
+		Bcc:        m.Bcc,
+		From:       m.From,
+		FromName:   m.FromName,
+		ReplyTo:    m.ReplyTo,
+		Subject:    m.Subject,
+		HTML:       m.HTMLBody,
+		Text:       m.TextBody,
+		Headers:    m.Headers,
+	}
+	for _, a := range m.Attachments {
+		resp.Attachments = append(resp.Attachments, MailboxAttachment{Name: a.Name, ContentType: a.ContentType, Size: len(a.Data)})
+	}
+	return resp
+}
+
+// DevMailboxHandler shows the emails captured by the dev mailbox transport, so OTP and
+// invitation flows can be tested locally for any user
+type DevMailboxHandler struct {
+	Mailbox *core.Mailbox
+}
+
+// registerDevMailboxRoutes serves the mailbox under /dev/mailbox when the app runs in the
+// dev environment with EMAIL_TRANSPORT=mailbox. The routes are unauthenticated, so the
+// transport is never chosen by default.
+func registerDevMailboxRoutes(r *gin.Engine, app *core.App) {
+	mailbox, ok := app.Mailer.(*core.Mailbox)
+	if !ok || app.Cfg.EmailTransport != core.EmailTransportMailbox || app.Cfg.Environment != "dev" {
+		return
+	}
+	h := &DevMailboxHandler{Mailbox: mailbox}
+	r.GET("/dev/mailbox", h.Index)
+	r.GET("/dev/mailbox/messages", h.ListMessages)
+	r.DELETE("/dev/mailbox/messages", sameOrigin(), h.ClearMessages)
+	r.GET("/dev/mailbox/messages/:id", h.GetMessage)
+	r.GET("/dev/mailbox/messages/:id/html", h.MessageHTML)
+}
+
+// sameOrigin rejects browser requests sent by other sites, which could otherwise clear the
+// mailbox while a developer has it open
+func sameOrigin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if origin := c.GetHeader("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Host != c.Request.Host {
+				abortError(c, http.StatusForbidden, "cross_origin_request")
+				return
+			}
+		}
+		if c.GetHeader("Sec-Fetch-Site") == "cross-site" {
+			abortError(c, http.StatusForbidden, "cross_origin_request")
+			return
+		}
+		c.Next()
+	}
+}
+
+// ListMessages returns the captured emails, newest first
+func (h *DevMailboxHandler) ListMessages(c *gin.Context) {
+	msgs := h.Mailbox.Messages()
+	resp := make([]MailboxMessageResponse, len(msgs))
+	for i, m := range msgs {
+		resp[i] = newMailboxMessageResponse(m)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": resp})
+}
+
+// GetMessage returns one captured email
+func (h *DevMailboxHandler) GetMessage(c *gin.Context) {
+	m, ok := h.message(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": newMailboxMessageResponse(m)})
+}
+
+// MessageHTML serves the HTML body of a captured email as a page of its own, sandboxed so
+// it cannot run scripts next to the mailbox
+func (h *DevMailboxHandler) MessageHTML(c *gin.Context) {
+	m, ok := h.message(c)
+	if !ok {
+		return
+	}
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(m.HTMLBody))
+}
+
+// ClearMessages empties the mailbox
+func (h *DevMailboxHandler) ClearMessages(c *gin.Context) {
+	h.Mailbox.Clear()
+	c.Status(http.StatusNoContent)
+}
+
+// message looks up the email named by the :id parameter, responding when there is none
+func (h *DevMailboxHandler) message(c *gin.Context) (core.MailboxMessage, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_message_id")
+		return core.MailboxMessage{}, false
+	}
+	m, ok := h.Mailbox.Message(id)
+	if !ok {
+		respondError(c, http.StatusNotFound, "message_not_found")
+		return core.MailboxMessage{}, false
+	}
+	return m, true
+}
+
+// Index renders the mailbox as a page listing the captured emails with their bodies
+func (h *DevMailboxHandler) Index(c *gin.Context) {
+	msgs := h.Mailbox.Messages()
+	resp := make([]MailboxMessageResponse, len(msgs))
+	for i, m := range msgs {
+		resp[i] = newMailboxMessageResponse(m)
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := mailboxPage.Execute(c.Writer, resp); err != nil {
+		c.Error(err)
+	}
+}
+
+var mailboxPage = template.Must(template.New("mailbox").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Mailbox ({{len .}})</title>
+<style>
+body { font-family: sans-serif; margin: 0; background: #f4f4f5; color: #18181b; }
+header { display: flex; justify-content: space-between; align-items: center; padding: 12px 24px; background: #18181b; color: #fff; }
+header button { cursor: pointer; }
+main { max-width: 960px; margin: 0 auto; padding: 16px; }
+details { background: #fff; border: 1px solid #e4e4e7; border-radius: 6px; margin-bottom: 8px; }
+summary { cursor: pointer; padding: 12px 16px; }
+summary .meta { color: #71717a; font-size: 13px; }
+dl { display: grid; grid-template-columns: max-content 1fr; gap: 4px 12px; margin: 0; padding: 0 16px 12px; font-size: 14px; }
+dt { color: #71717a; }
+dd { margin: 0; }
+iframe { width: 100%; height: 480px; border: 0; border-top: 1px solid #e4e4e7; background: #fff; }
+pre { margin: 0; padding: 12px 16px; border-top: 1px solid #e4e4e7; white-space: pre-wrap; }
+.empty { color: #71717a; text-align: center; padding: 48px; }
+</style>
+</head>
+<body>
+<header>
+<strong>Mailbox</strong>
+<span><a href="/dev/mailbox/messages" style="color:#fff">JSON</a>
+<button onclick="fetch('/dev/mailbox/messages', {method: 'DELETE'}).then(() => location.reload())">Clear</button></span>
+</header>
+<main>
+{{range .}}
+<details>
+<summary><strong>{{.Subject}}</strong><br><span class="meta">#{{.ID}} to {{.To}} at {{.ReceivedAt}}</span></summary>
+<dl>
+<dt>From</dt><dd>{{if .FromName}}{{.FromName}} &lt;{{.From}}&gt;{{else}}{{.From}}{{end}}</dd>
+<dt>To</dt><dd>{{if .ToName}}{{.ToName}} &lt;{{.To}}&gt;{{else}}{{.To}}{{end}}{{range .ExtraTo}}, {{.Address}}{{end}}</dd>
+{{if .Cc}}<dt>Cc</dt><dd>{{range $i, $a := .Cc}}{{if $i}}, {{end}}{{$a.Address}}{{end}}</dd>{{end}}
+{{if .Bcc}}<dt>Bcc</dt><dd>{{range $i, $a := .Bcc}}{{if $i}}, {{end}}{{$a.Address}}{{end}}</dd>{{end}}
+{{if .ReplyTo}}<dt>Reply-To</dt><dd>{{.ReplyTo}}</dd>{{end}}
+{{range $k, $v := .Headers}}<dt>{{$k}}</dt><dd>{{$v}}</dd>{{end}}
+{{range .Attachments}}<dt>Attachment</dt><dd>{{.Name}} ({{.ContentType}}, {{.Size}} bytes)</dd>{{end}}
+</dl>
+{{if .HTML}}<iframe sandbox src="/dev/mailbox/messages/{{.ID}}/html" loading="lazy"></iframe>{{end}}
+{{if .Text}}<pre>{{.Text}}</pre>{{end}}
+</details>
+{{else}}
+<p class="empty">No emails yet. Emails sent while the app runs appear here.</p>
+{{end}}
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/testutil"
+)
+
+// newMailboxApp returns an app configured with EMAIL_TRANSPORT=mailbox
+func newMailboxApp(environment string) *core.App {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	app.Cfg.Environment = environment
+	app.Cfg.EmailTransport = core.EmailTransportMailbox
+	app.Mailer = &core.Mailbox{From: "noreply@example.com"}
+	return app
+}
+
+func serveMailbox(router *gin.Engine, method, path string, headers ...string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestDevMailboxListsMessages(t *testing.T) {
+	app := newMailboxApp("dev")
+	router := Build(app)
+	app.Mailer.Send(context.Background(), core.EmailMessage{
+		To: "jane@example.com", Subject: "<b>Your OTP Code</b>", HTMLBody: "<p>482913</p>", TextBody: "482913",
+	})
+
+	recorder := serveMailbox(router, "GET", "/dev/mailbox/messages")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf(statusErrMsg, http.StatusOK, recorder.Code)
+	}
+	var body struct {
+		Data []MailboxMessageResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Data) != 1 || body.Data[0].To != "jane@example.com" || body.Data[0].Text != "482913" || body.Data[0].From != "noreply@example.com" {
+		t.Fatalf("unexpected messages %+v", body.Data)
+	}
+
+	recorder = serveMailbox(router, "GET", "/dev/mailbox")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf(statusErrMsg, http.StatusOK, recorder.Code)
+	}
+	page := recorder.Body.String()
+	if strings.Contains(page, "<b>Your OTP Code</b>") || !strings.Contains(page, "&lt;b&gt;Your OTP Code&lt;/b&gt;") {
+		t.Error("expected the subject to be escaped")
+	}
+	if !strings.Contains(page, `src="/dev/mailbox/messages/1/html"`) {
+		t.Error("expected the HTML body to be embedded")
+	}
+
+	recorder = serveMailbox(router, "GET", "/dev/mailbox/messages/1/html")
+	if recorder.Body.String() != "<p>482913</p>" || recorder.Header().Get("Content-Security-Policy") != "sandbox" {
+		t.Errorf("unexpected HTML body %q with CSP %q", recorder.Body.String(), recorder.Header().Get("Content-Security-Policy"))
+	}
+	if recorder := serveMailbox(router, "GET", "/dev/mailbox/messages/2"); recorder.Code != http.StatusNotFound {
+		t.Errorf(statusErrMsg, http.StatusNotFound, recorder.Code)
+	}
+
+	// Other sites cannot clear the mailbox from a developer's browser
+	if recorder := serveMailbox(router, "DELETE", "/dev/mailbox/messages", "Origin", "https://evil.example"); recorder.Code != http.StatusForbidden {
+		t.Errorf(statusErrMsg, http.StatusForbidden, recorder.Code)
+	}
+	if recorder := serveMailbox(router, "DELETE", "/dev/mailbox/messages", "Sec-Fetch-Site", "cross-site"); recorder.Code != http.StatusForbidden {
+		t.Errorf(statusErrMsg, http.StatusForbidden, recorder.Code)
+	}
+	if len(app.Mailer.(*core.Mailbox).Messages()) != 1 {
+		t.Fatal("expected the mailbox to be kept")
+	}
+
+	if recorder := serveMailbox(router, "DELETE", "http://localhost:8080/dev/mailbox/messages", "Origin", "http://localhost:8080"); recorder.Code != http.StatusNoContent {
+		t.Errorf(statusErrMsg, http.StatusNoContent, recorder.Code)
+	}
+	if msgs := app.Mailer.(*core.Mailbox).Messages(); len(msgs) != 0 {
+		t.Errorf("expected the mailbox to be cleared, got %+v", msgs)
+	}
+}
+
+func TestDevMailboxOnlyInDev(t *testing.T) {
+	router := Build(newMailboxApp("prod"))
+	if recorder := serveMailbox(router, "GET", "/dev/mailbox"); recorder.Code != http.StatusNotFound {
+		t.Errorf(statusErrMsg, http.StatusNotFound, recorder.Code)
+	}
+	// The dev environment alone does not expose captured emails
+	app := newMailboxApp("dev")
+	app.Cfg.EmailTransport = ""
+	if recorder := serveMailbox(Build(app), "GET", "/dev/mailbox"); recorder.Code != http.StatusNotFound {
+		t.Errorf(statusErrMsg, http.StatusNotFound, recorder.Code)
+	}
+	// Other transports capture nothing to show
+	app = testutil.CreateTestApp()
+	app.Cfg.Environment = "dev"
+	if recorder := serveMailbox(Build(app), "GET", "/dev/mailbox"); recorder.Code != http.StatusNotFound {
+		t.Errorf(statusErrMsg, http.StatusNotFound, recorder.Code)
+	}
+}
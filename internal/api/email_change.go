@@ -0,0 +1,396 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	core "project/internal"
+	"project/internal/db/sqlc"
+	"project/internal/emails"
+)
+
+// emailChangeRevertTTL is how long the old address can undo an email change
+const emailChangeRevertTTL = 7 * 24 * time.Hour
+
+// RequestEmailChange sends a verification OTP to the requested new address
+func (h *MeHandler) RequestEmailChange(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if !requireRecentLogin(c) {
+		return
+	}
+
+	var req struct {
+		NewEmail string `json:"new_email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	newEmail := core.NormalizeEmail(req.NewEmail)
+
+	user, err := h.App.Queries.GetUserByID(c, userID.(int32))
+	if err != nil {
+		respondError(c, http.StatusNotFound, "user_not_found")
+		return
+	}
+	if strings.EqualFold(user.Email, newEmail) {
+		respondError(c, http.StatusBadRequest, "email_unchanged")
+		return
+	}
+	if _, err := h.App.Queries.GetUserByEmail(c, newEmail); err == nil {
+		respondError(c, http.StatusConflict, "email_in_use")
+		return
+	} else if err != sql.ErrNoRows {
+		respondError(c, http.StatusInternalServerError, "database_error")
+		return
+	}
+
+	cacheKey := fmt.Sprintf("email_change:%d", user.ID)
+
+	// Apply the same resend guard as login OTPs
+	if cachedData, exists := h.App.CacheGet(cacheKey); exists {
+		if changeData, ok := cachedData.(map[string]interface{}); ok {
+			if lastSent, ok := changeData["last_sent"].(time.Time); ok && time.Since(lastSent) < time.Minute {
+				body := errorBody(c, "otp_already_sent")
+				body["retry_after"] = int((time.Minute - time.Since(lastSent)).Seconds())
+				c.JSON(http.StatusTooManyRequests, body)
+				return
+			}
+		}
+	}
+
+	otp := generateOTP(defaultOTPLength)
+	changeData := map[string]interface{}{
+		"otp":       otp,
+		"new_email": newEmail,
+		"last_sent": time.Now(),
+	}
+	h.App.CacheSet(cacheKey, changeData, 15*time.Minute)
+	resetOTPAttempts(h.App, cacheKey)
+
+	var companyID int32
+	if v, ok := c.Get("company_id"); ok {
+		companyID = v.(int32)
+	}
+	settings, err := loadCompanySettings(c, h.App, companyID)
+	if err != nil {
+		h.App.Cache.Delete(cacheKey)
+		respondError(c, http.StatusInternalServerError, "settings_load_failed")
+		return
+	}
+	msg, err := otpEmail(h.App.Cfg, newEmail, user.Name, requestLocale(c), emails.OTPEmailChange, otp, settings)
+	if err == nil {
+		_, err = h.App.EnqueueEmail(c, h.App.Queries, core.OutboxEmail{
+			CompanyID:    companyID,
+			CompanyLimit: settings.Int("email.hourly_limit"),
+			Message:      msg,
+		})
+	}
+	if err != nil {
+		h.App.Cache.Delete(cacheKey)
+		if !respondEmailBudget(c, err) {
+			respondError(c, http.StatusInternalServerError, "otp_send_failed")
+		}
+		return
+	}
+	h.App.NotifyOutbox()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": localize(c, "email_change_otp_sent"),
+		"email":   newEmail,
+	})
+}
+
+// ConfirmEmailChange verifies the OTP and swaps the user's email address
+func (h *MeHandler) ConfirmEmailChange(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if !requireRecentLogin(c) {
+		return
+	}
+
+	var req struct {
+		OTP string `json:"otp" binding:"required,len=6"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_body")
+		return
+	}
+
+	cacheKey := fmt.Sprintf("email_change:%d", userID.(int32))
+	cachedData, exists := h.App.CacheGet(cacheKey)
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "otp_not_found")
+		return
+	}
+	changeData, ok := cachedData.(map[string]interface{})
+	if !ok {
+		respondError(c, http.StatusInternalServerError, "invalid_otp_data")
+		return
+	}
+	storedOTP, otpOk := changeData["otp"].(string)
+	newEmail, emailOk := changeData["new_email"].(string)
+	if !otpOk || !emailOk || subtle.ConstantTimeCompare([]byte(storedOTP), []byte(req.OTP)) != 1 {
+		if otpAttemptFailed(h.App, cacheKey) {
+			respondError(c, http.StatusTooManyRequests, "otp_attempts_exceeded")
+			return
+		}
+		respondError(c, http.StatusUnauthorized, "email_change_otp_invalid")
+		return
+	}
+
+	user, err := h.App.Queries.GetUserByID(c, userID.(int32))
+	if err != nil {
+		respondError(c, http.StatusNotFound, "user_not_found")
+		return
+	}
+
+	revertToken, err := generateRevertToken()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "revert_token_failed")
+		return
+	}
+
+	var companyID int32
+	if v, ok := c.Get("company_id"); ok {
+		companyID = v.(int32)
+	}
+	settings, err := loadCompanySettings(c, h.App, companyID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "settings_load_failed")
+		return
+	}
+	revertURL := fmt.Sprintf("%s/v1/email/revert?token=%s", strings.TrimRight(h.App.Cfg.AppBaseURL, "/"), url.QueryEscape(revertToken))
+	notice, err := emailChangedNotice(h.App.Cfg, settings, user.Email, user.Name, requestLocale(c), newEmail, revertURL)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "email_render_failed")
+		return
+	}
+
+	// Swap the address, record the revert token and queue the notice to the old address atomically
+	var updated sqlc.UpdateUserEmailRow
+	err = h.App.WithTx(c, func(tx *core.Tx) error {
+		var err error
+		updated, err = tx.UpdateUserEmail(c, &sqlc.UpdateUserEmailParams{ID: user.ID, Email: newEmail})
+		if err != nil {
+			return err
+		}
+		err = tx.CreateEmailChangeRevert(c, &sqlc.CreateEmailChangeRevertParams{
+			UserID:    user.ID,
+			OldEmail:  user.Email,
+			NewEmail:  newEmail,
+			TokenHash: hashToken(revertToken),
+			ExpiresAt: time.Now().Add(emailChangeRevertTTL),
+		})
+		if err != nil {
+			return err
+		}
+		// The old address must learn about the change even when its budget is used up
+		_, err = h.App.EnqueueEmail(c, tx.Queries, core.OutboxEmail{
+			CompanyID:      companyID,
+			IdempotencyKey: "email_change_notice:" + hashToken(revertToken),
+			Essential:      true,
+			Message:        notice,
+		})
+		return err
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondError(c, http.StatusConflict, "email_in_use")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "email_update_failed")
+		return
+	}
+
+	// Invalidate outstanding OTPs and every session issued before the change
+	h.App.Cache.Delete(cacheKey)
+	h.App.Cache.Delete(fmt.Sprintf("otp:%s", core.NormalizeEmail(user.Email)))
+	h.App.Cache.Delete(fmt.Sprintf("otp:%s", newEmail))
+	revokeSessions(h.App, user.ID, time.Now())
+	h.App.NotifyOutbox()
+	recordAccountAudit(c, h.App, user.ID, "user.email_changed", gin.H{"email": user.Email}, gin.H{"email": updated.Email})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": localize(c, "email_changed"),
+		"email":   updated.Email,
+	})
+}
+
+// RevertEmailChangePage shows the form behind the revert link sent to the old address.
+// Opening the link changes nothing, so mail scanners and link prefetchers cannot undo a
+// legitimate change; the user confirms with a POST.
+func (h *MeHandler) RevertEmailChangePage(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		renderRevertPage(c, http.StatusBadRequest, revertPage{Message: localize(c, "page.revert_email.invalid")})
+		return
+	}
+	revert, err := h.App.Queries.GetEmailChangeRevert(c, hashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			renderRevertPage(c, http.StatusNotFound, revertPage{Message: localize(c, "page.revert_email.invalid")})
+			return
+		}
+		renderRevertPage(c, http.StatusInternalServerError, revertPage{Message: localize(c, "page.revert_email.failed")})
+		return
+	}
+
+	renderRevertPage(c, http.StatusOK, revertPage{
+		Message: localize(c, "page.revert_email.body", revert.NewEmail, revert.OldEmail),
+		Notice:  localize(c, "email.email_changed.revert_notice"),
+		Action:  strings.TrimRight(h.App.Cfg.AppBaseURL, "/") + "/v1/email/revert",
+		Token:   token,
+		Button:  localize(c, "email.email_changed.revert"),
+	})
+}
+
+// RevertEmailChange restores the previous address when the revert form is submitted
+func (h *MeHandler) RevertEmailChange(c *gin.Context) {
+	token := c.PostForm("token")
+	if token == "" {
+		renderRevertPage(c, http.StatusBadRequest, revertPage{Message: localize(c, "page.revert_email.invalid")})
+		return
+	}
+
+	revert, err := h.App.Queries.GetEmailChangeRevert(c, hashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			renderRevertPage(c, http.StatusNotFound, revertPage{Message: localize(c, "page.revert_email.invalid")})
+			return
+		}
+		renderRevertPage(c, http.StatusInternalServerError, revertPage{Message: localize(c, "page.revert_email.failed")})
+		return
+	}
+
+	var restored sqlc.UpdateUserEmailRow
+	err = h.App.WithTx(c, func(tx *core.Tx) error {
+		var err error
+		restored, err = tx.UpdateUserEmail(c, &sqlc.UpdateUserEmailParams{ID: revert.UserID, Email: revert.OldEmail})
+		if err != nil {
+			return err
+		}
+		return tx.MarkEmailChangeRevertsUsed(c, revert.UserID)
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			renderRevertPage(c, http.StatusConflict, revertPage{Message: localize(c, "page.revert_email.conflict")})
+			return
+		}
+		renderRevertPage(c, http.StatusInternalServerError, revertPage{Message: localize(c, "page.revert_email.failed")})
+		return
+	}
+
+	// Whoever changed the address must not keep access
+	h.App.Cache.Delete(fmt.Sprintf("email_change:%d", revert.UserID))
+	h.App.Cache.Delete(fmt.Sprintf("otp:%s", revert.NewEmail))
+	revokeSessions(h.App, revert.UserID, time.Now())
+	recordAccountAudit(c, h.App, revert.UserID, "user.email_reverted", gin.H{"email": revert.NewEmail}, gin.H{"email": restored.Email})
+
+	renderRevertPage(c, http.StatusOK, revertPage{Message: localize(c, "page.revert_email.done", restored.Email)})
+}
+
+// revertPage is what the revert page shows: a message, and the confirmation form when
+// Token is set
+type revertPage struct {
+	Locale  string
+	Title   string
+	Message string
+	Notice  string
+	Action  string
+	Token   string
+	Button  string
+}
+
+// renderRevertPage writes the revert page. The token travels in its URL, so the page is
+// never sent as a referrer or framed by other sites.
+func renderRevertPage(c *gin.Context, status int, page revertPage) {
+	page.Locale = requestLocale(c)
+	page.Title = localize(c, "page.revert_email.title")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	c.Status(status)
+	if err := revertPageTemplate.Execute(c.Writer, page); err != nil {
+		c.Error(err)
+	}
+}
+
+var revertPageTemplate = template.Must(template.New("revert").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; background: #f8f9fa; color: #18181b; margin: 0; }
+main { max-width: 480px; margin: 64px auto; padding: 24px; background: #fff; border: 1px solid #e4e4e7; border-radius: 6px; }
+h1 { font-size: 20px; margin-top: 0; }
+.notice { color: #71717a; font-size: 14px; }
+button { background: #007bff; color: #fff; border: 0; border-radius: 4px; padding: 10px 16px; font-size: 16px; cursor: pointer; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .Token}}<p class="notice">{{.Notice}}</p>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">{{.Button}}</button>
+</form>{{end}}
+</main>
+</body>
+</html>
+`))
+
+// emailChangedNotice renders the notice sent to the old address, branded with the company's settings
+func emailChangedNotice(cfg core.Config, settings companySettings, to, name, locale, newEmail, revertURL string) (core.EmailMessage, error) {
+	return renderEmail(cfg, settings, to, name, emails.EmailChanged, emails.EmailChangedData{
+		Base:       emails.Base{Brand: emailBrand(settings), Name: name, Locale: locale},
+		NewEmail:   newEmail,
+		RevertURL:  revertURL,
+		RevertDays: int(emailChangeRevertTTL / (24 * time.Hour)),
+	})
+}
+
+// generateRevertToken creates a random URL-safe token for the revert link
+func generateRevertToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a token so raw tokens are never stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/emails"
+	"project/internal/i18n"
+	"project/internal/testutil"
+)
+
+func TestHashTokenIsStableAndOpaque(t *testing.T) {
+	token, err := generateRevertToken()
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if len(token) != 64 {
+		t.Errorf("Expected 64 hex characters, got %d", len(token))
+	}
+	if hashToken(token) != hashToken(token) {
+		t.Error("Expected hashToken to be deterministic")
+	}
+	if hashToken(token) == token {
+		t.Error("Expected hash to differ from the raw token")
+	}
+}
+
+func TestEmailChangedNoticeEscapesInput(t *testing.T) {
+	msg, err := renderEmail(core.Config{}, companySettings{}, "old@example.com", "<script>", emails.EmailChanged, emails.EmailChangedData{
+		Base:       emails.Base{Name: "<script>"},
+		NewEmail:   "new@example.com",
+		RevertURL:  "http://localhost/v1/email/revert?token=a&b",
+		RevertDays: 7,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body := msg.HTMLBody
+
+	if strings.Contains(body, "<script>") {
+		t.Error("Expected user name to be escaped")
+	}
+	if !strings.Contains(body, "token=a&amp;b") {
+		t.Error("Expected revert URL to be escaped in the href")
+	}
+	if !strings.Contains(body, "new@example.com") {
+		t.Error("Expected new address in the notice")
+	}
+}
+
+func TestEmailChangeEmailsUseCompanySettings(t *testing.T) {
+	settings := companySettings{"email.brand_color": "#a1b2c3", "email.from_name": "Acme Security"}
+
+	otp, err := otpEmail(core.Config{}, "new@example.com", "Jane", "de", emails.OTPEmailChange, "482913", settings)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	notice, err := emailChangedNotice(core.Config{}, settings, "old@example.com", "Jane", "de", "new@example.com", "http://localhost/v1/email/revert?token=a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for name, msg := range map[string]core.EmailMessage{"otp": otp, "notice": notice} {
+		if msg.FromName != "Acme Security" || !strings.Contains(msg.HTMLBody, "#a1b2c3") {
+			t.Errorf("%s: expected the company sender and brand, got from %q:\n%s", name, msg.FromName, msg.HTMLBody)
+		}
+	}
+	if notice.Subject != i18n.T("de", "email.email_changed.subject") {
+		t.Errorf("Expected a German subject, got %q", notice.Subject)
+	}
+}
+
+func TestOTPEmailHasTextAlternative(t *testing.T) {
+	msg, err := otpEmail(core.Config{}, "jane@example.com", "Jane", "", emails.OTPEmailChange, "482913", companySettings{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if msg.Subject != "Confirm your new email address" {
+		t.Errorf("Unexpected subject %q", msg.Subject)
+	}
+	if !strings.Contains(msg.TextBody, "482913") || strings.Contains(msg.TextBody, "<div") {
+		t.Errorf("Expected plain-text OTP, got:\n%s", msg.TextBody)
+	}
+}
+
+func TestLoginOTPAttemptsAreLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	router := Build(app)
+	app.CacheSet("otp:jane@example.com", map[string]interface{}{
+		"otp": "482913", "email": "jane@example.com", "user_id": int32(123),
+	}, 15*time.Minute)
+
+	login := func() int {
+		req, _ := http.NewRequest("POST", "/v1/login", strings.NewReader(`{"email":"jane@example.com","otp":"000000"}`))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	for i := 1; i < maxOTPAttempts; i++ {
+		if code := login(); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: "+statusErrMsg, i, http.StatusUnauthorized, code)
+		}
+	}
+	if code := login(); code != http.StatusTooManyRequests {
+		t.Errorf(statusErrMsg, http.StatusTooManyRequests, code)
+	}
+	if _, ok := app.CacheGet("otp:jane@example.com"); ok {
+		t.Error("Expected the OTP to be discarded")
+	}
+
+	// A new OTP gets a fresh count
+	app.CacheSet("otp:jane@example.com", map[string]interface{}{"otp": "482913"}, 15*time.Minute)
+	resetOTPAttempts(app, "otp:jane@example.com")
+	if otpAttemptFailed(app, "otp:jane@example.com") {
+		t.Error("Expected the count to start over")
+	}
+}
+
+func TestRevertLinkOnlyShowsAForm(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := Build(testutil.CreateTestApp())
+
+	req, _ := http.NewRequest("GET", "/v1/email/revert", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "This link is invalid or has expired.") {
+		t.Errorf("Expected the invalid link page, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest("GET", "/v1/email/revert?token=x", nil)
+	renderRevertPage(c, http.StatusOK, revertPage{Message: "<b>", Action: "/v1/email/revert", Token: `a"b`, Button: "Revert"})
+	page := recorder.Body.String()
+	if !strings.Contains(page, `<form method="post" action="/v1/email/revert">`) || !strings.Contains(page, `value="a&#34;b"`) {
+		t.Errorf("Expected a POST form carrying the escaped token, got:\n%s", page)
+	}
+	if strings.Contains(page, "<b>") || recorder.Header().Get("Referrer-Policy") != "no-referrer" {
+		t.Errorf("Expected an escaped message and no referrer, got %v:\n%s", recorder.Header(), page)
+	}
+}
+
+func TestConfirmEmailChangeRejectsWrongOTP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	router := Build(app)
+	app.CacheSet("email_change:123", map[string]interface{}{
+		"otp": "482913", "new_email": "new@example.com", "last_sent": time.Now(),
+	}, 15*time.Minute)
+
+	recorder := postAsUser(t, app, router, "/v1/me/email/confirm", `{"otp":"482914"}`, time.Now())
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf(statusErrMsg, http.StatusUnauthorized, recorder.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if body["code"] != "email_change_otp_invalid" || body["error"] != "invalid OTP" {
+		t.Errorf("Unexpected error body %v", body)
+	}
+}
+
+func TestEmailChangeNeedsRecentLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	router := Build(app)
+
+	// A token refreshed long after the login cannot move the account to another address
+	for path, body := range map[string]string{
+		"/v1/me/email":         `{"new_email":"attacker@example.com"}`,
+		"/v1/me/email/confirm": `{"otp":"482913"}`,
+	} {
+		recorder := postAsUser(t, app, router, path, body, time.Now().Add(-time.Hour))
+		if recorder.Code != http.StatusForbidden || !strings.Contains(recorder.Body.String(), `"code":"reauthentication_required"`) {
+			t.Errorf("%s: expected reauthentication_required, got %d: %s", path, recorder.Code, recorder.Body.String())
+		}
+	}
+}
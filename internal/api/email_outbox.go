@@ -0,0 +1,228 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/db/sqlc"
+)
+
+// OutboxEmailResponse represents a queued email in API responses. Bodies are never
+// returned because they can carry login codes.
+type OutboxEmailResponse struct {
+	ID             int32   `json:"id"`
+	IdempotencyKey string  `json:"idempotency_key,omitempty"`
+	To             string  `json:"to"`
+	Subject        string  `json:"subject"`
+	Attachments    int32   `json:"attachments,omitempty"` // number of attached files
+	Status         string  `json:"status"`
+	Attempts       int32   `json:"attempts"`
+	LastError      string  `json:"last_error,omitempty"`
+	NextAttemptAt  string  `json:"next_attempt_at"`
+	SentAt         *string `json:"sent_at,omitempty"`
+	CreatedAt      string  `json:"created_at"`
+	// Delivery as reported by the provider's webhooks, once it reports
+	DeliveryStatus    string  `json:"delivery_status,omitempty"`
+	DeliveryDetail    string  `json:"delivery_detail,omitempty"`
+	DeliveryUpdatedAt *string `json:"delivery_updated_at,omitempty"`
+}
+
+// EmailOutboxHandler lets admins inspect the company's outgoing email
+type EmailOutboxHandler struct {
+	App *core.App
+}
+
+// NewEmailOutboxHandler creates a new EmailOutboxHandler instance
+func NewEmailOutboxHandler(app *core.App) *EmailOutboxHandler {
+	return &EmailOutboxHandler{App: app}
+}
+
+func newOutboxEmailResponse(e sqlc.ListOutboxEmailsRow) OutboxEmailResponse {
+	res := OutboxEmailResponse{
+		ID:             e.ID,
+		IdempotencyKey: e.IdempotencyKey.String,
+		To:             e.ToAddress,
+		Subject:        e.Subject,
+		Attachments:    e.AttachmentCount,
+		Status:         e.Status,
+		Attempts:       e.Attempts,
+		LastError:      e.LastError.String,
+		NextAttemptAt:  e.NextAttemptAt.Format("2006-01-02T15:04:05Z"),
+		CreatedAt:      e.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if e.SentAt.Valid {
+		sentAt := e.SentAt.Time.Format("2006-01-02T15:04:05Z")
+		res.SentAt = &sentAt
+	}
+	if e.DeliveryStatus.Valid {
+		res.DeliveryStatus = e.DeliveryStatus.String
+		res.DeliveryDetail = e.DeliveryDetail.String
+	}
+	if e.DeliveryUpdatedAt.Valid {
+		updatedAt := e.DeliveryUpdatedAt.Time.Format("2006-01-02T15:04:05Z")
+		res.DeliveryUpdatedAt = &updatedAt
+	}
+	return res
+}
+
+// ListOutboxEmails returns the company's queued and sent emails, newest first (admin only)
+func (h *EmailOutboxHandler) ListOutboxEmails(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+
+	params := &sqlc.ListOutboxEmailsParams{CompanyID: companyID.(int32)}
+	limit, err := parseLimit(c.Query("limit"))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+	params.PageLimit = limit + 1 // fetch one extra row to know whether another page exists
+
+	if v := c.Query("status"); v != "" {
+		switch v {
+		case core.OutboxStatusPending, core.OutboxStatusSending, core.OutboxStatusSent, core.OutboxStatusDead:
+		default:
+			respondError(c, http.StatusBadRequest, "invalid_outbox_status")
+			return
+		}
+		params.Status = sql.NullString{String: v, Valid: true}
+	}
+	if v := c.Query("cursor"); v != "" {
+		cur, err := decodeCursor(v, "id:desc")
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err)
+			return
+		}
+		params.CursorID = sql.NullInt32{Int32: cur.ID, Valid: true}
+	}
+
+	emails, err := h.App.Queries.ListOutboxEmails(c, params)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "outbox_emails_fetch_failed")
+		return
+	}
+
+	var nextCursor *string
+	if int32(len(emails)) > limit {
+		emails = emails[:limit]
+		cur := encodeCursor(pageCursor{Sort: "id:desc", ID: emails[len(emails)-1].ID})
+		nextCursor = &cur
+	}
+
+	response := make([]OutboxEmailResponse, len(emails))
+	for i, e := range emails {
+		response[i] = newOutboxEmailResponse(e)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response, "next_cursor": nextCursor})
+}
+
+// GetOutboxEmail returns a single queued email (admin only)
+func (h *EmailOutboxHandler) GetOutboxEmail(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	id, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_email_id")
+		return
+	}
+
+	e, err := h.App.Queries.GetOutboxEmail(c, &sqlc.GetOutboxEmailParams{ID: id, CompanyID: companyID.(int32)})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "outbox_email_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "outbox_email_fetch_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": newOutboxEmailResponse(sqlc.ListOutboxEmailsRow(e))})
+}
+
+// RetryOutboxEmail puts a dead-lettered email back in the queue with fresh attempts (admin only)
+func (h *EmailOutboxHandler) RetryOutboxEmail(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	id, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_email_id")
+		return
+	}
+
+	n, err := h.App.Queries.RetryOutboxEmail(c, &sqlc.RetryOutboxEmailParams{ID: id, CompanyID: companyID.(int32)})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "outbox_email_retry_failed")
+		return
+	}
+
+	e, err := h.App.Queries.GetOutboxEmail(c, &sqlc.GetOutboxEmailParams{ID: id, CompanyID: companyID.(int32)})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "outbox_email_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "outbox_email_fetch_failed")
+		return
+	}
+	if n == 0 {
+		respondError(c, http.StatusConflict, "outbox_email_not_dead", e.Status)
+		return
+	}
+
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  companyID.(int32),
+		Action:     "email.retried",
+		TargetType: "email",
+		TargetID:   id,
+	})
+	h.App.NotifyOutbox()
+
+	c.JSON(http.StatusOK, gin.H{"data": newOutboxEmailResponse(sqlc.ListOutboxEmailsRow(e))})
+}
+
+// EmailUsageResponse is the company's use of its hourly send budget
+type EmailUsageResponse struct {
+	WindowSeconds int   `json:"window_seconds"`
+	Limit         int   `json:"limit"`
+	Used          int64 `json:"used"`
+	Remaining     int64 `json:"remaining"`
+}
+
+// GetEmailUsage returns how much of its send budget the company used in the last hour (admin only)
+func (h *EmailOutboxHandler) GetEmailUsage(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	settings, err := loadCompanySettings(c, h.App, companyID.(int32))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "settings_load_failed")
+		return
+	}
+	usage, err := core.RecentEmailUsage(c, h.App.Queries, companyID.(int32), nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "email_count_failed")
+		return
+	}
+
+	limit := settings.Int("email.hourly_limit")
+	c.JSON(http.StatusOK, gin.H{"data": EmailUsageResponse{
+		WindowSeconds: int(core.EmailBudgetWindow.Seconds()),
+		Limit:         limit,
+		Used:          usage.Company,
+		Remaining:     max(int64(limit)-usage.Company, 0),
+	}})
+}
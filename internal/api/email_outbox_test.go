@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/testutil"
+)
+
+func TestEmailOutboxValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewEmailOutboxHandler(testutil.CreateTestApp())
+
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		path    string
+		id      string
+		code    string
+	}{
+		{"invalid status", h.ListOutboxEmails, "/v1/email-outbox?status=bounced", "", "invalid_outbox_status"},
+		{"invalid limit", h.ListOutboxEmails, "/v1/email-outbox?limit=0", "", "invalid_limit"},
+		{"invalid cursor", h.ListOutboxEmails, "/v1/email-outbox?cursor=not-a-cursor!", "", "invalid_cursor"},
+		{"invalid id", h.GetOutboxEmail, "/v1/email-outbox/abc", "abc", "invalid_email_id"},
+		{"invalid retry id", h.RetryOutboxEmail, "/v1/email-outbox/0/retry", "0", "invalid_email_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", tt.path, nil)
+			c.Params = gin.Params{{Key: "id", Value: tt.id}}
+			c.Set("company_id", int32(456))
+
+			tt.handler(c)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf(statusErrMsg, http.StatusBadRequest, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), `"code":"`+tt.code+`"`) {
+				t.Errorf("Expected code %s, got %s", tt.code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestEmailOutboxRequiresAdmin(t *testing.T) {
+	app := testutil.CreateTestApp()
+	app.CacheSet("sessions_revoked:123", time.Time{}, time.Minute)
+	app.CacheSet("company_settings:456", companySettings{}, time.Minute)
+	r := Build(app)
+
+	token, _ := testutil.CreateValidJWTToken(app.Cfg.JWTSecret, 123, 456, false, "access")
+	req, _ := http.NewRequest("GET", "/v1/email-outbox", nil)
+	req.Header.Set("Authorization", bearerPrefix+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf(statusErrMsg, http.StatusForbidden, w.Code)
+	}
+}
+
+func TestRespondEmailBudget(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"recipient", &core.EmailBudgetError{Scope: core.EmailBudgetRecipient, Limit: 10}, "email_recipient_throttled"},
+		{"company", fmt.Errorf("enqueue: %w", &core.EmailBudgetError{Scope: core.EmailBudgetCompany, Limit: 200}), "email_budget_exhausted"},
+		{"global", &core.EmailBudgetError{Scope: core.EmailBudgetGlobal, Limit: 2000}, "email_budget_exhausted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/v1/login/request", nil)
+
+			if !respondEmailBudget(c, tt.err) {
+				t.Fatal("expected a budget response")
+			}
+			if w.Code != http.StatusTooManyRequests {
+				t.Errorf(statusErrMsg, http.StatusTooManyRequests, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), `"code":"`+tt.code+`"`) {
+				t.Errorf("Expected code %s, got %s", tt.code, w.Body.String())
+			}
+		})
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if respondEmailBudget(c, errors.New("connection refused")) {
+		t.Error("other errors must be left to the caller")
+	}
+}
+
+func TestMetricsAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"disabled", "", "Bearer anything", http.StatusNotFound},
+		{"missing token", "metrics-secret", "", http.StatusUnauthorized},
+		{"wrong token", "metrics-secret", "Bearer nope", http.StatusUnauthorized},
+		{"valid token", "metrics-secret", "Bearer metrics-secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/debug/vars", MetricsAuth(tt.token), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req, _ := http.NewRequest("GET", "/debug/vars", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf(statusErrMsg, tt.want, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"project/internal/emails"
+	"project/internal/i18n"
+)
+
+// EmailPreviewRequest selects the template to preview. Settings holds unsaved email.*
+// settings to try out on top of the company's saved ones.
+type EmailPreviewRequest struct {
+	Template string                     `json:"template" binding:"required"`
+	Locale   string                     `json:"locale"`
+	Settings map[string]json.RawMessage `json:"settings"`
+}
+
+// EmailPreviewResponse is a rendered email together with the sender it would go out with
+type EmailPreviewResponse struct {
+	Template    string `json:"template"`
+	Locale      string `json:"locale"`
+	FromAddress string `json:"from_address"`
+	FromName    string `json:"from_name,omitempty"`
+	ReplyTo     string `json:"reply_to,omitempty"`
+	Subject     string `json:"subject"`
+	HTML        string `json:"html"`
+	Text        string `json:"text"`
+}
+
+// Recipient of every preview
+const (
+	previewName    = "Jane Doe"
+	previewAddress = "jane.doe@example.com"
+)
+
+// sampleEmailData returns sample data for a template, or false if there is no such template
+func sampleEmailData(template, baseURL string, base emails.Base, settings companySettings) (any, bool) {
+	baseURL = strings.TrimRight(baseURL, "/")
+	companyName := base.Brand.Name
+	if companyName == "" {
+		companyName = "Example Company"
+	}
+	switch template {
+	case emails.OTP:
+		return emails.OTPData{
+			Base:       base,
+			Purpose:    emails.OTPLogin,
+			Code:       strings.Repeat("7", settings.Int("auth.otp_length")),
+			TTLMinutes: settings.Int("auth.otp_ttl_minutes"),
+		}, true
+	case emails.Invitation:
+		return emails.InvitationData{
+			Base:          base,
+			InviterName:   "John Smith",
+			CompanyName:   companyName,
+			AcceptURL:     baseURL + "/invitations/sample",
+			ExpiresInDays: 7,
+		}, true
+	case emails.EmailChanged:
+		return emails.EmailChangedData{
+			Base:       base,
+			NewEmail:   "jane.new@example.com",
+			RevertURL:  baseURL + "/v1/email/revert?token=sample",
+			RevertDays: int(emailChangeRevertTTL.Hours() / 24),
+		}, true
+	case emails.Notification:
+		return emails.NotificationData{
+			Base:        base,
+			Title:       "Sample notification",
+			Paragraphs:  []string{"This is how notifications from " + companyName + " look."},
+			ActionURL:   baseURL,
+			ActionLabel: "Open",
+		}, true
+	}
+	return nil, false
+}
+
+// PreviewEmail renders an email template with sample data and the company's branding,
+// optionally with unsaved branding settings applied (admin only)
+func (h *CompanyHandler) PreviewEmail(c *gin.Context) {
+	id, ok := h.settingsCompanyID(c)
+	if !ok {
+		return
+	}
+
+	var req EmailPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	if req.Locale != "" && !i18n.IsSupported(req.Locale) {
+		respondError(c, http.StatusBadRequest, "unsupported_locale", i18n.Supported())
+		return
+	}
+
+	saved, err := loadCompanySettings(c, h.App, id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "settings_load_failed")
+		return
+	}
+	// Never modify the cached settings
+	settings := maps.Clone(saved)
+	if settings == nil {
+		settings = companySettings{}
+	}
+	for key, raw := range req.Settings {
+		def, ok := settingsRegistry[key]
+		if !ok || !strings.HasPrefix(key, "email.") {
+			respondError(c, http.StatusBadRequest, "unknown_email_setting", key)
+			return
+		}
+		if string(raw) == "null" {
+			delete(settings, key)
+			continue
+		}
+		value, err := decodeSetting(def, raw)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid_setting", key, err)
+			return
+		}
+		if key == "email.from_address" && !senderAllowed(h.App.Cfg, value.(string)) {
+			respondError(c, http.StatusBadRequest, "sender_not_verified", value)
+			return
+		}
+		settings[key] = value
+	}
+
+	locale := req.Locale
+	if locale == "" {
+		locale = requestLocale(c)
+	}
+	base := emails.Base{Brand: emailBrand(settings), Name: previewName, Locale: locale}
+	data, ok := sampleEmailData(req.Template, h.App.Cfg.AppBaseURL, base, settings)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "unknown_email_template", req.Template)
+		return
+	}
+	msg, err := renderEmail(h.App.Cfg, settings, previewAddress, previewName, req.Template, data)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "email_render_failed")
+		return
+	}
+
+	from := msg.From
+	if from == "" {
+		from = h.App.Cfg.EmailFromAddress
+	}
+	c.JSON(http.StatusOK, gin.H{"data": EmailPreviewResponse{
+		Template:    req.Template,
+		Locale:      locale,
+		FromAddress: from,
+		FromName:    msg.FromName,
+		ReplyTo:     msg.ReplyTo,
+		Subject:     msg.Subject,
+		HTML:        msg.HTMLBody,
+		Text:        msg.TextBody,
+	}})
+}
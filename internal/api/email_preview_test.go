@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"project/internal/testutil"
+)
+
+func newPreviewRouter(t *testing.T, settings companySettings) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	app.Cfg.EmailFromAddress = "noreply@example.com"
+	app.Cfg.SenderDomains = []string{"acme.com"}
+	app.CacheSet("company_settings:7", settings, time.Minute)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("company_id", int32(7))
+		c.Set("user_id", int32(1))
+	})
+	router.POST("/v1/companies/:id/email-preview", NewCompanyHandler(app).PreviewEmail)
+	return router
+}
+
+func postPreview(router *gin.Engine, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/v1/companies/7/email-preview", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestPreviewEmailAppliesBranding(t *testing.T) {
+	saved := companySettings{
+		"email.brand_name":   "Acme",
+		"email.from_address": "hello@acme.com",
+		"email.from_name":    "Acme",
+	}
+	router := newPreviewRouter(t, saved)
+
+	recorder := postPreview(router, `{"template": "otp", "locale": "de", "settings": {"email.brand_color": "#123456", "email.reply_to": "help@acme.com"}}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf(statusErrMsg, http.StatusOK, recorder.Code)
+	}
+	var resp struct {
+		Data EmailPreviewResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	got := resp.Data
+	if got.FromAddress != "hello@acme.com" || got.FromName != "Acme" || got.ReplyTo != "help@acme.com" {
+		t.Errorf("Unexpected sender: %+v", got)
+	}
+	if got.Subject != "Ihr Einmalpasswort" || got.Locale != "de" {
+		t.Errorf("Expected the German OTP email, got %q in %q", got.Subject, got.Locale)
+	}
+	if !strings.Contains(got.HTML, "color: #123456") || !strings.Contains(got.HTML, "Acme-Verifizierung") {
+		t.Errorf("Expected branded HTML:\n%s", got.HTML)
+	}
+	if !strings.Contains(got.Text, "777777") {
+		t.Errorf("Expected sample code in the text part:\n%s", got.Text)
+	}
+	if _, ok := saved["email.reply_to"]; ok {
+		t.Error("Expected preview overrides to leave the saved settings untouched")
+	}
+}
+
+func TestPreviewEmailFallsBackToDefaultSender(t *testing.T) {
+	// A sender saved before its domain was removed from the verified list
+	router := newPreviewRouter(t, companySettings{"email.from_address": "hello@old-domain.com"})
+
+	recorder := postPreview(router, `{"template": "invitation"}`)
+	var resp struct {
+		Data EmailPreviewResponse `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &resp)
+	if resp.Data.FromAddress != "noreply@example.com" {
+		t.Errorf("Expected the default sender, got %q", resp.Data.FromAddress)
+	}
+}
+
+func TestPreviewEmailValidation(t *testing.T) {
+	router := newPreviewRouter(t, companySettings{})
+
+	tests := []struct {
+		name          string
+		body          string
+		expectedError string
+		expectedCode  string
+	}{
+		{"unknown template", `{"template": "welcome"}`, `unknown email template "welcome"`, "unknown_email_template"},
+		{"unsupported locale", `{"template": "otp", "locale": "xx"}`, "locale must be one of [en de es]", "unsupported_locale"},
+		{"non email setting", `{"template": "otp", "settings": {"auth.otp_length": 4}}`, `unknown email setting "auth.otp_length"`, "unknown_email_setting"},
+		{"invalid setting", `{"template": "otp", "settings": {"email.brand_color": "#zzzzzz"}}`, "email.brand_color has an invalid format", "invalid_setting"},
+		{"unverified sender", `{"template": "otp", "settings": {"email.from_address": "a@evil.com"}}`, "a@evil.com is not in a verified sender domain", "sender_not_verified"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := postPreview(router, tt.body)
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf(statusErrMsg, http.StatusBadRequest, recorder.Code)
+			}
+			var body map[string]string
+			json.Unmarshal(recorder.Body.Bytes(), &body)
+			if body["error"] != tt.expectedError {
+				t.Errorf("Expected error %q, got %q", tt.expectedError, body["error"])
+			}
+			if body["code"] != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, body["code"])
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/db/sqlc"
+)
+
+// maxWebhookBody bounds the size of a delivery webhook payload
+const maxWebhookBody = 1 << 20
+
+// EmailWebhookHandler receives the email provider's delivery status webhooks
+type EmailWebhookHandler struct {
+	App *core.App
+	// record stores one event; replaced in tests
+	record func(ctx context.Context, e core.DeliveryEvent) error
+}
+
+// NewEmailWebhookHandler creates a new EmailWebhookHandler instance
+func NewEmailWebhookHandler(app *core.App) *EmailWebhookHandler {
+	return &EmailWebhookHandler{App: app, record: app.RecordDeliveryEvent}
+}
+
+// ReceiveDeliveryEvents records the bounces, complaints and deliveries in a signed ZeptoMail
+// webhook. Failures return 500 so the provider retries; recording is idempotent.
+func (h *EmailWebhookHandler) ReceiveDeliveryEvents(c *gin.Context) {
+	if h.App.Cfg.WebhookSecret == "" {
+		respondError(c, http.StatusNotFound, "email_webhooks_not_configured")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBody))
+	if err != nil {
+		respondError(c, http.StatusRequestEntityTooLarge, "webhook_payload_too_large")
+		return
+	}
+	now := time.Now()
+	if err := core.VerifyWebhookSignature(h.App.Cfg.WebhookSecret, c.GetHeader("producer-signature"), body, now); err != nil {
+		respondError(c, http.StatusUnauthorized, "invalid_webhook_signature")
+		return
+	}
+
+	events, err := core.ParseZeptoMailWebhook(body, now)
+	if err != nil {
+		log.Printf("email webhook: %v", err)
+		respondError(c, http.StatusBadRequest, "invalid_webhook_payload")
+		return
+	}
+	for _, e := range events {
+		if err := h.record(c, e); err != nil {
+			log.Printf("email webhook: record %s for %s: %v", e.Status, e.Reference, err)
+			respondError(c, http.StatusInternalServerError, "delivery_event_record_failed")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"recorded": len(events)}})
+}
+
+// ClearEmailSuppression lets a company member receive email again after their address
+// bounced or complained, e.g. once their mailbox is fixed (admin only)
+func (h *UserHandler) ClearEmailSuppression(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	userID, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_user_id")
+		return
+	}
+
+	user, err := h.App.Queries.GetCompanyUser(c, &sqlc.GetCompanyUserParams{ID: userID, CompanyID: companyID.(int32)})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "user_not_in_company")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "user_fetch_failed")
+		return
+	}
+
+	n, err := h.App.Queries.DeleteEmailSuppression(c, core.NormalizeEmail(user.Email))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "email_suppression_clear_failed")
+		return
+	}
+	if n == 0 {
+		respondError(c, http.StatusNotFound, "email_not_suppressed")
+		return
+	}
+
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  companyID.(int32),
+		Action:     "email.suppression_cleared",
+		TargetType: "user",
+		TargetID:   userID,
+	})
+	c.Status(http.StatusNoContent)
+}
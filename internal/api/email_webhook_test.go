@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/testutil"
+)
+
+const webhookSecret = "webhook-secret"
+
+// newWebhookRouter returns a router whose webhook handler collects events instead of
+// storing them, failing with recordErr when set
+func newWebhookRouter(secret string, recordErr error) (*gin.Engine, *[]core.DeliveryEvent) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	app.Cfg.WebhookSecret = secret
+
+	var recorded []core.DeliveryEvent
+	h := NewEmailWebhookHandler(app)
+	h.record = func(ctx context.Context, e core.DeliveryEvent) error {
+		if recordErr != nil {
+			return recordErr
+		}
+		recorded = append(recorded, e)
+		return nil
+	}
+	router := gin.New()
+	router.POST("/v1/webhooks/email", h.ReceiveDeliveryEvents)
+	return router, &recorded
+}
+
+// replayWebhook posts a recorded ZeptoMail payload signed with secret
+func replayWebhook(t *testing.T, router *gin.Engine, file, secret string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("..", "testdata", "zeptomail", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", "/v1/webhooks/email", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("producer-signature", core.SignWebhook(secret, body, time.Now()))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestReceiveDeliveryEventsReplaysPayloads(t *testing.T) {
+	tests := []struct {
+		file      string
+		status    string
+		recipient string
+	}{
+		{"hardbounce.json", core.DeliveryHardBounce, "Jane.Doe@example.org"},
+		{"softbounce.json", core.DeliverySoftBounce, "john@example.net"},
+		{"feedbackloop.json", core.DeliveryComplaint, "spam.reporter@example.com"},
+		{"open.json", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			router, recorded := newWebhookRouter(webhookSecret, nil)
+			recorder := replayWebhook(t, router, tt.file, webhookSecret)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf(statusErrMsg, http.StatusOK, recorder.Code)
+			}
+			if tt.status == "" {
+				if len(*recorded) != 0 {
+					t.Errorf("expected no events, got %+v", *recorded)
+				}
+				return
+			}
+			if len(*recorded) != 1 {
+				t.Fatalf("expected 1 event, got %+v", *recorded)
+			}
+			if e := (*recorded)[0]; e.Status != tt.status || e.Recipient != tt.recipient {
+				t.Errorf("unexpected event %+v", e)
+			}
+		})
+	}
+}
+
+func TestReceiveDeliveryEventsRejectsBadSignatures(t *testing.T) {
+	router, recorded := newWebhookRouter(webhookSecret, nil)
+	recorder := replayWebhook(t, router, "hardbounce.json", "wrong-secret")
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf(statusErrMsg, http.StatusUnauthorized, recorder.Code)
+	}
+	if !strings.Contains(recorder.Body.String(), `"code":"invalid_webhook_signature"`) {
+		t.Errorf("Expected invalid_webhook_signature code, got %s", recorder.Body.String())
+	}
+	if len(*recorded) != 0 {
+		t.Errorf("expected no events to be recorded, got %+v", *recorded)
+	}
+}
+
+func TestReceiveDeliveryEventsDisabledWithoutSecret(t *testing.T) {
+	router, _ := newWebhookRouter("", nil)
+	recorder := replayWebhook(t, router, "hardbounce.json", "")
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf(statusErrMsg, http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestReceiveDeliveryEventsAsksForRetry(t *testing.T) {
+	router, _ := newWebhookRouter(webhookSecret, errors.New("connection refused"))
+	recorder := replayWebhook(t, router, "hardbounce.json", webhookSecret)
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf(statusErrMsg, http.StatusInternalServerError, recorder.Code)
+	}
+}
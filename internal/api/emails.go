@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/emails"
+)
+
+// emailBrand returns the email branding configured in a company's settings
+func emailBrand(settings companySettings) emails.Brand {
+	return emails.Brand{
+		Name:            settings.String("email.brand_name"),
+		Color:           settings.String("email.brand_color"),
+		HeaderColor:     settings.String("email.header_color"),
+		ButtonTextColor: settings.String("email.button_text_color"),
+		LogoURL:         settings.String("email.logo_url"),
+		Footer:          settings.String("email.footer_text"),
+	}
+}
+
+// renderEmail renders an email template into a message for one recipient, sent with the
+// sender identity configured in the company's settings
+func renderEmail(cfg core.Config, settings companySettings, to, toName, template string, data any) (core.EmailMessage, error) {
+	r, err := emails.Render(template, data)
+	if err != nil {
+		return core.EmailMessage{}, err
+	}
+	msg := core.EmailMessage{
+		To:       to,
+		ToName:   toName,
+		FromName: settings.String("email.from_name"),
+		ReplyTo:  settings.String("email.reply_to"),
+		Subject:  r.Subject,
+		HTMLBody: r.HTML,
+		TextBody: r.Text,
+	}
+	// A sender whose domain has since been removed from the verified list would bounce
+	if from := settings.String("email.from_address"); from != "" && cfg.SenderDomainVerified(from) {
+		msg.From = from
+	}
+	return msg, nil
+}
+
+// otpEmail renders the one-time password email in locale, branded with the company's settings
+func otpEmail(cfg core.Config, to, toName, locale, purpose, otp string, settings companySettings) (core.EmailMessage, error) {
+	return renderEmail(cfg, settings, to, toName, emails.OTP, emails.OTPData{
+		Base:       emails.Base{Brand: emailBrand(settings), Name: toName, Locale: locale},
+		Purpose:    purpose,
+		Code:       otp,
+		TTLMinutes: settings.Int("auth.otp_ttl_minutes"),
+	})
+}
+
+// senderAllowed reports whether a company may send from address; empty means the default sender
+func senderAllowed(cfg core.Config, address string) bool {
+	return address == "" || cfg.SenderDomainVerified(address)
+}
+
+// checkEmailAddress validates an optional bare email address setting
+func checkEmailAddress(s string) error {
+	if s == "" {
+		return nil
+	}
+	if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+		return fmt.Errorf("is not a valid email address")
+	}
+	return nil
+}
+
+// checkLogoURL validates an optional logo URL; emails only load images over HTTPS
+func checkLogoURL(s string) error {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("must be an https URL")
+	}
+	return nil
+}
+
+// checkHeaderText rejects line breaks in values that end up in email headers
+func checkHeaderText(s string) error {
+	if strings.ContainsAny(s, "\r\n") {
+		return fmt.Errorf("must not contain line breaks")
+	}
+	return nil
+}
+
+// respondEmailBudget writes a 429 response when err is an exhausted send budget, and
+// reports whether it did
+func respondEmailBudget(c *gin.Context, err error) bool {
+	var budgetErr *core.EmailBudgetError
+	if !errors.As(err, &budgetErr) {
+		return false
+	}
+	code := "email_budget_exhausted"
+	if budgetErr.Scope == core.EmailBudgetRecipient {
+		code = "email_recipient_throttled"
+	}
+	respondError(c, http.StatusTooManyRequests, code)
+	return true
+}
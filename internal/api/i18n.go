@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/i18n"
+)
+
+// userLocaleCacheTTL bounds how long a changed locale preference takes to apply on other
+// instances
+const userLocaleCacheTTL = 5 * time.Minute
+
+// apiError is an error with a stable code that clients can match on. Its message comes
+// from the i18n catalogs; Error returns the default-locale text.
+type apiError struct {
+	code string
+	args []any
+}
+
+func newAPIError(code string, args ...any) *apiError {
+	return &apiError{code: code, args: args}
+}
+
+func (e *apiError) Error() string {
+	return i18n.T(i18n.Default, e.code, e.args...)
+}
+
+// Localize middleware picks the locale of responses and emails for an authenticated
+// request: the user's saved preference, then Accept-Language, then the company default.
+// It must run after AuthRequired. Lookup failures only cost the preference, never the request.
+func Localize(app *core.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var preferred string
+		if userID, ok := c.Get("user_id"); ok {
+			preferred, _ = userLocale(c, app, userID.(int32))
+		}
+		var settings companySettings
+		if companyID, ok := c.Get("company_id"); ok {
+			settings, _ = loadCompanySettings(c, app, companyID.(int32))
+		}
+		c.Set("locale", resolveLocale(c, preferred, settings))
+		c.Next()
+	}
+}
+
+// resolveLocale picks the first supported of the user's preferred locale, the request's
+// Accept-Language and the company's default locale
+func resolveLocale(c *gin.Context, preferred string, settings companySettings) string {
+	return i18n.Resolve(preferred, i18n.Match(c.GetHeader("Accept-Language")), settings.String("i18n.default_locale"))
+}
+
+// requestLocale returns the locale chosen by Localize, or the best match for the
+// Accept-Language header on routes it does not cover
+func requestLocale(c *gin.Context) string {
+	if v, ok := c.Get("locale"); ok {
+		if locale, ok := v.(string); ok {
+			return locale
+		}
+	}
+	return i18n.Resolve(i18n.Match(c.GetHeader("Accept-Language")))
+}
+
+// userLocale returns the user's saved locale, "" when they have none. It is cached per user.
+func userLocale(ctx context.Context, app *core.App, userID int32) (string, error) {
+	cacheKey := fmt.Sprintf("user_locale:%d", userID)
+	if cached, ok := app.CacheGet(cacheKey); ok {
+		if locale, ok := cached.(string); ok {
+			return locale, nil
+		}
+	}
+	locale, err := app.Queries.GetUserLocale(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	app.CacheSet(cacheKey, locale.String, userLocaleCacheTTL)
+	return locale.String, nil
+}
+
+// setUserLocale refreshes the cached locale after the user changes it
+func setUserLocale(app *core.App, userID int32, locale string) {
+	app.CacheSet(fmt.Sprintf("user_locale:%d", userID), locale, userLocaleCacheTTL)
+}
+
+// localize returns the catalog message for key in the request's locale
+func localize(c *gin.Context, key string, args ...any) string {
+	return i18n.T(requestLocale(c), key, args...)
+}
+
+// errorBody is the JSON body of an error response: the stable code and its localized message
+func errorBody(c *gin.Context, code string, args ...any) gin.H {
+	return gin.H{"error": localize(c, code, args...), "code": code}
+}
+
+// respondError writes an error response for code in the request's locale
+func respondError(c *gin.Context, status int, code string, args ...any) {
+	c.JSON(status, errorBody(c, code, args...))
+}
+
+// abortError aborts the request with an error response for code in the request's locale
+func abortError(c *gin.Context, status int, code string, args ...any) {
+	c.AbortWithStatusJSON(status, errorBody(c, code, args...))
+}
+
+// respondErr writes err as an error response, localized when it carries a code
+func respondErr(c *gin.Context, status int, err error) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		respondError(c, status, apiErr.code, apiErr.args...)
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"project/internal/testutil"
+)
+
+func TestAuthRequiredLocalizesErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := createTestRouter("test-secret")
+
+	req, _ := http.NewRequest("GET", "/test", nil)
+	req.Header.Set("Accept-Language", "de-DE,de;q=0.9,en;q=0.5")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf(statusErrMsg, http.StatusUnauthorized, recorder.Code)
+	}
+	expected := `{"code":"missing_bearer_token","error":"Bearer-Token fehlt"}`
+	if recorder.Body.String() != expected {
+		t.Errorf("Expected body %s, got %s", expected, recorder.Body.String())
+	}
+}
+
+func TestLocalizeResolutionOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+
+	tests := []struct {
+		name           string
+		userLocale     string
+		acceptLanguage string
+		companyLocale  string
+		expected       string
+	}{
+		{"user preference wins", "es", "de", "de", "es"},
+		{"accept-language without preference", "", "de-AT", "es", "de"},
+		{"company default", "", "ja", "es", "es"},
+		{"unsupported preference", "pt-BR", "", "", "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setUserLocale(app, 123, tt.userLocale)
+			settings := companySettings{}
+			if tt.companyLocale != "" {
+				settings["i18n.default_locale"] = tt.companyLocale
+			}
+			app.CacheSet("company_settings:456", settings, time.Minute)
+
+			router := gin.New()
+			router.GET("/test", func(c *gin.Context) {
+				c.Set("user_id", int32(123))
+				c.Set("company_id", int32(456))
+			}, Localize(app), func(c *gin.Context) {
+				c.String(http.StatusOK, requestLocale(c))
+			})
+
+			req, _ := http.NewRequest("GET", "/test", nil)
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Body.String() != tt.expected {
+				t.Errorf("Expected locale %q, got %q", tt.expected, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestRespondErrLocalizesCodedErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		err      error
+		expected map[string]string
+	}{
+		{"coded", errVersionConflict, map[string]string{
+			"code":  "user_version_conflict",
+			"error": "otra persona modificó el usuario, recarga e inténtalo de nuevo",
+		}},
+		{"with arguments", validateName(strings.Repeat("a", 256)), map[string]string{
+			"code":  "name_too_long",
+			"error": "el nombre debe tener como máximo 255 caracteres",
+		}},
+		{"plain", errors.New("boom"), map[string]string{"error": "boom"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request, _ = http.NewRequest("GET", "/", nil)
+			c.Set("locale", "es")
+			respondErr(c, http.StatusConflict, tt.err)
+
+			var body map[string]string
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to decode body: %v", err)
+			}
+			if len(body) != len(tt.expected) {
+				t.Errorf("Expected body %v, got %v", tt.expected, body)
+			}
+			for k, v := range tt.expected {
+				if body[k] != v {
+					t.Errorf("Expected %s %q, got %q", k, v, body[k])
+				}
+			}
+		})
+	}
+}
+
+func TestCodedErrorsKeepEnglishText(t *testing.T) {
+	if errUserInCompany.Error() != "user already exists in this company" {
+		t.Errorf("Error() = %q", errUserInCompany.Error())
+	}
+	if err := validateName(" "); err == nil || err.Error() != "name cannot be empty" {
+		t.Errorf("validateName() = %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/i18n"
+	"project/internal/testutil"
+)
+
+func TestIPAllowed(t *testing.T) {
+	allowlist := []string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32"}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"192.0.2.7", true},
+		{"192.0.2.8", false},
+		{"::ffff:10.0.0.1", true},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"not-an-ip", false},
+	}
+
+	for _, tt := range tests {
+		if got := ipAllowed(allowlist, tt.ip); got != tt.want {
+			t.Errorf("ipAllowed(%q) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+	if !ipAllowed(nil, "203.0.113.1") {
+		t.Error("Expected an empty allowlist to allow any address")
+	}
+}
+
+func TestCheckAllowlistEntry(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32"} {
+		if err := checkAllowlistEntry(entry); err != nil {
+			t.Errorf("checkAllowlistEntry(%q) = %v, want nil", entry, err)
+		}
+	}
+	for _, entry := range []string{"", "10.0.0.0/33", "office"} {
+		if err := checkAllowlistEntry(entry); err == nil {
+			t.Errorf("checkAllowlistEntry(%q) = nil, want error", entry)
+		}
+	}
+}
+
+func TestIPAllowlistMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	app.CacheSet("company_settings:7", companySettings{"security.ip_allowlist": []string{"10.0.0.0/8"}}, time.Minute)
+
+	router := gin.New()
+	router.SetTrustedProxies([]string{"192.0.2.1"})
+	router.Use(func(c *gin.Context) {
+		c.Set("company_id", int32(7))
+		c.Set("user_id", int32(1))
+	}, IPAllowlist(app))
+	router.GET("/v1/users", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"message": "ok"}) })
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   string
+		expectedStatus int
+	}{
+		{"allowed address", "10.1.2.3:4000", "", http.StatusOK},
+		{"blocked address", "203.0.113.5:4000", "", http.StatusForbidden},
+		{"allowed via trusted proxy", "192.0.2.1:4000", "10.9.9.9", http.StatusOK},
+		{"spoofed header from untrusted peer", "203.0.113.5:4000", "10.9.9.9", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/v1/users", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.expectedStatus {
+				t.Errorf(statusErrMsg, tt.expectedStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestIPAllowlistAuditsBlockedAddressOnce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	audit := &core.MemoryAuditLog{}
+	app.Audit = audit
+	app.CacheSet("company_settings:7", companySettings{"security.ip_allowlist": []string{"10.0.0.0/8"}}, time.Minute)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("company_id", int32(7))
+		c.Set("user_id", int32(1))
+	}, IPAllowlist(app))
+	router.GET("/v1/users", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"message": "ok"}) })
+
+	for _, remoteAddr := range []string{"203.0.113.5:4000", "203.0.113.5:4001", "203.0.113.6:4000"} {
+		req, _ := http.NewRequest("GET", "/v1/users", nil)
+		req.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusForbidden {
+			t.Errorf(statusErrMsg, http.StatusForbidden, recorder.Code)
+		}
+		var body map[string]string
+		json.Unmarshal(recorder.Body.Bytes(), &body)
+		if body["code"] != "ip_not_allowed" || body["error"] != i18n.T("en", "ip_not_allowed") {
+			t.Errorf("Expected the localized ip_not_allowed error, got %v", body)
+		}
+	}
+
+	records := audit.Records()
+	if len(records) != 2 || records[0].IP != "203.0.113.5" || records[1].IP != "203.0.113.6" {
+		t.Fatalf("Expected one auth.ip_blocked event per address, got %+v", records)
+	}
+	if records[0].Action != "auth.ip_blocked" || records[0].CompanyID != 7 {
+		t.Errorf("Unexpected audit event %+v", records[0])
+	}
+}
+
+func TestUpdateSettingsPreventsIPLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	h := NewCompanyHandler(app)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("company_id", int32(7))
+		c.Set("user_id", int32(1))
+	})
+	router.PATCH("/v1/companies/:id/settings", h.UpdateSettings)
+
+	req, _ := http.NewRequest("PATCH", "/v1/companies/7/settings", strings.NewReader(`{"security.ip_allowlist": ["10.0.0.0/8"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "203.0.113.5:4000"
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusConflict {
+		t.Errorf(statusErrMsg, http.StatusConflict, recorder.Code)
+	}
+	if !strings.Contains(recorder.Body.String(), "ip_lockout") {
+		t.Errorf("Expected ip_lockout code, got %s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/db/sqlc"
+)
+
+// localePattern accepts BCP 47 style tags such as "en", "id" or "pt-BR"
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// ProfileResponse represents the authenticated user's own profile
+type ProfileResponse struct {
+	ID        int32  `json:"id"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	Timezone  string `json:"timezone"`
+	Locale    string `json:"locale"` // empty when the user has no preference
+	Phone     string `json:"phone"`  // verified E.164 number, empty when none
+	Version   int32  `json:"version"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// UpdateProfileRequest represents the request body for updating the own profile.
+// Nil fields are left unchanged and an empty locale clears the preference; Version must
+// match the stored user version.
+type UpdateProfileRequest struct {
+	Name     *string `json:"name"`
+	Timezone *string `json:"timezone"`
+	Locale   *string `json:"locale"`
+	Version  int32   `json:"version" binding:"required"`
+}
+
+// MeHandler handles self-service operations for the authenticated user
+type MeHandler struct {
+	App *core.App
+}
+
+// NewMeHandler creates a new MeHandler instance
+func NewMeHandler(app *core.App) *MeHandler {
+	return &MeHandler{App: app}
+}
+
+// GetMe returns the authenticated user's profile
+func (h *MeHandler) GetMe(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	profile, err := h.App.Queries.GetUserProfile(c, userID.(int32))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "user_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "profile_fetch_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": newProfileResponse(profile.ID, profile.Email, profile.Name,
+		profile.Timezone, profile.Locale.String, profile.Phone.String, profile.Version, profile.CreatedAt, profile.UpdatedAt)})
+}
+
+// UpdateMe updates the authenticated user's name, timezone and locale
+func (h *MeHandler) UpdateMe(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	if err := validateProfileUpdate(&req); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	params := &sqlc.UpdateUserProfileParams{
+		ID:      userID.(int32),
+		Version: req.Version,
+	}
+	if req.Name != nil {
+		params.Name = sql.NullString{String: strings.TrimSpace(*req.Name), Valid: true}
+	}
+	if req.Timezone != nil {
+		params.Timezone = sql.NullString{String: *req.Timezone, Valid: true}
+	}
+	if req.Locale != nil {
+		params.Locale = sql.NullString{String: *req.Locale, Valid: true}
+	}
+
+	updated, err := h.App.Queries.UpdateUserProfile(c, params)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusConflict, "profile_version_conflict")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "profile_update_failed")
+		return
+	}
+	setUserLocale(h.App, updated.ID, updated.Locale.String)
+
+	c.JSON(http.StatusOK, gin.H{"data": newProfileResponse(updated.ID, updated.Email, updated.Name,
+		updated.Timezone, updated.Locale.String, updated.Phone.String, updated.Version, updated.CreatedAt, updated.UpdatedAt)})
+}
+
+// SetDefaultCompany saves the company new sessions start in. A null company_id clears the
+// preference so logins fall back to the oldest membership.
+func (h *MeHandler) SetDefaultCompany(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req struct {
+		CompanyID *int32 `json:"company_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_body")
+		return
+	}
+
+	params := &sqlc.SetUserDefaultCompanyParams{ID: userID.(int32)}
+	var companyName *string
+	if req.CompanyID != nil {
+		companies, err := h.App.Queries.GetUserCompanies(c, userID.(int32))
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "companies_load_failed")
+			return
+		}
+		for _, comp := range companies {
+			if comp.CompanyID == *req.CompanyID {
+				name := comp.CompanyName
+				companyName = &name
+			}
+		}
+		if companyName == nil {
+			respondError(c, http.StatusForbidden, "company_access_denied")
+			return
+		}
+		params.DefaultCompanyID = sql.NullInt32{Int32: *req.CompanyID, Valid: true}
+	}
+
+	if err := h.App.Queries.SetUserDefaultCompany(c, params); err != nil {
+		respondError(c, http.StatusInternalServerError, "default_company_save_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"default_company_id":   req.CompanyID,
+		"default_company_name": companyName,
+	}})
+}
+
+// validateProfileUpdate checks the optional profile fields and returns an error if invalid
+func validateProfileUpdate(req *UpdateProfileRequest) error {
+	if req.Name != nil {
+		if err := validateName(*req.Name); err != nil {
+			return err
+		}
+	}
+	if req.Timezone != nil {
+		if *req.Timezone == "" || len(*req.Timezone) > 64 {
+			return newAPIError("invalid_timezone")
+		}
+		if _, err := time.LoadLocation(*req.Timezone); err != nil {
+			return newAPIError("invalid_timezone")
+		}
+	}
+	if req.Locale != nil && *req.Locale != "" && !localePattern.MatchString(*req.Locale) {
+		return newAPIError("invalid_locale")
+	}
+	return nil
+}
+
+func newProfileResponse(id int32, email, name, timezone, locale, phone string, version int32, createdAt, updatedAt sql.NullTime) ProfileResponse {
+	return ProfileResponse{
+		ID:        id,
+		Email:     email,
+		Name:      name,
+		Timezone:  timezone,
+		Locale:    locale,
+		Phone:     phone,
+		Version:   version,
+		CreatedAt: createdAt.Time.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt: updatedAt.Time.Format("2006-01-02T15:04:05Z"),
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"project/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestValidateProfileUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      UpdateProfileRequest
+		expected string
+	}{
+		{"empty update", UpdateProfileRequest{Version: 1}, ""},
+		{"valid fields", UpdateProfileRequest{Name: strPtr("Jane"), Timezone: strPtr("Asia/Jakarta"), Locale: strPtr("pt-BR"), Version: 1}, ""},
+		{"blank name", UpdateProfileRequest{Name: strPtr("   "), Version: 1}, "name cannot be empty"},
+		{"long name", UpdateProfileRequest{Name: strPtr(strings.Repeat("a", 256)), Version: 1}, "name must be at most 255 characters"},
+		{"unknown timezone", UpdateProfileRequest{Timezone: strPtr("Mars/Olympus"), Version: 1}, "invalid timezone"},
+		{"empty timezone", UpdateProfileRequest{Timezone: strPtr(""), Version: 1}, "invalid timezone"},
+		{"bad locale", UpdateProfileRequest{Locale: strPtr("english"), Version: 1}, "invalid locale"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if err := validateProfileUpdate(&tt.req); err != nil {
+				got = err.Error()
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseID(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int32
+		wantErr bool
+	}{
+		{"42", 42, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"abc", 0, true},
+		{"99999999999", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseID(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUpdateMeRequiresVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	app := testutil.CreateTestApp()
+	router := Build(app)
+
+	token, err := testutil.CreateValidJWTToken(app.Cfg.JWTSecret, 123, 456, false, "access")
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	// Sessions were never revoked; avoids a database lookup
+	app.CacheSet("sessions_revoked:123", time.Time{}, time.Minute)
+	app.CacheSet("company_settings:456", companySettings{}, time.Minute)
+
+	req, _ := http.NewRequest("PATCH", "/v1/me", strings.NewReader(`{"name":"Jane"}`))
+	req.Header.Set("Authorization", bearerPrefix+token)
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf(statusErrMsg, http.StatusBadRequest, recorder.Code)
+	}
+}
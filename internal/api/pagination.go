@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+)
+
+// Page size limits shared by list endpoints
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// pageCursor is the keyset position of the last row on a page.
+// Sort records the ordering the cursor was produced for so it cannot be reused with another.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int32  `json:"id"`
+}
+
+// encodeCursor serializes a cursor into an opaque URL-safe string
+func encodeCursor(cur pageCursor) string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor parses a cursor string and checks it belongs to the given sort
+func decodeCursor(s, sort string) (pageCursor, error) {
+	var cur pageCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cur, newAPIError("invalid_cursor")
+	}
+	if err := json.Unmarshal(b, &cur); err != nil || cur.ID <= 0 {
+		return cur, newAPIError("invalid_cursor")
+	}
+	if cur.Sort != sort {
+		return cur, newAPIError("cursor_sort_mismatch")
+	}
+	return cur, nil
+}
+
+// parseLimit parses the limit query parameter, applying the default and maximum
+func parseLimit(s string) (int32, error) {
+	if s == "" {
+		return defaultPageLimit, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, newAPIError("invalid_limit")
+	}
+	if n > maxPageLimit {
+		n = maxPageLimit
+	}
+	return int32(n), nil
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/db/sqlc"
+	"project/internal/emails"
+	"project/internal/i18n"
+)
+
+// otpChannelEmail is the default LoginRequest channel; the others are core.SMSChannel*
+const otpChannelEmail = "email"
+
+// phoneVerifyTTL is how long a phone verification code stays valid
+const phoneVerifyTTL = 15 * time.Minute
+
+// smsOTPText renders the text message carrying an OTP
+func smsOTPText(locale, otp string, ttlMinutes int) string {
+	return i18n.T(locale, "sms.otp", otp, ttlMinutes)
+}
+
+// maskPhone hides all but the country prefix and last digits of a phone number, for
+// responses to unauthenticated requests
+func maskPhone(phone string) string {
+	if len(phone) < 7 {
+		return strings.Repeat("*", len(phone))
+	}
+	return phone[:3] + strings.Repeat("*", len(phone)-6) + phone[len(phone)-3:]
+}
+
+// Daily text message budgets against SMS pumping: one user cannot send codes to many
+// numbers and one number does not receive codes for many users
+const (
+	smsDailyLimitPerUser  = 10
+	smsDailyLimitPerPhone = 10
+)
+
+// smsBudgetSpent counts a text message to phone for userID against the daily budgets and
+// reports whether one of them was already used up
+func smsBudgetSpent(app *core.App, userID int32, phone string) bool {
+	userKey := fmt.Sprintf("sms_daily:user:%d", userID)
+	phoneKey := "sms_daily:phone:" + phone
+	if n, ok := app.CacheGet(userKey); ok && n.(int) >= smsDailyLimitPerUser {
+		return true
+	}
+	if n, ok := app.CacheGet(phoneKey); ok && n.(int) >= smsDailyLimitPerPhone {
+		return true
+	}
+	for _, key := range []string{userKey, phoneKey} {
+		// The day starts with the first message
+		if app.Cache.Add(key, 1, 24*time.Hour) != nil {
+			app.Cache.IncrementInt(key, 1)
+		}
+	}
+	return false
+}
+
+// RequestPhoneVerification sends a verification code to a phone number by SMS or WhatsApp.
+// The number is only saved once the code is confirmed, and only shortly after a login.
+func (h *MeHandler) RequestPhoneVerification(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if !requireRecentLogin(c) {
+		return
+	}
+
+	var req struct {
+		Phone   string `json:"phone" binding:"required"`
+		Channel string `json:"channel" binding:"omitempty,oneof=sms whatsapp"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	phone := strings.TrimSpace(req.Phone)
+	if !core.ValidPhone(phone) {
+		respondError(c, http.StatusBadRequest, "invalid_phone")
+		return
+	}
+	channel := req.Channel
+	if channel == "" {
+		channel = core.SMSChannelSMS
+	}
+
+	cacheKey := fmt.Sprintf("phone_verify:%d", userID.(int32))
+
+	// Apply the same resend guard as login OTPs
+	if cachedData, exists := h.App.CacheGet(cacheKey); exists {
+		if verifyData, ok := cachedData.(map[string]interface{}); ok {
+			if lastSent, ok := verifyData["last_sent"].(time.Time); ok && time.Since(lastSent) < time.Minute {
+				body := errorBody(c, "otp_already_sent")
+				body["retry_after"] = int((time.Minute - time.Since(lastSent)).Seconds())
+				c.JSON(http.StatusTooManyRequests, body)
+				return
+			}
+		}
+	}
+	if smsBudgetSpent(h.App, userID.(int32), phone) {
+		respondError(c, http.StatusTooManyRequests, "sms_daily_limit")
+		return
+	}
+
+	otp := generateOTP(defaultOTPLength)
+	verifyData := map[string]interface{}{
+		"otp":       otp,
+		"phone":     phone,
+		"last_sent": time.Now(),
+	}
+	h.App.CacheSet(cacheKey, verifyData, phoneVerifyTTL)
+	resetOTPAttempts(h.App, cacheKey)
+
+	err := h.App.SMS.Send(c, core.SMSMessage{
+		To:      phone,
+		Channel: channel,
+		Body:    smsOTPText(requestLocale(c), otp, int(phoneVerifyTTL/time.Minute)),
+	})
+	if err != nil {
+		log.Printf("phone verification: send %s to user %d: %v", channel, userID.(int32), err)
+		h.App.Cache.Delete(cacheKey)
+		respondError(c, http.StatusInternalServerError, "otp_send_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": localize(c, "otp_sent_phone"),
+		"phone":   phone,
+	})
+}
+
+// ConfirmPhone verifies the code sent by RequestPhoneVerification, saves the number and
+// tells the account's email address about it
+func (h *MeHandler) ConfirmPhone(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req struct {
+		OTP string `json:"otp" binding:"required,len=6"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_body")
+		return
+	}
+
+	cacheKey := fmt.Sprintf("phone_verify:%d", userID.(int32))
+	cachedData, exists := h.App.CacheGet(cacheKey)
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "otp_not_found")
+		return
+	}
+	verifyData, ok := cachedData.(map[string]interface{})
+	if !ok {
+		respondError(c, http.StatusInternalServerError, "invalid_otp_data")
+		return
+	}
+	storedOTP, otpOk := verifyData["otp"].(string)
+	phone, phoneOk := verifyData["phone"].(string)
+	if !otpOk || !phoneOk || subtle.ConstantTimeCompare([]byte(storedOTP), []byte(req.OTP)) != 1 {
+		if otpAttemptFailed(h.App, cacheKey) {
+			respondError(c, http.StatusTooManyRequests, "otp_attempts_exceeded")
+			return
+		}
+		respondError(c, http.StatusUnauthorized, "invalid_otp")
+		return
+	}
+
+	var companyID int32
+	if v, ok := c.Get("company_id"); ok {
+		companyID = v.(int32)
+	}
+	settings, err := loadCompanySettings(c, h.App, companyID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "settings_load_failed")
+		return
+	}
+
+	// Save the number and queue the security notice together
+	var updated sqlc.SetUserPhoneRow
+	err = h.App.WithTx(c, func(tx *core.Tx) error {
+		var err error
+		updated, err = tx.SetUserPhone(c, &sqlc.SetUserPhoneParams{Phone: sql.NullString{String: phone, Valid: true}, ID: userID.(int32)})
+		if err != nil {
+			return err
+		}
+		notice, err := phoneAddedEmail(h.App.Cfg, settings, updated.Email, updated.Name, resolveLocale(c, updated.Locale.String, settings), phone)
+		if err != nil {
+			return err
+		}
+		// The owner must learn about a new login method even when the budget is used up
+		_, err = h.App.EnqueueEmail(c, tx.Queries, core.OutboxEmail{
+			CompanyID: companyID,
+			Essential: true,
+			Message:   notice,
+		})
+		return err
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "user_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "phone_update_failed")
+		return
+	}
+	h.App.Cache.Delete(cacheKey)
+	h.App.NotifyOutbox()
+
+	respondPhoneProfile(c, updated)
+}
+
+// RemovePhone removes the verified phone number, which disables SMS and WhatsApp logins
+func (h *MeHandler) RemovePhone(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	updated, err := h.App.Queries.SetUserPhone(c, &sqlc.SetUserPhoneParams{ID: userID.(int32)})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "user_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "phone_update_failed")
+		return
+	}
+
+	respondPhoneProfile(c, updated)
+}
+
+// respondPhoneProfile responds with the profile after its phone number changed
+func respondPhoneProfile(c *gin.Context, u sqlc.SetUserPhoneRow) {
+	c.JSON(http.StatusOK, gin.H{"data": newProfileResponse(u.ID, u.Email, u.Name,
+		u.Timezone, u.Locale.String, u.Phone.String, u.Version, u.CreatedAt, u.UpdatedAt)})
+}
+
+// phoneAddedEmail renders the notice sent to the account's address when a phone number
+// can newly receive login codes, branded with the company's settings
+func phoneAddedEmail(cfg core.Config, settings companySettings, to, name, locale, phone string) (core.EmailMessage, error) {
+	return renderEmail(cfg, settings, to, name, emails.Notification, emails.NotificationData{
+		Base:  emails.Base{Brand: emailBrand(settings), Name: name, Locale: locale},
+		Title: i18n.T(locale, "email.phone_added.title"),
+		Paragraphs: []string{
+			i18n.T(locale, "email.phone_added.body", maskPhone(phone)),
+			i18n.T(locale, "email.phone_added.ignore"),
+		},
+	})
+}
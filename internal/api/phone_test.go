@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/testutil"
+)
+
+func TestMaskPhone(t *testing.T) {
+	tests := map[string]string{
+		"+4915112345678": "+49********678",
+		"+1234567":       "+12**567",
+		"+12345":         "******",
+	}
+	for phone, want := range tests {
+		if got := maskPhone(phone); got != want {
+			t.Errorf("maskPhone(%q) = %q, want %q", phone, got, want)
+		}
+	}
+}
+
+func TestSMSOTPTextIsLocalized(t *testing.T) {
+	if got := smsOTPText("en", "482913", 10); !strings.HasPrefix(got, "482913 is your verification code") || !strings.Contains(got, "10 minutes") {
+		t.Errorf("unexpected English text %q", got)
+	}
+	if got := smsOTPText("de", "482913", 10); !strings.Contains(got, "10 Minuten") {
+		t.Errorf("unexpected German text %q", got)
+	}
+}
+
+func TestLoginRequestRejectsUnknownChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := Build(testutil.CreateTestApp())
+
+	req, _ := http.NewRequest("POST", "/v1/login/request", strings.NewReader(`{"email":"jane@example.com","channel":"pigeon"}`))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf(statusErrMsg, http.StatusBadRequest, recorder.Code)
+	}
+}
+
+// postAsUser posts body to path as user 123 of company 456, who logged in at authTime
+func postAsUser(t *testing.T, app *core.App, router *gin.Engine, path, body string, authTime time.Time) *httptest.ResponseRecorder {
+	t.Helper()
+	// Sessions were never revoked; avoids a database lookup
+	app.CacheSet("sessions_revoked:123", time.Time{}, time.Minute)
+	app.CacheSet("company_settings:456", companySettings{}, time.Minute)
+	token, err := (&AuthHandler{App: app}).createJWTToken(context.Background(), 123, 456, false, authTime, "access")
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Authorization", bearerPrefix+token)
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// requestPhoneVerification posts body to /v1/me/phone as user 123 right after a login
+func requestPhoneVerification(t *testing.T, app *core.App, router *gin.Engine, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	return postAsUser(t, app, router, "/v1/me/phone", body, time.Now())
+}
+
+func TestRequestPhoneVerification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	router := Build(app)
+
+	recorder := requestPhoneVerification(t, app, router, `{"phone":"+4915112345678","channel":"whatsapp"}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf(statusErrMsg, http.StatusOK, recorder.Code)
+	}
+	sent := app.SMS.(*core.MemorySMSSender).Messages()
+	if len(sent) != 1 || sent[0].To != "+4915112345678" || sent[0].Channel != core.SMSChannelWhatsApp {
+		t.Fatalf("unexpected messages %+v", sent)
+	}
+	cached, _ := app.CacheGet("phone_verify:123")
+	if otp := cached.(map[string]interface{})["otp"].(string); !strings.Contains(sent[0].Body, otp) {
+		t.Errorf("expected the code %s in %q", otp, sent[0].Body)
+	}
+
+	// Resending within a minute is refused
+	recorder = requestPhoneVerification(t, app, router, `{"phone":"+4915112345678"}`)
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf(statusErrMsg, http.StatusTooManyRequests, recorder.Code)
+	}
+}
+
+func TestRequestPhoneVerificationValidatesPhone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	router := Build(app)
+
+	for _, body := range []string{`{"phone":"0151 12345678"}`, `{"phone":"+4915112345678","channel":"fax"}`, `{}`} {
+		recorder := requestPhoneVerification(t, app, router, body)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: "+statusErrMsg, body, http.StatusBadRequest, recorder.Code)
+		}
+	}
+	if sent := app.SMS.(*core.MemorySMSSender).Messages(); len(sent) != 0 {
+		t.Errorf("expected no messages, got %+v", sent)
+	}
+}
+
+func TestRequestPhoneVerificationNeedsRecentLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	router := Build(app)
+
+	// A token refreshed long after the login cannot add a phone
+	recorder := postAsUser(t, app, router, "/v1/me/phone", `{"phone":"+4915112345678"}`, time.Now().Add(-time.Hour))
+	if recorder.Code != http.StatusForbidden || !strings.Contains(recorder.Body.String(), `"code":"reauthentication_required"`) {
+		t.Errorf("Expected reauthentication_required, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if sent := app.SMS.(*core.MemorySMSSender).Messages(); len(sent) != 0 {
+		t.Errorf("expected no messages, got %+v", sent)
+	}
+}
+
+func TestConfirmPhoneAttemptsAreLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	router := Build(app)
+	app.CacheSet("phone_verify:123", map[string]interface{}{"otp": "482913", "phone": "+4915112345678"}, phoneVerifyTTL)
+
+	for i := 1; i < maxOTPAttempts; i++ {
+		if recorder := postAsUser(t, app, router, "/v1/me/phone/confirm", `{"otp":"000000"}`, time.Now()); recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: "+statusErrMsg, i, http.StatusUnauthorized, recorder.Code)
+		}
+	}
+	if recorder := postAsUser(t, app, router, "/v1/me/phone/confirm", `{"otp":"000000"}`, time.Now()); recorder.Code != http.StatusTooManyRequests {
+		t.Errorf(statusErrMsg, http.StatusTooManyRequests, recorder.Code)
+	}
+	if _, ok := app.CacheGet("phone_verify:123"); ok {
+		t.Error("expected the code to be discarded")
+	}
+}
+
+func TestSMSBudgetSpent(t *testing.T) {
+	app := testutil.CreateTestApp()
+	for i := 0; i < smsDailyLimitPerUser; i++ {
+		if smsBudgetSpent(app, 1, fmt.Sprintf("+49151%08d", i)) {
+			t.Fatalf("message %d: expected budget left", i+1)
+		}
+	}
+	if !smsBudgetSpent(app, 1, "+4915199999999") {
+		t.Error("expected the user's daily budget to be used up")
+	}
+
+	for i := int32(2); i < smsDailyLimitPerPhone+1; i++ {
+		smsBudgetSpent(app, i, "+4915100000000")
+	}
+	if !smsBudgetSpent(app, 99, "+4915100000000") {
+		t.Error("expected the number's daily budget to be used up")
+	}
+}
+
+func TestPhoneAddedEmail(t *testing.T) {
+	settings := companySettings{"email.brand_color": "#a1b2c3", "email.from_name": "Acme Security"}
+	msg, err := phoneAddedEmail(core.Config{}, settings, "jane@example.com", "Jane", "en", "+4915112345678")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if msg.To != "jane@example.com" || msg.Subject != "Phone number added" {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+	if !strings.Contains(msg.TextBody, "+49********678") || strings.Contains(msg.TextBody, "+4915112345678") {
+		t.Errorf("Expected the masked number, got:\n%s", msg.TextBody)
+	}
+	if msg.FromName != "Acme Security" || !strings.Contains(msg.HTMLBody, "#a1b2c3") {
+		t.Errorf("Expected the company sender and brand, got from %q:\n%s", msg.FromName, msg.HTMLBody)
+	}
+}
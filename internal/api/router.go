@@ -1,18 +1,40 @@
 package api
 
 import (
+	"crypto/subtle"
+	"expvar"
+	"log"
 	"net/http"
+	"strings"
+
 	core "project/internal"
 
 	"github.com/gin-gonic/gin"
 )
 
+// MetricsAuth middleware guards the metrics endpoint with a static bearer token; without a
+// token configured the endpoint does not exist
+func MetricsAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			abortError(c, http.StatusUnauthorized, "invalid_metrics_token")
+			return
+		}
+		c.Next()
+	}
+}
+
 // AdminRequired middleware checks if the user has admin privileges
 func AdminRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		isAdmin, exists := c.Get("is_admin")
 		if !exists || !isAdmin.(bool) {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			abortError(c, http.StatusForbidden, "admin_required")
 			return
 		}
 		c.Next()
@@ -23,7 +45,13 @@ func Build(app *core.App) *gin.Engine {
 	r := gin.New()
 	r.Use(gin.Recovery(), gin.Logger())
 
+	// Only X-Forwarded-For from configured proxies counts towards the client IP
+	if err := r.SetTrustedProxies(app.Cfg.TrustedProxies); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	r.GET("/health", func(c *gin.Context) { c.JSON(200, gin.H{"status": "ok"}) })
+	r.GET("/debug/vars", MetricsAuth(app.Cfg.MetricsToken), gin.WrapH(expvar.Handler()))
 
 	// Auth routes
 	authH := &AuthHandler{App: app}
@@ -31,10 +59,54 @@ func Build(app *core.App) *gin.Engine {
 	r.POST("/v1/login", authH.Login)
 	r.POST("/v1/auth/refresh", authH.RefreshToken)
 
+	// Email change revert link (authenticated by the token it carries); the link opens a
+	// confirmation page and only its form reverts
+	meH := NewMeHandler(app)
+	r.GET("/v1/email/revert", meH.RevertEmailChangePage)
+	r.POST("/v1/email/revert", meH.RevertEmailChange)
+
+	// SCIM provisioning (authenticated by company SCIM tokens)
+	scimH := NewScimHandler(app)
+	registerScimRoutes(r, scimH)
+
+	// Email delivery status webhooks (authenticated by their signature)
+	webhookH := NewEmailWebhookHandler(app)
+	r.POST("/v1/webhooks/email", webhookH.ReceiveDeliveryEvents)
+
+	// Captured emails for local development
+	registerDevMailboxRoutes(r, app)
+
 	// Protected routes
-	auth := r.Group("/v1", AuthRequired(app.Cfg.JWTSecret))
+	auth := r.Group("/v1", AuthRequired(app.Cfg.JWTSecret), SessionNotRevoked(app), IPAllowlist(app), Localize(app))
 	{
 		auth.GET("/companies", authH.ListCompanies)
+		auth.POST("/auth/switch-company", authH.SwitchCompany)
+
+		// Subsidiary management for admins of the parent company
+		companyH := NewCompanyHandler(app)
+		subsidiaries := auth.Group("/companies/subsidiaries", AdminRequired())
+		{
+			subsidiaries.GET("", companyH.ListSubsidiaries)
+			subsidiaries.POST("", companyH.CreateSubsidiary)
+			subsidiaries.PATCH("/:id", companyH.UpdateSubsidiary)
+			subsidiaries.PUT("/:id", companyH.AttachSubsidiary)
+			subsidiaries.DELETE("/:id", companyH.DetachSubsidiary)
+		}
+
+		// Company settings for admins of the company or of a parent company
+		auth.GET("/companies/:id/settings", AdminRequired(), companyH.GetSettings)
+		auth.PATCH("/companies/:id/settings", AdminRequired(), companyH.UpdateSettings)
+		auth.POST("/companies/:id/email-preview", AdminRequired(), companyH.PreviewEmail)
+
+		// Self-service profile routes
+		auth.GET("/me", meH.GetMe)
+		auth.PATCH("/me", meH.UpdateMe)
+		auth.PUT("/me/default-company", meH.SetDefaultCompany)
+		auth.POST("/me/email", meH.RequestEmailChange)
+		auth.POST("/me/email/confirm", meH.ConfirmEmailChange)
+		auth.POST("/me/phone", meH.RequestPhoneVerification)
+		auth.POST("/me/phone/confirm", meH.ConfirmPhone)
+		auth.DELETE("/me/phone", meH.RemovePhone)
 
 		// User management routes (admin only)
 		userH := NewUserHandler(app)
@@ -42,7 +114,38 @@ func Build(app *core.App) *gin.Engine {
 		{
 			users.GET("", userH.ListUsers)
 			users.POST("", userH.CreateUser)
+			users.GET("/export", userH.ExportUsers)
+			users.POST("/import", userH.ImportUsers)
+			users.GET("/import/:job_id", userH.GetImportJob)
+			users.PATCH("/:id", userH.UpdateUser)
 			users.DELETE("/:id", userH.DeleteUser)
+			users.DELETE("/:id/email-suppression", userH.ClearEmailSuppression)
+		}
+
+		// Team routes
+		registerTeamRoutes(auth, NewTeamHandler(app))
+
+		// Audit log (admin only)
+		auditH := NewAuditHandler(app)
+		auth.GET("/audit-events", AdminRequired(), auditH.ListAuditEvents)
+		auth.GET("/audit-events/checkpoints", AdminRequired(), auditH.ExportAuditCheckpoints)
+
+		// Email outbox (admin only)
+		outboxH := NewEmailOutboxHandler(app)
+		outbox := auth.Group("/email-outbox", AdminRequired())
+		{
+			outbox.GET("", outboxH.ListOutboxEmails)
+			outbox.GET("/usage", outboxH.GetEmailUsage)
+			outbox.GET("/:id", outboxH.GetOutboxEmail)
+			outbox.POST("/:id/retry", outboxH.RetryOutboxEmail)
+		}
+
+		// SCIM token management (admin only)
+		scimTokens := auth.Group("/scim/tokens", AdminRequired())
+		{
+			scimTokens.GET("", scimH.ListTokens)
+			scimTokens.POST("", scimH.CreateToken)
+			scimTokens.DELETE("/:id", scimH.RevokeToken)
 		}
 	}
 	return r
@@ -195,6 +195,8 @@ func TestRouterConfiguration(t *testing.T) {
 		"/v1/login", 
 		"/v1/auth/refresh",
 		"/v1/companies",
+		"/v1/me",
+		"/v1/users/:id",
 	}
 
 	foundPaths := make(map[string]bool)
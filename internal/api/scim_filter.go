@@ -0,0 +1,249 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// scimFilter evaluates a parsed SCIM filter against a resource. The attribute lookup returns
+// every value the resource holds for a lower-cased attribute path (multi-valued attributes
+// such as emails.value may return several).
+type scimFilter func(attr func(path string) []string) bool
+
+// parseScimFilter parses the subset of RFC 7644 section 3.4.2.2 filters used by identity
+// providers: attribute comparisons (eq, ne, co, sw, ew, gt, ge, lt, le, pr) combined with
+// and, or, not() and parentheses.
+func parseScimFilter(s string) (scimFilter, error) {
+	tokens, err := tokenizeScimFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &scimFilterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in filter", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+type scimToken struct {
+	text   string
+	quoted bool
+}
+
+func tokenizeScimFilter(s string) ([]scimToken, error) {
+	var tokens []scimToken
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, scimToken{text: string(r)})
+			i++
+		case r == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string in filter")
+			}
+			i++
+			tokens = append(tokens, scimToken{text: b.String(), quoted: true})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+			tokens = append(tokens, scimToken{text: string(runes[start:i])})
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty filter")
+	}
+	return tokens, nil
+}
+
+type scimFilterParser struct {
+	tokens []scimToken
+	pos    int
+}
+
+func (p *scimFilterParser) peekKeyword(kw string) bool {
+	return p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, kw)
+}
+
+func (p *scimFilterParser) parseOr() (scimFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(attr func(string) []string) bool { return l(attr) || right(attr) }
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (scimFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(attr func(string) []string) bool { return l(attr) && right(attr) }
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseUnary() (scimFilter, error) {
+	if p.peekKeyword("not") {
+		p.pos++
+		if !p.peekKeyword("(") {
+			return nil, fmt.Errorf("expected ( after not")
+		}
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(attr func(string) []string) bool { return !inner(attr) }, nil
+	}
+	if p.peekKeyword("(") {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekKeyword(")") {
+			return nil, fmt.Errorf("missing ) in filter")
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *scimFilterParser) parseComparison() (scimFilter, error) {
+	if p.pos+1 >= len(p.tokens) {
+		return nil, fmt.Errorf("incomplete filter expression")
+	}
+	path := strings.ToLower(p.tokens[p.pos].text)
+	op := strings.ToLower(p.tokens[p.pos+1].text)
+	p.pos += 2
+
+	if op == "pr" {
+		return func(attr func(string) []string) bool {
+			for _, v := range attr(path) {
+				if v != "" {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("missing value for %s %s", path, op)
+	}
+	valueTok := p.tokens[p.pos]
+	p.pos++
+	value := valueTok.text
+	if !valueTok.quoted {
+		// true, false, null and numbers compare by their canonical lower-case form
+		value = strings.ToLower(value)
+	}
+
+	var match func(have string) bool
+	switch op {
+	case "eq":
+		match = func(have string) bool { return strings.EqualFold(have, value) }
+	case "ne":
+		match = func(have string) bool { return !strings.EqualFold(have, value) }
+	case "co":
+		match = func(have string) bool { return strings.Contains(strings.ToLower(have), strings.ToLower(value)) }
+	case "sw":
+		match = func(have string) bool { return strings.HasPrefix(strings.ToLower(have), strings.ToLower(value)) }
+	case "ew":
+		match = func(have string) bool { return strings.HasSuffix(strings.ToLower(have), strings.ToLower(value)) }
+	case "gt":
+		match = func(have string) bool { return have > value }
+	case "ge":
+		match = func(have string) bool { return have >= value }
+	case "lt":
+		match = func(have string) bool { return have < value }
+	case "le":
+		match = func(have string) bool { return have <= value }
+	default:
+		return nil, fmt.Errorf("unsupported filter operator %q", op)
+	}
+
+	return func(attr func(string) []string) bool {
+		values := attr(path)
+		if op == "ne" && len(values) == 0 {
+			return value != "null"
+		}
+		for _, v := range values {
+			if match(v) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// scimEqualityFilter recognises the lookups identity providers send before provisioning a
+// user (userName eq "x", externalId eq "x", or both joined by and), which the database can
+// answer from its indexes. ok is false for every other filter.
+func scimEqualityFilter(s string) (userName, externalID *string, ok bool) {
+	tokens, err := tokenizeScimFilter(s)
+	if err != nil {
+		return nil, nil, false
+	}
+	for i := 0; ; i += 4 {
+		if i+2 >= len(tokens) || tokens[i].quoted || tokens[i+1].quoted || !strings.EqualFold(tokens[i+1].text, "eq") || !tokens[i+2].quoted {
+			return nil, nil, false
+		}
+		value := tokens[i+2].text
+		switch strings.TrimPrefix(strings.ToLower(tokens[i].text), strings.ToLower(scimUserSchema)+":") {
+		case "username":
+			if userName != nil {
+				return nil, nil, false
+			}
+			userName = &value
+		case "externalid":
+			if externalID != nil {
+				return nil, nil, false
+			}
+			externalID = &value
+		default:
+			return nil, nil, false
+		}
+		if i+3 == len(tokens) {
+			return userName, externalID, true
+		}
+		if tokens[i+3].quoted || !strings.EqualFold(tokens[i+3].text, "and") {
+			return nil, nil, false
+		}
+	}
+}
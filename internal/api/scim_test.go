@@ -0,0 +1,669 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/db/sqlc"
+	"project/internal/testutil"
+)
+
+const testScimToken = "scim_test"
+
+type fakeScimUser struct {
+	id      int32
+	email   string
+	name    string
+	version int32
+}
+
+type fakeScimMembership struct {
+	isAdmin    bool
+	active     bool
+	externalID string
+}
+
+type fakeScimTeam struct {
+	id      int32
+	name    string
+	role    string
+	members map[int32]bool
+}
+
+// fakeScimStore is an in-memory scimStore for a single company (ID 1). Users in shared
+// also belong to another company; revoked records whose sessions were revoked. Handlers
+// built on it write their audit events to audit.
+type fakeScimStore struct {
+	users      map[int32]*fakeScimUser
+	members    map[int32]*fakeScimMembership
+	teams      map[int32]*fakeScimTeam
+	shared     map[int32]bool
+	revoked    map[int32]bool
+	nextID     int32
+	nextTeamID int32
+	audit      *core.MemoryAuditLog
+}
+
+func newFakeScimStore() *fakeScimStore {
+	return &fakeScimStore{
+		users:      map[int32]*fakeScimUser{},
+		members:    map[int32]*fakeScimMembership{},
+		teams:      map[int32]*fakeScimTeam{},
+		shared:     map[int32]bool{},
+		revoked:    map[int32]bool{},
+		nextID:     1,
+		nextTeamID: 1,
+		audit:      &core.MemoryAuditLog{},
+	}
+}
+
+func (f *fakeScimStore) GetUserByEmail(ctx context.Context, email string) (sqlc.GetUserByEmailRow, error) {
+	for _, u := range f.users {
+		if u.email == email {
+			return sqlc.GetUserByEmailRow{ID: u.id, Email: u.email, Name: u.name}, nil
+		}
+	}
+	return sqlc.GetUserByEmailRow{}, sql.ErrNoRows
+}
+
+func (f *fakeScimStore) CheckUserInCompany(ctx context.Context, arg *sqlc.CheckUserInCompanyParams) (bool, error) {
+	_, ok := f.members[arg.UserID]
+	return ok, nil
+}
+
+func (f *fakeScimStore) CreateUser(ctx context.Context, arg *sqlc.CreateUserParams) (sqlc.CreateUserRow, error) {
+	u := &fakeScimUser{id: f.nextID, email: arg.Email, name: arg.Name, version: 1}
+	f.users[u.id] = u
+	f.nextID++
+	return sqlc.CreateUserRow{ID: u.id, Email: u.email, Name: u.name}, nil
+}
+
+func (f *fakeScimStore) AddUserToCompany(ctx context.Context, arg *sqlc.AddUserToCompanyParams) error {
+	f.members[arg.UserID] = &fakeScimMembership{isAdmin: arg.IsAdmin.Bool, active: true}
+	return nil
+}
+
+func (f *fakeScimStore) GetScimTokenByHash(ctx context.Context, tokenHash string) (sqlc.GetScimTokenByHashRow, error) {
+	if tokenHash == hashToken(testScimToken) {
+		return sqlc.GetScimTokenByHashRow{ID: 1, CompanyID: 1}, nil
+	}
+	return sqlc.GetScimTokenByHashRow{}, sql.ErrNoRows
+}
+
+func (f *fakeScimStore) TouchScimToken(ctx context.Context, id int32) error { return nil }
+
+func (f *fakeScimStore) CreateScimToken(ctx context.Context, arg *sqlc.CreateScimTokenParams) (sqlc.CreateScimTokenRow, error) {
+	return sqlc.CreateScimTokenRow{ID: 2, Description: arg.Description}, nil
+}
+
+func (f *fakeScimStore) ListScimTokens(ctx context.Context, companyID int32) ([]sqlc.ListScimTokensRow, error) {
+	return nil, nil
+}
+
+func (f *fakeScimStore) RevokeScimToken(ctx context.Context, arg *sqlc.RevokeScimTokenParams) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeScimStore) row(id int32) sqlc.ListScimUsersRow {
+	u, m := f.users[id], f.members[id]
+	return sqlc.ListScimUsersRow{
+		ID: u.id, Email: u.email, Name: u.name, Version: u.version,
+		IsAdmin:    sql.NullBool{Bool: m.isAdmin, Valid: true},
+		Active:     m.active,
+		ExternalID: sql.NullString{String: m.externalID, Valid: m.externalID != ""},
+	}
+}
+
+func (f *fakeScimStore) ListScimUsers(ctx context.Context, companyID int32) ([]sqlc.ListScimUsersRow, error) {
+	var rows []sqlc.ListScimUsersRow
+	for id := int32(1); id < f.nextID; id++ {
+		if _, ok := f.members[id]; ok {
+			rows = append(rows, f.row(id))
+		}
+	}
+	return rows, nil
+}
+
+func (f *fakeScimStore) ListScimUsersPage(ctx context.Context, arg *sqlc.ListScimUsersPageParams) ([]sqlc.ListScimUsersPageRow, error) {
+	var rows []sqlc.ListScimUsersPageRow
+	skipped := int32(0)
+	for id := arg.AfterID + 1; id < f.nextID && int32(len(rows)) < arg.PageLimit; id++ {
+		if !f.matches(id, arg.Email, arg.ExternalID) {
+			continue
+		}
+		if skipped < arg.PageOffset {
+			skipped++
+			continue
+		}
+		rows = append(rows, sqlc.ListScimUsersPageRow(f.row(id)))
+	}
+	return rows, nil
+}
+
+func (f *fakeScimStore) CountScimUsers(ctx context.Context, arg *sqlc.CountScimUsersParams) (int64, error) {
+	var n int64
+	for id := int32(1); id < f.nextID; id++ {
+		if f.matches(id, arg.Email, arg.ExternalID) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// matches applies the optional userName and externalId conditions of the list queries
+func (f *fakeScimStore) matches(id int32, email, externalID sql.NullString) bool {
+	m, ok := f.members[id]
+	if !ok {
+		return false
+	}
+	if email.Valid && !strings.EqualFold(f.users[id].email, email.String) {
+		return false
+	}
+	return !externalID.Valid || m.externalID == externalID.String
+}
+
+func (f *fakeScimStore) GetScimUser(ctx context.Context, arg *sqlc.GetScimUserParams) (sqlc.GetScimUserRow, error) {
+	if _, ok := f.members[arg.ID]; !ok {
+		return sqlc.GetScimUserRow{}, sql.ErrNoRows
+	}
+	return sqlc.GetScimUserRow(f.row(arg.ID)), nil
+}
+
+func (f *fakeScimStore) SetScimMembership(ctx context.Context, arg *sqlc.SetScimMembershipParams) error {
+	m := f.members[arg.UserID]
+	m.active, m.externalID = arg.Active, arg.ExternalID.String
+	return nil
+}
+
+// RemoveUserFromCompany also drops the user's team memberships, like the query
+func (f *fakeScimStore) RemoveUserFromCompany(ctx context.Context, arg *sqlc.RemoveUserFromCompanyParams) (int64, error) {
+	if _, ok := f.members[arg.UserID]; !ok {
+		return 0, nil
+	}
+	delete(f.members, arg.UserID)
+	for _, t := range f.teams {
+		delete(t.members, arg.UserID)
+	}
+	return 1, nil
+}
+
+func (f *fakeScimStore) GetCompanyUser(ctx context.Context, arg *sqlc.GetCompanyUserParams) (sqlc.GetCompanyUserRow, error) {
+	m, ok := f.members[arg.ID]
+	if !ok {
+		return sqlc.GetCompanyUserRow{}, sql.ErrNoRows
+	}
+	u := f.users[arg.ID]
+	return sqlc.GetCompanyUserRow{ID: u.id, Email: u.email, Name: u.name, Version: u.version, IsAdmin: sql.NullBool{Bool: m.isAdmin, Valid: true}}, nil
+}
+
+func (f *fakeScimStore) UpdateUserProfile(ctx context.Context, arg *sqlc.UpdateUserProfileParams) (sqlc.UpdateUserProfileRow, error) {
+	u := f.users[arg.ID]
+	if u.version != arg.Version {
+		return sqlc.UpdateUserProfileRow{}, sql.ErrNoRows
+	}
+	if arg.Name.Valid {
+		u.name = arg.Name.String
+	}
+	u.version++
+	return sqlc.UpdateUserProfileRow{ID: u.id, Email: u.email, Name: u.name, Version: u.version}, nil
+}
+
+func (f *fakeScimStore) UserInOtherCompanies(ctx context.Context, arg *sqlc.UserInOtherCompaniesParams) (bool, error) {
+	return f.shared[arg.UserID], nil
+}
+
+func (f *fakeScimStore) RevokeUserSessions(ctx context.Context, id int32) error {
+	f.revoked[id] = true
+	return nil
+}
+
+func (f *fakeScimStore) SetUserCompanyAdmin(ctx context.Context, arg *sqlc.SetUserCompanyAdminParams) error {
+	f.members[arg.UserID].isAdmin = arg.IsAdmin.Bool
+	return nil
+}
+
+func (f *fakeScimStore) ListTeams(ctx context.Context, companyID int32) ([]sqlc.ListTeamsRow, error) {
+	var rows []sqlc.ListTeamsRow
+	for id := int32(1); id < f.nextTeamID; id++ {
+		if t, ok := f.teams[id]; ok {
+			rows = append(rows, sqlc.ListTeamsRow{ID: t.id, Name: t.name, Role: t.role, MemberCount: int64(len(t.members))})
+		}
+	}
+	return rows, nil
+}
+
+func (f *fakeScimStore) GetTeam(ctx context.Context, arg *sqlc.GetTeamParams) (sqlc.GetTeamRow, error) {
+	t, ok := f.teams[arg.ID]
+	if !ok {
+		return sqlc.GetTeamRow{}, sql.ErrNoRows
+	}
+	return sqlc.GetTeamRow{ID: t.id, Name: t.name, Role: t.role}, nil
+}
+
+func (f *fakeScimStore) CreateTeam(ctx context.Context, arg *sqlc.CreateTeamParams) (sqlc.CreateTeamRow, error) {
+	t := &fakeScimTeam{id: f.nextTeamID, name: arg.Name, role: arg.Role, members: map[int32]bool{}}
+	f.teams[t.id] = t
+	f.nextTeamID++
+	return sqlc.CreateTeamRow{ID: t.id, Name: t.name, Role: arg.Role}, nil
+}
+
+func (f *fakeScimStore) UpdateTeam(ctx context.Context, arg *sqlc.UpdateTeamParams) (sqlc.UpdateTeamRow, error) {
+	t, ok := f.teams[arg.ID]
+	if !ok {
+		return sqlc.UpdateTeamRow{}, sql.ErrNoRows
+	}
+	if arg.Name.Valid {
+		t.name = arg.Name.String
+	}
+	if arg.Role.Valid {
+		t.role = arg.Role.String
+	}
+	return sqlc.UpdateTeamRow{ID: t.id, Name: t.name, Role: t.role}, nil
+}
+
+func (f *fakeScimStore) DeleteTeam(ctx context.Context, arg *sqlc.DeleteTeamParams) (int64, error) {
+	if _, ok := f.teams[arg.ID]; !ok {
+		return 0, nil
+	}
+	delete(f.teams, arg.ID)
+	return 1, nil
+}
+
+func (f *fakeScimStore) ListTeamMembers(ctx context.Context, arg *sqlc.ListTeamMembersParams) ([]sqlc.ListTeamMembersRow, error) {
+	var rows []sqlc.ListTeamMembersRow
+	for id := range f.teams[arg.TeamID].members {
+		rows = append(rows, sqlc.ListTeamMembersRow{ID: id, Email: f.users[id].email, Name: f.users[id].name})
+	}
+	return rows, nil
+}
+
+func (f *fakeScimStore) AddTeamMember(ctx context.Context, arg *sqlc.AddTeamMemberParams) error {
+	f.teams[arg.TeamID].members[arg.UserID] = true
+	return nil
+}
+
+func (f *fakeScimStore) RemoveTeamMember(ctx context.Context, arg *sqlc.RemoveTeamMemberParams) (int64, error) {
+	if !f.teams[arg.TeamID].members[arg.UserID] {
+		return 0, nil
+	}
+	delete(f.teams[arg.TeamID].members, arg.UserID)
+	return 1, nil
+}
+
+// withTx runs fn directly; the fake store has no rollback
+func (f *fakeScimStore) withTx(ctx context.Context, fn func(store scimStore) error) error {
+	return fn(f)
+}
+
+func newScimTestRouter(store *fakeScimStore) *gin.Engine {
+	return newScimTestRouterWithSettings(store, companySettings{})
+}
+
+// newScimTestRouterWithSettings serves SCIM for company 1 configured with settings
+func newScimTestRouterWithSettings(store *fakeScimStore, settings companySettings) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	app.Audit = store.audit
+	app.CacheSet("company_settings:1", settings, time.Minute)
+	r := gin.New()
+	registerScimRoutes(r, &ScimHandler{App: app, store: store})
+	return r
+}
+
+func scimRequest(t *testing.T, r *gin.Engine, method, path, body string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testScimToken)
+	req.Header.Set("Content-Type", scimContentType)
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
+
+	var parsed map[string]any
+	if recorder.Body.Len() > 0 {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &parsed); err != nil {
+			t.Fatalf("Failed to parse response %q: %v", recorder.Body.String(), err)
+		}
+	}
+	return recorder, parsed
+}
+
+func TestScimRequiresToken(t *testing.T) {
+	r := newScimTestRouter(newFakeScimStore())
+
+	req := httptest.NewRequest("GET", "/scim/v2/Users", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+	if !strings.Contains(recorder.Body.String(), scimErrorSchema) {
+		t.Errorf("Expected SCIM error schema, got %s", recorder.Body.String())
+	}
+}
+
+func TestScimHonoursIPAllowlist(t *testing.T) {
+	store := newFakeScimStore()
+	r := newScimTestRouterWithSettings(store, companySettings{"security.ip_allowlist": []string{"10.0.0.0/8"}})
+
+	rec, body := scimRequest(t, r, "POST", "/scim/v2/Users", `{"userName": "jane@example.com"}`)
+	if rec.Code != http.StatusForbidden || body["code"] != "ip_not_allowed" {
+		t.Errorf("Expected ip_not_allowed, got %d: %v", rec.Code, body)
+	}
+	if len(store.users) != 0 {
+		t.Error("Expected no user to be created")
+	}
+}
+
+func TestScimUserLifecycle(t *testing.T) {
+	store := newFakeScimStore()
+	r := newScimTestRouter(store)
+
+	// Create
+	rec, body := scimRequest(t, r, "POST", "/scim/v2/Users", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "Alice@Example.com",
+		"name": {"givenName": "Alice", "familyName": "Smith"},
+		"externalId": "ext-1",
+		"active": true
+	}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	if body["userName"] != "alice@example.com" || body["displayName"] != "Alice Smith" || body["externalId"] != "ext-1" {
+		t.Errorf("Unexpected created resource: %v", body)
+	}
+	if rec.Header().Get("Location") == "" || !strings.HasPrefix(rec.Header().Get("Content-Type"), scimContentType) {
+		t.Errorf("Expected Location and SCIM content type headers, got %v", rec.Header())
+	}
+	id := body["id"].(string)
+
+	// Duplicate userName conflicts
+	rec, body = scimRequest(t, r, "POST", "/scim/v2/Users", `{"userName": "alice@example.com"}`)
+	if rec.Code != http.StatusConflict || body["scimType"] != "uniqueness" {
+		t.Errorf("Expected uniqueness conflict, got %d: %v", rec.Code, body)
+	}
+
+	// Filter by userName
+	rec, body = scimRequest(t, r, "GET", `/scim/v2/Users?filter=userName%20eq%20%22ALICE@example.com%22`, "")
+	if rec.Code != http.StatusOK || body["totalResults"] != float64(1) {
+		t.Errorf("Expected one filtered result, got %d: %v", rec.Code, body)
+	}
+	rec, body = scimRequest(t, r, "GET", `/scim/v2/Users?filter=externalId%20eq%20%22other%22`, "")
+	if rec.Code != http.StatusOK || body["totalResults"] != float64(0) {
+		t.Errorf("Expected no results, got %d: %v", rec.Code, body)
+	}
+
+	// Azure-style PATCH with string boolean and no path
+	rec, body = scimRequest(t, r, "PATCH", "/scim/v2/Users/"+id, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "Replace", "path": "active", "value": "False"},
+			{"op": "replace", "value": {"displayName": "Alice S."}}
+		]
+	}`)
+	if rec.Code != http.StatusOK || body["active"] != false || body["displayName"] != "Alice S." {
+		t.Errorf("Expected deactivated and renamed user, got %d: %v", rec.Code, body)
+	}
+
+	// PUT with a stale If-Match
+	req := httptest.NewRequest("PUT", "/scim/v2/Users/"+id, strings.NewReader(`{"userName": "alice@example.com", "active": true}`))
+	req.Header.Set("Authorization", "Bearer "+testScimToken)
+	req.Header.Set("If-Match", `W/"1"`)
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status %d, got %d", http.StatusPreconditionFailed, recorder.Code)
+	}
+
+	// Delete removes the membership only
+	rec, _ = scimRequest(t, r, "DELETE", "/scim/v2/Users/"+id, "")
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	if len(store.users) != 1 {
+		t.Error("Expected the user account to be kept")
+	}
+	rec, _ = scimRequest(t, r, "GET", "/scim/v2/Users/"+id, "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestScimCannotTakeOverAccounts(t *testing.T) {
+	store := newFakeScimStore()
+	r := newScimTestRouter(store)
+	scimRequest(t, r, "POST", "/scim/v2/Users", `{"userName": "alice@example.com", "displayName": "Alice"}`)
+
+	// The login email belongs to the user, not to any one company's identity provider
+	rec, body := scimRequest(t, r, "PUT", "/scim/v2/Users/1", `{"userName": "mallory@example.com"}`)
+	if rec.Code != http.StatusBadRequest || body["scimType"] != "mutability" {
+		t.Errorf("Expected mutability error, got %d: %v", rec.Code, body)
+	}
+	if store.users[1].email != "alice@example.com" {
+		t.Errorf("Expected the email to be kept, got %s", store.users[1].email)
+	}
+
+	// Accounts shared with another company keep their name; the membership still changes
+	store.shared[1] = true
+	rec, body = scimRequest(t, r, "PUT", "/scim/v2/Users/1", `{"userName": "alice@example.com", "displayName": "Mallory", "externalId": "ext-9"}`)
+	if rec.Code != http.StatusOK || body["displayName"] != "Alice" || body["externalId"] != "ext-9" {
+		t.Errorf("Expected the name kept and the membership updated, got %d: %v", rec.Code, body)
+	}
+
+	store.shared[1] = false
+	rec, body = scimRequest(t, r, "PUT", "/scim/v2/Users/1", `{"userName": "alice@example.com", "displayName": "Alice Smith"}`)
+	if rec.Code != http.StatusOK || body["displayName"] != "Alice Smith" {
+		t.Errorf("Expected the name of an unshared account to change, got %d: %v", rec.Code, body)
+	}
+}
+
+func TestScimDeprovisioningRevokesSessions(t *testing.T) {
+	store := newFakeScimStore()
+	r := newScimTestRouter(store)
+	scimRequest(t, r, "POST", "/scim/v2/Users", `{"userName": "a@example.com"}`)
+	scimRequest(t, r, "POST", "/scim/v2/Users", `{"userName": "b@example.com"}`)
+
+	rec, _ := scimRequest(t, r, "PATCH", "/scim/v2/Users/1", `{"Operations": [{"op": "replace", "path": "displayName", "value": "A"}]}`)
+	if rec.Code != http.StatusOK || store.revoked[1] {
+		t.Errorf("Expected a rename to keep sessions, got %d", rec.Code)
+	}
+	rec, _ = scimRequest(t, r, "PATCH", "/scim/v2/Users/1", `{"Operations": [{"op": "replace", "path": "active", "value": false}]}`)
+	if rec.Code != http.StatusOK || !store.revoked[1] {
+		t.Errorf("Expected deactivation to revoke sessions, got %d", rec.Code)
+	}
+	rec, _ = scimRequest(t, r, "DELETE", "/scim/v2/Users/2", "")
+	if rec.Code != http.StatusNoContent || !store.revoked[2] {
+		t.Errorf("Expected deletion to revoke sessions, got %d", rec.Code)
+	}
+}
+
+func TestScimListUsersPaging(t *testing.T) {
+	store := newFakeScimStore()
+	r := newScimTestRouter(store)
+	for _, email := range []string{"a@example.com", "b1@example.com", "b2@example.com", "b3@example.com"} {
+		scimRequest(t, r, "POST", "/scim/v2/Users", `{"userName": "`+email+`"}`)
+	}
+
+	rec, body := scimRequest(t, r, "GET", "/scim/v2/Users?startIndex=2&count=2", "")
+	resources := body["Resources"].([]any)
+	if rec.Code != http.StatusOK || body["totalResults"] != float64(4) || len(resources) != 2 || resources[0].(map[string]any)["id"] != "2" {
+		t.Errorf("Expected users 2 and 3 of 4, got %d: %v", rec.Code, body)
+	}
+
+	// Filters the database cannot answer are paged the same way
+	rec, body = scimRequest(t, r, "GET", `/scim/v2/Users?filter=userName%20sw%20%22b%22&startIndex=3&count=5`, "")
+	resources = body["Resources"].([]any)
+	if rec.Code != http.StatusOK || body["totalResults"] != float64(3) || len(resources) != 1 || resources[0].(map[string]any)["userName"] != "b3@example.com" {
+		t.Errorf("Expected the last of three matches, got %d: %v", rec.Code, body)
+	}
+}
+
+func TestScimEqualityFilter(t *testing.T) {
+	userName, externalID, ok := scimEqualityFilter(`userName eq "a@example.com" and externalId eq "ext-1"`)
+	if !ok || *userName != "a@example.com" || *externalID != "ext-1" {
+		t.Errorf("Expected both lookups, got %v %v %v", userName, externalID, ok)
+	}
+	if _, externalID, ok := scimEqualityFilter(`urn:ietf:params:scim:schemas:core:2.0:User:externalId EQ "x"`); !ok || *externalID != "x" {
+		t.Errorf("Expected the externalId lookup, got %v %v", externalID, ok)
+	}
+	for _, f := range []string{`userName co "a"`, `userName eq "a" or externalId eq "b"`, `displayName eq "a"`, `userName eq "a" and userName eq "b"`, `userName eq "a" and`} {
+		if _, _, ok := scimEqualityFilter(f); ok {
+			t.Errorf("Expected %q to be evaluated in memory", f)
+		}
+	}
+}
+
+func TestScimAdminsGroupMembership(t *testing.T) {
+	store := newFakeScimStore()
+	r := newScimTestRouter(store)
+	scimRequest(t, r, "POST", "/scim/v2/Users", `{"userName": "a@example.com"}`)
+	scimRequest(t, r, "POST", "/scim/v2/Users", `{"userName": "b@example.com"}`)
+
+	rec, body := scimRequest(t, r, "PATCH", "/scim/v2/Groups/admins", `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "add", "path": "members", "value": [{"value": "1"}, {"value": "2"}]}]
+	}`)
+	if rec.Code != http.StatusOK || len(body["members"].([]any)) != 2 {
+		t.Fatalf("Expected two admins, got %d: %v", rec.Code, body)
+	}
+
+	rec, body = scimRequest(t, r, "PATCH", "/scim/v2/Groups/admins", `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "remove", "path": "members[value eq \"1\"]"}]
+	}`)
+	if rec.Code != http.StatusOK || len(body["members"].([]any)) != 1 || store.members[1].isAdmin {
+		t.Errorf("Expected user 1 removed from admins, got %d: %v", rec.Code, body)
+	}
+
+	rec, body = scimRequest(t, r, "DELETE", "/scim/v2/Groups/admins", "")
+	if rec.Code != http.StatusBadRequest || body["scimType"] != "mutability" {
+		t.Errorf("Expected mutability error, got %d: %v", rec.Code, body)
+	}
+}
+
+func TestScimTeamGroups(t *testing.T) {
+	store := newFakeScimStore()
+	r := newScimTestRouter(store)
+	scimRequest(t, r, "POST", "/scim/v2/Users", `{"userName": "a@example.com"}`)
+	scimRequest(t, r, "POST", "/scim/v2/Users", `{"userName": "b@example.com"}`)
+
+	rec, body := scimRequest(t, r, "POST", "/scim/v2/Groups", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"],
+		"displayName": "Engineering",
+		"members": [{"value": "1"}, {"value": "99"}]
+	}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	id := body["id"].(string)
+	if len(body["members"].([]any)) != 1 {
+		t.Errorf("Expected unknown users to be ignored, got %v", body["members"])
+	}
+
+	rec, body = scimRequest(t, r, "PATCH", "/scim/v2/Groups/"+id, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "replace", "path": "displayName", "value": "Platform"},
+			{"op": "replace", "path": "members", "value": [{"value": "2"}]}
+		]
+	}`)
+	if rec.Code != http.StatusOK || body["displayName"] != "Platform" {
+		t.Fatalf("Expected renamed group, got %d: %v", rec.Code, body)
+	}
+	team := store.teams[1]
+	if team.members[1] || !team.members[2] {
+		t.Errorf("Expected members replaced with user 2, got %v", team.members)
+	}
+
+	rec, body = scimRequest(t, r, "GET", `/scim/v2/Groups?filter=displayName%20eq%20%22platform%22`, "")
+	if rec.Code != http.StatusOK || body["totalResults"] != float64(1) {
+		t.Errorf("Expected one filtered group, got %d: %v", rec.Code, body)
+	}
+
+	rec, _ = scimRequest(t, r, "DELETE", "/scim/v2/Groups/"+id, "")
+	if rec.Code != http.StatusNoContent || len(store.teams) != 0 {
+		t.Errorf("Expected team deleted, got %d", rec.Code)
+	}
+}
+
+func TestScimWritesAreAudited(t *testing.T) {
+	store := newFakeScimStore()
+	r := newScimTestRouter(store)
+
+	scimRequest(t, r, "POST", "/scim/v2/Users", `{"userName": "a@example.com", "externalId": "ext-a"}`)
+	scimRequest(t, r, "PATCH", "/scim/v2/Users/1", `{"Operations": [{"op": "replace", "path": "active", "value": false}]}`)
+	scimRequest(t, r, "PATCH", "/scim/v2/Groups/admins", `{"Operations": [{"op": "add", "path": "members", "value": [{"value": "1"}]}]}`)
+	scimRequest(t, r, "POST", "/scim/v2/Groups", `{"displayName": "Engineering", "members": [{"value": "1"}]}`)
+	scimRequest(t, r, "PATCH", "/scim/v2/Groups/1", `{"Operations": [{"op": "replace", "path": "displayName", "value": "Platform"}]}`)
+	scimRequest(t, r, "DELETE", "/scim/v2/Groups/1", "")
+	scimRequest(t, r, "DELETE", "/scim/v2/Users/1", "")
+
+	want := []string{
+		"user.created", "user.deactivated", "user.updated", "team.created", "team.member_added",
+		"team.updated", "team.deleted", "user.removed_from_company",
+	}
+	if got := store.audit.Actions(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("Expected audit actions %v, got %v", want, got)
+	}
+	for _, r := range store.audit.Records() {
+		if r.ActorType != auditActorSCIM || r.ActorUserID != 0 || r.CompanyID != 1 {
+			t.Errorf("Expected a SCIM event for company 1, got %+v", r)
+		}
+	}
+
+	records := store.audit.Records()
+	if !strings.Contains(string(records[1].Before), `"active":true`) || !strings.Contains(string(records[1].After), `"active":false`) {
+		t.Errorf("Expected the deactivation before and after, got %s -> %s", records[1].Before, records[1].After)
+	}
+	if records[2].TargetID != 1 || string(records[2].After) != `{"is_admin":true}` {
+		t.Errorf("Expected the admin grant of user 1, got %+v", records[2])
+	}
+}
+
+func TestParseScimFilter(t *testing.T) {
+	attrs := map[string][]string{
+		"username":     {"alice@example.com"},
+		"active":       {"true"},
+		"emails.value": {"alice@example.com", "a@work.example"},
+	}
+	lookup := func(path string) []string { return attrs[path] }
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "ALICE@example.com"`, true},
+		{`userName ne "alice@example.com"`, false},
+		{`emails.value ew "@work.example"`, true},
+		{`userName sw "bob" or active eq true`, true},
+		{`userName co "alice" and not (active eq true)`, false},
+		{`externalId pr`, false},
+		{`(userName eq "x" or userName eq "alice@example.com") and active eq TRUE`, true},
+	}
+	for _, tt := range tests {
+		f, err := parseScimFilter(tt.filter)
+		if err != nil {
+			t.Errorf("parseScimFilter(%q) returned error: %v", tt.filter, err)
+			continue
+		}
+		if got := f(lookup); got != tt.want {
+			t.Errorf("parseScimFilter(%q) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{``, `userName eq`, `userName zz "a"`, `(userName eq "a"`, `userName eq "a`} {
+		if _, err := parseScimFilter(bad); err == nil {
+			t.Errorf("Expected error for filter %q", bad)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/db/sqlc"
+	"project/internal/i18n"
+)
+
+// settingsCacheTTL bounds how long a company's settings are served from memory
+const settingsCacheTTL = 5 * time.Minute
+
+// defaultOTPLength is the OTP length used when a company has not configured one
+const defaultOTPLength = 6
+
+// Login methods a company can allow
+const (
+	loginMethodEmailOTP = "email_otp"
+	loginMethodSMSOTP   = "sms_otp" // OTPs by SMS or WhatsApp to the user's verified phone
+)
+
+// settingType is the JSON type a company setting holds
+type settingType string
+
+const (
+	settingInt        settingType = "integer"
+	settingBool       settingType = "boolean"
+	settingString     settingType = "string"
+	settingStringList settingType = "string_list"
+)
+
+// settingDef describes a company setting: its type, default and the values it accepts.
+// Min and Max bound integers, or the length of strings and lists.
+type settingDef struct {
+	Type        settingType
+	Default     any
+	Min, Max    int
+	Allowed     []string
+	Pattern     *regexp.Regexp
+	Check       func(string) error // extra validation of strings and list items
+	Description string
+}
+
+// colorPattern matches #rrggbb colors
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// settingsRegistry lists every company setting; keys outside it are rejected
+var settingsRegistry = map[string]settingDef{
+	"auth.otp_length": {
+		Type: settingInt, Default: defaultOTPLength, Min: 4, Max: 10,
+		Description: "Number of digits in login OTP codes",
+	},
+	"auth.otp_ttl_minutes": {
+		Type: settingInt, Default: 15, Min: 1, Max: 60,
+		Description: "Minutes a login OTP code stays valid",
+	},
+	"auth.access_token_hours": {
+		Type: settingInt, Default: 24, Min: 1, Max: 168,
+		Description: "Lifetime of access tokens in hours",
+	},
+	"auth.refresh_token_days": {
+		Type: settingInt, Default: 7, Min: 1, Max: 90,
+		Description: "Lifetime of refresh tokens in days",
+	},
+	"auth.login_methods": {
+		Type: settingStringList, Default: []string{loginMethodEmailOTP}, Min: 1, Max: 2,
+		Allowed:     []string{loginMethodEmailOTP, loginMethodSMSOTP},
+		Description: "Login methods members of the company may use",
+	},
+	"security.ip_allowlist": {
+		Type: settingStringList, Default: []string{}, Min: 0, Max: 100,
+		Check:       checkAllowlistEntry,
+		Description: "IP addresses or CIDR ranges allowed to use the API; empty allows any",
+	},
+	"email.brand_name": {
+		Type: settingString, Default: "", Min: 0, Max: 100,
+		Description: "Name shown in the heading of emails sent to members",
+	},
+	"email.brand_color": {
+		Type: settingString, Default: "#007bff", Min: 7, Max: 7,
+		Pattern:     colorPattern,
+		Description: "Accent color of emails sent to members, as #rrggbb",
+	},
+	"email.header_color": {
+		Type: settingString, Default: "#f8f9fa", Min: 7, Max: 7,
+		Pattern:     colorPattern,
+		Description: "Background color of the email heading, as #rrggbb",
+	},
+	"email.button_text_color": {
+		Type: settingString, Default: "#ffffff", Min: 7, Max: 7,
+		Pattern:     colorPattern,
+		Description: "Text color of email buttons, as #rrggbb",
+	},
+	"email.logo_url": {
+		Type: settingString, Default: "", Min: 0, Max: 500,
+		Check:       checkLogoURL,
+		Description: "HTTPS URL of the logo shown at the top of emails; empty shows none",
+	},
+	"email.footer_text": {
+		Type: settingString, Default: "", Min: 0, Max: 500,
+		Description: "Footer of emails sent to members; empty uses the default notice",
+	},
+	"email.from_name": {
+		Type: settingString, Default: "", Min: 0, Max: 100,
+		Check:       checkHeaderText,
+		Description: "Sender name of emails sent to members",
+	},
+	"email.from_address": {
+		Type: settingString, Default: "", Min: 0, Max: 254,
+		Check:       checkEmailAddress,
+		Description: "Sender address of emails sent to members, in a verified sender domain; empty uses the default sender",
+	},
+	"email.reply_to": {
+		Type: settingString, Default: "", Min: 0, Max: 254,
+		Check:       checkEmailAddress,
+		Description: "Address replies to emails sent to members go to; empty sets none",
+	},
+	"email.hourly_limit": {
+		Type: settingInt, Default: 200, Min: 1, Max: 10000,
+		Description: "Emails the company may send per hour; further emails are refused until the hour has passed",
+	},
+	"i18n.default_locale": {
+		Type: settingString, Default: i18n.Default, Min: 2, Max: 16,
+		Allowed:     i18n.Supported(),
+		Description: "Language of messages and emails for members who set none and whose client asks for none",
+	},
+}
+
+// companySettings holds a company's effective settings; missing keys fall back to defaults
+type companySettings map[string]any
+
+// Int returns an integer setting
+func (s companySettings) Int(key string) int {
+	if v, ok := s[key].(int); ok {
+		return v
+	}
+	v, _ := settingsRegistry[key].Default.(int)
+	return v
+}
+
+// String returns a string setting
+func (s companySettings) String(key string) string {
+	if v, ok := s[key].(string); ok {
+		return v
+	}
+	v, _ := settingsRegistry[key].Default.(string)
+	return v
+}
+
+// Strings returns a string list setting
+func (s companySettings) Strings(key string) []string {
+	if v, ok := s[key].([]string); ok {
+		return v
+	}
+	v, _ := settingsRegistry[key].Default.([]string)
+	return v
+}
+
+// Allows reports whether a string list setting contains value
+func (s companySettings) Allows(key, value string) bool {
+	for _, v := range s.Strings(key) {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSetting parses and validates a JSON value for the setting described by def
+func decodeSetting(def settingDef, raw json.RawMessage) (any, error) {
+	switch def.Type {
+	case settingInt:
+		var n float64
+		if err := json.Unmarshal(raw, &n); err != nil || n != float64(int(n)) {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		if int(n) < def.Min || int(n) > def.Max {
+			return nil, fmt.Errorf("must be between %d and %d", def.Min, def.Max)
+		}
+		return int(n), nil
+	case settingBool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return b, nil
+	case settingString:
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil {
+			return nil, fmt.Errorf("must be a string")
+		}
+		if err := checkSettingString(def, str); err != nil {
+			return nil, err
+		}
+		return str, nil
+	case settingStringList:
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, fmt.Errorf("must be a list of strings")
+		}
+		if len(list) < def.Min || len(list) > def.Max {
+			return nil, fmt.Errorf("must contain between %d and %d items", def.Min, def.Max)
+		}
+		seen := map[string]bool{}
+		for _, item := range list {
+			if seen[item] {
+				return nil, fmt.Errorf("contains %q more than once", item)
+			}
+			seen[item] = true
+			if !settingAllows(def, item) {
+				return nil, fmt.Errorf("contains unsupported value %q", item)
+			}
+			if def.Check != nil {
+				if err := def.Check(item); err != nil {
+					return nil, fmt.Errorf("contains %q which %s", item, err)
+				}
+			}
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("has an unknown type")
+}
+
+// checkSettingString validates a string setting against its length, pattern and allowed values
+func checkSettingString(def settingDef, str string) error {
+	if n := utf8.RuneCountInString(str); n < def.Min || n > def.Max {
+		if def.Min == def.Max {
+			return fmt.Errorf("must be %d characters", def.Min)
+		}
+		return fmt.Errorf("must be between %d and %d characters", def.Min, def.Max)
+	}
+	if def.Pattern != nil && !def.Pattern.MatchString(str) {
+		return fmt.Errorf("has an invalid format")
+	}
+	if !settingAllows(def, str) {
+		return fmt.Errorf("must be one of %v", def.Allowed)
+	}
+	if def.Check != nil {
+		return def.Check(str)
+	}
+	return nil
+}
+
+// settingAllows reports whether value is permitted by the setting's allowed list
+func settingAllows(def settingDef, value string) bool {
+	if len(def.Allowed) == 0 {
+		return true
+	}
+	for _, a := range def.Allowed {
+		if a == value {
+			return true
+		}
+	}
+	return false
+}
+
+// loadCompanySettings returns the effective settings of a company, cached in-process.
+// A companyID of 0 yields the defaults.
+func loadCompanySettings(ctx context.Context, app *core.App, companyID int32) (companySettings, error) {
+	settings := companySettings{}
+	if companyID == 0 {
+		return settings, nil
+	}
+
+	cacheKey := fmt.Sprintf("company_settings:%d", companyID)
+	if cached, ok := app.CacheGet(cacheKey); ok {
+		if s, ok := cached.(companySettings); ok {
+			return s, nil
+		}
+	}
+
+	rows, err := app.Queries.ListCompanySettings(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		def, ok := settingsRegistry[row.Key]
+		if !ok {
+			continue
+		}
+		// Values that no longer pass validation fall back to the default
+		if v, err := decodeSetting(def, row.Value); err == nil {
+			settings[row.Key] = v
+		}
+	}
+
+	app.CacheSet(cacheKey, settings, settingsCacheTTL)
+	return settings, nil
+}
+
+// invalidateCompanySettings drops the cached settings of a company
+func invalidateCompanySettings(app *core.App, companyID int32) {
+	app.Cache.Delete(fmt.Sprintf("company_settings:%d", companyID))
+}
+
+// SettingResponse represents a company setting in API responses
+type SettingResponse struct {
+	Key         string   `json:"key"`
+	Type        string   `json:"type"`
+	Value       any      `json:"value"`
+	Default     any      `json:"default"`
+	IsDefault   bool     `json:"is_default"`
+	Min         int      `json:"min"`
+	Max         int      `json:"max"`
+	Allowed     []string `json:"allowed,omitempty"`
+	Description string   `json:"description"`
+}
+
+// newSettingsResponse lists every registered setting with the company's effective value
+func newSettingsResponse(settings companySettings) []SettingResponse {
+	keys := make([]string, 0, len(settingsRegistry))
+	for key := range settingsRegistry {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	response := make([]SettingResponse, len(keys))
+	for i, key := range keys {
+		def := settingsRegistry[key]
+		value, overridden := settings[key]
+		if !overridden {
+			value = def.Default
+		}
+		response[i] = SettingResponse{
+			Key:         key,
+			Type:        string(def.Type),
+			Value:       value,
+			Default:     def.Default,
+			IsDefault:   !overridden,
+			Min:         def.Min,
+			Max:         def.Max,
+			Allowed:     def.Allowed,
+			Description: def.Description,
+		}
+	}
+	return response
+}
+
+// settingsCompanyID resolves the :id route parameter to the current company or one of its
+// subsidiaries, writing the error response if it is neither
+func (h *CompanyHandler) settingsCompanyID(c *gin.Context) (int32, bool) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return 0, false
+	}
+	id, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_company_id")
+		return 0, false
+	}
+	if id != companyID.(int32) && !h.requireSubsidiary(c, companyID.(int32), id) {
+		return 0, false
+	}
+	return id, true
+}
+
+// GetSettings returns every company setting with its effective value (admin only)
+func (h *CompanyHandler) GetSettings(c *gin.Context) {
+	id, ok := h.settingsCompanyID(c)
+	if !ok {
+		return
+	}
+
+	settings, err := loadCompanySettings(c, h.App, id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "settings_load_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": newSettingsResponse(settings)})
+}
+
+// UpdateSettings changes company settings; a null value resets the setting to its default (admin only)
+func (h *CompanyHandler) UpdateSettings(c *gin.Context) {
+	id, ok := h.settingsCompanyID(c)
+	if !ok {
+		return
+	}
+	userID, _ := c.Get("user_id")
+
+	var req map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&req); err != nil || len(req) == 0 {
+		respondError(c, http.StatusBadRequest, "invalid_body")
+		return
+	}
+
+	// Validate every key before writing any of them
+	for key, raw := range req {
+		def, ok := settingsRegistry[key]
+		if !ok {
+			respondError(c, http.StatusBadRequest, "unknown_setting", key)
+			return
+		}
+		if string(raw) == "null" {
+			continue
+		}
+		value, err := decodeSetting(def, raw)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid_setting", key, err)
+			return
+		}
+		// Lockout protection: an admin cannot save an allowlist that excludes their own address
+		if key == "security.ip_allowlist" && !ipAllowed(value.([]string), c.ClientIP()) {
+			respondError(c, http.StatusConflict, "ip_lockout", c.ClientIP())
+			return
+		}
+		if key == "email.from_address" && !senderAllowed(h.App.Cfg, value.(string)) {
+			respondError(c, http.StatusBadRequest, "sender_not_verified", value)
+			return
+		}
+	}
+
+	updatedBy, _ := userID.(int32)
+	err := h.App.WithTx(c, func(tx *core.Tx) error {
+		for key, raw := range req {
+			if string(raw) == "null" {
+				if err := tx.DeleteCompanySetting(c, &sqlc.DeleteCompanySettingParams{CompanyID: id, Key: key}); err != nil {
+					return err
+				}
+				continue
+			}
+			err := tx.UpsertCompanySetting(c, &sqlc.UpsertCompanySettingParams{
+				CompanyID: id,
+				Key:       key,
+				Value:     raw,
+				UpdatedBy: sql.NullInt32{Int32: updatedBy, Valid: updatedBy != 0},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "settings_update_failed")
+		return
+	}
+	invalidateCompanySettings(h.App, id)
+
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  id,
+		Action:     "company.settings_updated",
+		TargetType: "company",
+		TargetID:   id,
+		After:      req,
+	})
+
+	settings, err := loadCompanySettings(c, h.App, id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "settings_load_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": newSettingsResponse(settings)})
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"project/internal/testutil"
+)
+
+func TestDecodeSetting(t *testing.T) {
+	tests := []struct {
+		key     string
+		raw     string
+		want    any
+		wantErr bool
+	}{
+		{"auth.otp_length", `8`, 8, false},
+		{"auth.otp_length", `3`, nil, true},
+		{"auth.otp_length", `6.5`, nil, true},
+		{"auth.otp_length", `"6"`, nil, true},
+		{"auth.login_methods", `["email_otp"]`, []string{"email_otp"}, false},
+		{"auth.login_methods", `["email_otp","sms_otp"]`, []string{"email_otp", "sms_otp"}, false},
+		{"auth.login_methods", `[]`, nil, true},
+		{"auth.login_methods", `["password"]`, nil, true},
+		{"email.brand_name", `"Acme"`, "Acme", false},
+		{"email.brand_name", `"` + strings.Repeat("a", 101) + `"`, nil, true},
+		{"email.brand_color", `"#1a2B3c"`, "#1a2B3c", false},
+		{"email.brand_color", `"red"`, nil, true},
+		{"email.logo_url", `"https://cdn.acme.com/logo.png"`, "https://cdn.acme.com/logo.png", false},
+		{"email.logo_url", `"http://cdn.acme.com/logo.png"`, nil, true},
+		{"email.logo_url", `""`, "", false},
+		{"email.reply_to", `"support@acme.com"`, "support@acme.com", false},
+		{"email.reply_to", `"Support <support@acme.com>"`, nil, true},
+		{"email.from_name", `"Acme\r\nBcc: x@evil.com"`, nil, true},
+		{"email.header_color", `"#fff"`, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := decodeSetting(settingsRegistry[tt.key], json.RawMessage(tt.raw))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("decodeSetting(%s, %s) error = %v, wantErr %v", tt.key, tt.raw, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr {
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("decodeSetting(%s, %s) = %s, want %s", tt.key, tt.raw, gotJSON, wantJSON)
+			}
+		}
+	}
+}
+
+func TestSettingsRegistryDefaultsAreValid(t *testing.T) {
+	for key, def := range settingsRegistry {
+		raw, _ := json.Marshal(def.Default)
+		if _, err := decodeSetting(def, raw); err != nil {
+			t.Errorf("default of %s is invalid: %v", key, err)
+		}
+	}
+}
+
+func TestCompanySettingsFallBackToDefaults(t *testing.T) {
+	settings := companySettings{"auth.otp_length": 8}
+
+	if got := settings.Int("auth.otp_length"); got != 8 {
+		t.Errorf("Expected otp_length 8, got %d", got)
+	}
+	if got := settings.Int("auth.otp_ttl_minutes"); got != 15 {
+		t.Errorf("Expected default otp_ttl_minutes 15, got %d", got)
+	}
+	if !settings.Allows("auth.login_methods", loginMethodEmailOTP) {
+		t.Error("Expected email OTP login to be allowed by default")
+	}
+}
+
+func TestGenerateOTPLength(t *testing.T) {
+	for _, n := range []int{4, 5, 6, 9, 10} {
+		if otp := generateOTP(n); len(otp) != n {
+			t.Errorf("generateOTP(%d) = %q, want %d digits", n, otp, n)
+		}
+	}
+}
+
+func TestUpdateSettingsValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := testutil.CreateTestApp()
+	h := NewCompanyHandler(app)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("company_id", int32(7))
+		c.Set("user_id", int32(1))
+	})
+	router.PATCH("/v1/companies/:id/settings", h.UpdateSettings)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedError  string
+		expectedCode   string
+	}{
+		{"empty body", `{}`, http.StatusBadRequest, "invalid request body", "invalid_body"},
+		{"unknown key", `{"auth.password_length": 8}`, http.StatusBadRequest, `unknown setting "auth.password_length"`, "unknown_setting"},
+		{"out of range", `{"auth.otp_ttl_minutes": 120}`, http.StatusBadRequest, "auth.otp_ttl_minutes must be between 1 and 60", "invalid_setting"},
+		{"unverified sender", `{"email.from_address": "hello@acme.com"}`, http.StatusBadRequest, "hello@acme.com is not in a verified sender domain", "sender_not_verified"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PATCH", "/v1/companies/7/settings", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.expectedStatus {
+				t.Errorf(statusErrMsg, tt.expectedStatus, recorder.Code)
+			}
+			var body map[string]string
+			json.Unmarshal(recorder.Body.Bytes(), &body)
+			if body["error"] != tt.expectedError {
+				t.Errorf("Expected error %q, got %q", tt.expectedError, body["error"])
+			}
+			if body["code"] != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, body["code"])
+			}
+		})
+	}
+}
+
+func TestLoadCompanySettingsUsesCache(t *testing.T) {
+	app := testutil.CreateTestApp()
+	app.CacheSet("company_settings:7", companySettings{"auth.access_token_hours": 2}, time.Minute)
+
+	settings, err := loadCompanySettings(t.Context(), app, 7)
+	if err != nil {
+		t.Fatalf("Expected cached settings, got error: %v", err)
+	}
+	if got := settings.Int("auth.access_token_hours"); got != 2 {
+		t.Errorf("Expected access_token_hours 2, got %d", got)
+	}
+
+	invalidateCompanySettings(app, 7)
+	if _, ok := app.CacheGet("company_settings:7"); ok {
+		t.Error("Expected cached settings to be invalidated")
+	}
+}
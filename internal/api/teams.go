@@ -0,0 +1,499 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+	"project/internal/db/sqlc"
+)
+
+// Team roles; members of an admin team are company admins
+const (
+	teamRoleMember = "member"
+	teamRoleAdmin  = "admin"
+)
+
+// maxTeamDescriptionLength is the longest team description in characters
+const maxTeamDescriptionLength = 1000
+
+// teamStore is the subset of queries used by the team endpoints
+type teamStore interface {
+	ListTeams(ctx context.Context, companyID int32) ([]sqlc.ListTeamsRow, error)
+	GetTeam(ctx context.Context, arg *sqlc.GetTeamParams) (sqlc.GetTeamRow, error)
+	CreateTeam(ctx context.Context, arg *sqlc.CreateTeamParams) (sqlc.CreateTeamRow, error)
+	UpdateTeam(ctx context.Context, arg *sqlc.UpdateTeamParams) (sqlc.UpdateTeamRow, error)
+	DeleteTeam(ctx context.Context, arg *sqlc.DeleteTeamParams) (int64, error)
+	ListTeamMembers(ctx context.Context, arg *sqlc.ListTeamMembersParams) ([]sqlc.ListTeamMembersRow, error)
+	AddTeamMember(ctx context.Context, arg *sqlc.AddTeamMemberParams) error
+	RemoveTeamMember(ctx context.Context, arg *sqlc.RemoveTeamMemberParams) (int64, error)
+	GetCompanyUser(ctx context.Context, arg *sqlc.GetCompanyUserParams) (sqlc.GetCompanyUserRow, error)
+}
+
+// TeamResponse represents a team in API responses
+type TeamResponse struct {
+	ID          int32  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Role        string `json:"role"`
+	MemberCount *int64 `json:"member_count,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// TeamDetailResponse is a team together with its members
+type TeamDetailResponse struct {
+	TeamResponse
+	Members []TeamMemberResponse `json:"members"`
+}
+
+// TeamMemberResponse represents a member of a team
+type TeamMemberResponse struct {
+	ID      int32  `json:"id"`
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	AddedAt string `json:"added_at"`
+}
+
+// CreateTeamRequest represents the request body for creating a team
+type CreateTeamRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Role        string `json:"role"`
+}
+
+// UpdateTeamRequest represents a partial update of a team; omitted fields are left unchanged
+type UpdateTeamRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Role        *string `json:"role"`
+}
+
+// AddTeamMemberRequest represents the request body for adding a member to a team
+type AddTeamMemberRequest struct {
+	UserID int32 `json:"user_id" binding:"required"`
+}
+
+// TeamHandler handles team management within the current company
+type TeamHandler struct {
+	App   *core.App
+	store teamStore
+}
+
+// NewTeamHandler creates a new TeamHandler instance
+func NewTeamHandler(app *core.App) *TeamHandler {
+	return &TeamHandler{App: app, store: app.Queries}
+}
+
+// registerTeamRoutes mounts the team endpoints; reading is open to company members,
+// changes are admin only
+func registerTeamRoutes(r gin.IRouter, h *TeamHandler) {
+	teams := r.Group("/teams")
+	{
+		teams.GET("", h.ListTeams)
+		teams.GET("/:id", h.GetTeam)
+		teams.GET("/:id/members", h.ListTeamMembers)
+		teams.POST("", AdminRequired(), h.CreateTeam)
+		teams.PATCH("/:id", AdminRequired(), h.UpdateTeam)
+		teams.DELETE("/:id", AdminRequired(), h.DeleteTeam)
+		teams.POST("/:id/members", AdminRequired(), h.AddTeamMember)
+		teams.DELETE("/:id/members/:user_id", AdminRequired(), h.RemoveTeamMember)
+	}
+}
+
+// ListTeams returns the teams of the current company
+func (h *TeamHandler) ListTeams(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+
+	teams, err := h.store.ListTeams(c, companyID.(int32))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "teams_fetch_failed")
+		return
+	}
+
+	response := make([]TeamResponse, len(teams))
+	for i, t := range teams {
+		count := t.MemberCount
+		response[i] = TeamResponse{
+			ID:          t.ID,
+			Name:        t.Name,
+			Description: t.Description,
+			Role:        t.Role,
+			MemberCount: &count,
+			CreatedAt:   t.CreatedAt.Time.Format("2006-01-02T15:04:05Z"),
+			UpdatedAt:   t.UpdatedAt.Time.Format("2006-01-02T15:04:05Z"),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// GetTeam returns a team with its members
+func (h *TeamHandler) GetTeam(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	teamID, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_team_id")
+		return
+	}
+
+	team, err := h.store.GetTeam(c, &sqlc.GetTeamParams{ID: teamID, CompanyID: companyID.(int32)})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "team_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "team_fetch_failed")
+		return
+	}
+
+	members, err := h.store.ListTeamMembers(c, &sqlc.ListTeamMembersParams{TeamID: teamID, CompanyID: companyID.(int32)})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "team_members_fetch_failed")
+		return
+	}
+
+	response := TeamDetailResponse{
+		TeamResponse: newTeamResponse(sqlc.CreateTeamRow(team)),
+		Members:      newTeamMemberResponses(members),
+	}
+	count := int64(len(members))
+	response.MemberCount = &count
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// CreateTeam creates a team in the current company (admin only)
+func (h *TeamHandler) CreateTeam(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+
+	var req CreateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "team_name_required")
+		return
+	}
+	if req.Role == "" {
+		req.Role = teamRoleMember
+	}
+	if err := validateTeam(&req.Name, &req.Description, &req.Role); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	team, err := h.store.CreateTeam(c, &sqlc.CreateTeamParams{
+		CompanyID:   companyID.(int32),
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		Role:        req.Role,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondError(c, http.StatusConflict, "team_name_taken")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "team_create_failed")
+		return
+	}
+	response := newTeamResponse(team)
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  companyID.(int32),
+		Action:     "team.created",
+		TargetType: "team",
+		TargetID:   team.ID,
+		After:      response,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"data": response})
+}
+
+// UpdateTeam renames a team or changes its description or role (admin only)
+func (h *TeamHandler) UpdateTeam(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	teamID, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_team_id")
+		return
+	}
+
+	var req UpdateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	if err := validateTeam(req.Name, req.Description, req.Role); err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// The previous name and role are kept for the audit log
+	before, err := h.store.GetTeam(c, &sqlc.GetTeamParams{ID: teamID, CompanyID: companyID.(int32)})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "team_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "team_fetch_failed")
+		return
+	}
+
+	params := &sqlc.UpdateTeamParams{ID: teamID, CompanyID: companyID.(int32)}
+	if req.Name != nil {
+		params.Name = sql.NullString{String: strings.TrimSpace(*req.Name), Valid: true}
+	}
+	if req.Description != nil {
+		params.Description = sql.NullString{String: strings.TrimSpace(*req.Description), Valid: true}
+	}
+	if req.Role != nil {
+		params.Role = sql.NullString{String: *req.Role, Valid: true}
+	}
+
+	team, err := h.store.UpdateTeam(c, params)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "team_not_found")
+			return
+		}
+		if isUniqueViolation(err) {
+			respondError(c, http.StatusConflict, "team_name_taken")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "team_update_failed")
+		return
+	}
+	response := newTeamResponse(sqlc.CreateTeamRow(team))
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  companyID.(int32),
+		Action:     "team.updated",
+		TargetType: "team",
+		TargetID:   teamID,
+		Before:     newTeamResponse(sqlc.CreateTeamRow(before)),
+		After:      response,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// DeleteTeam deletes a team and its memberships (admin only)
+func (h *TeamHandler) DeleteTeam(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	teamID, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_team_id")
+		return
+	}
+
+	n, err := h.store.DeleteTeam(c, &sqlc.DeleteTeamParams{ID: teamID, CompanyID: companyID.(int32)})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "team_delete_failed")
+		return
+	}
+	if n == 0 {
+		respondError(c, http.StatusNotFound, "team_not_found")
+		return
+	}
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  companyID.(int32),
+		Action:     "team.deleted",
+		TargetType: "team",
+		TargetID:   teamID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": localize(c, "team_deleted")})
+}
+
+// ListTeamMembers returns the members of a team
+func (h *TeamHandler) ListTeamMembers(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	teamID, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_team_id")
+		return
+	}
+
+	if _, err := h.store.GetTeam(c, &sqlc.GetTeamParams{ID: teamID, CompanyID: companyID.(int32)}); err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "team_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "team_fetch_failed")
+		return
+	}
+
+	members, err := h.store.ListTeamMembers(c, &sqlc.ListTeamMembersParams{TeamID: teamID, CompanyID: companyID.(int32)})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "team_members_fetch_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": newTeamMemberResponses(members)})
+}
+
+// AddTeamMember adds a company member to a team; adding an existing member is a no-op (admin only)
+func (h *TeamHandler) AddTeamMember(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	teamID, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_team_id")
+		return
+	}
+
+	var req AddTeamMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID <= 0 {
+		respondError(c, http.StatusBadRequest, "user_id_required")
+		return
+	}
+
+	team, err := h.store.GetTeam(c, &sqlc.GetTeamParams{ID: teamID, CompanyID: companyID.(int32)})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "team_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "team_fetch_failed")
+		return
+	}
+
+	// Only members of the same company can join its teams
+	if _, err := h.store.GetCompanyUser(c, &sqlc.GetCompanyUserParams{ID: req.UserID, CompanyID: companyID.(int32)}); err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "user_not_in_company")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "user_fetch_failed")
+		return
+	}
+
+	if err := h.store.AddTeamMember(c, &sqlc.AddTeamMemberParams{TeamID: teamID, UserID: req.UserID}); err != nil {
+		respondError(c, http.StatusInternalServerError, "team_member_add_failed")
+		return
+	}
+	// The team role is what the membership grants
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  companyID.(int32),
+		Action:     "team.member_added",
+		TargetType: "user",
+		TargetID:   req.UserID,
+		After:      gin.H{"team_id": teamID, "role": team.Role},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": localize(c, "team_member_added")})
+}
+
+// RemoveTeamMember removes a member from a team (admin only)
+func (h *TeamHandler) RemoveTeamMember(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+	teamID, err := parseID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_team_id")
+		return
+	}
+	userID, err := parseID(c.Param("user_id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_user_id")
+		return
+	}
+
+	team, err := h.store.GetTeam(c, &sqlc.GetTeamParams{ID: teamID, CompanyID: companyID.(int32)})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "team_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "team_fetch_failed")
+		return
+	}
+
+	n, err := h.store.RemoveTeamMember(c, &sqlc.RemoveTeamMemberParams{TeamID: teamID, UserID: userID})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "team_member_remove_failed")
+		return
+	}
+	if n == 0 {
+		respondError(c, http.StatusNotFound, "team_member_not_found")
+		return
+	}
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  companyID.(int32),
+		Action:     "team.member_removed",
+		TargetType: "user",
+		TargetID:   userID,
+		Before:     gin.H{"team_id": teamID, "role": team.Role},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": localize(c, "team_member_removed")})
+}
+
+// validateTeam checks the provided team fields and returns an error if invalid
+func validateTeam(name, description, role *string) error {
+	if name != nil {
+		if err := validateName(*name); err != nil {
+			return err
+		}
+	}
+	if description != nil && utf8.RuneCountInString(strings.TrimSpace(*description)) > maxTeamDescriptionLength {
+		return newAPIError("team_description_too_long", maxTeamDescriptionLength)
+	}
+	if role != nil && *role != teamRoleMember && *role != teamRoleAdmin {
+		return newAPIError("invalid_team_role")
+	}
+	return nil
+}
+
+func newTeamResponse(t sqlc.CreateTeamRow) TeamResponse {
+	return TeamResponse{
+		ID:          t.ID,
+		Name:        t.Name,
+		Description: t.Description,
+		Role:        t.Role,
+		CreatedAt:   t.CreatedAt.Time.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:   t.UpdatedAt.Time.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func newTeamMemberResponses(members []sqlc.ListTeamMembersRow) []TeamMemberResponse {
+	response := make([]TeamMemberResponse, len(members))
+	for i, m := range members {
+		response[i] = TeamMemberResponse{
+			ID:      m.ID,
+			Email:   m.Email,
+			Name:    m.Name,
+			AddedAt: m.AddedAt.Time.Format("2006-01-02T15:04:05Z"),
+		}
+	}
+	return response
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"project/internal/db/sqlc"
+	"project/internal/testutil"
+)
+
+func TestValidateTeam(t *testing.T) {
+	long := make([]byte, 1001)
+	for i := range long {
+		long[i] = 'a'
+	}
+
+	tests := []struct {
+		name        *string
+		description *string
+		role        *string
+		wantErr     bool
+	}{
+		{strPtr("Engineering"), strPtr(""), strPtr("member"), false},
+		{strPtr("Admins"), nil, strPtr("admin"), false},
+		{nil, nil, nil, false},
+		{strPtr("  "), nil, nil, true},
+		{nil, strPtr(string(long)), nil, true},
+		{nil, nil, strPtr("owner"), true},
+	}
+
+	for _, tt := range tests {
+		err := validateTeam(tt.name, tt.description, tt.role)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateTeam(%v, %v, %v) = %v, wantErr %v", tt.name, tt.description, tt.role, err, tt.wantErr)
+		}
+	}
+}
+
+// newTeamTestRouter mounts the team routes for an admin of company 1 backed by store
+func newTeamTestRouter(store *fakeScimStore) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/v1", func(c *gin.Context) {
+		c.Set("user_id", int32(100))
+		c.Set("company_id", int32(1))
+		c.Set("is_admin", true)
+		c.Set("locale", c.GetHeader("Accept-Language"))
+		c.Next()
+	})
+	app := testutil.CreateTestApp()
+	app.Audit = store.audit
+	registerTeamRoutes(g, &TeamHandler{App: app, store: store})
+	return r
+}
+
+func teamRequest(t *testing.T, r *gin.Engine, method, path, body string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
+
+	var parsed map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &parsed); err != nil {
+		t.Fatalf("Failed to parse response %q: %v", recorder.Body.String(), err)
+	}
+	return recorder, parsed
+}
+
+// addFakeMember adds a company member to the fake store and returns its ID
+func addFakeMember(store *fakeScimStore, email string) int32 {
+	row, _ := store.CreateUser(context.Background(), &sqlc.CreateUserParams{Email: email, Name: email})
+	store.AddUserToCompany(context.Background(), &sqlc.AddUserToCompanyParams{UserID: row.ID, CompanyID: 1})
+	return row.ID
+}
+
+func TestCreateTeam(t *testing.T) {
+	store := newFakeScimStore()
+	r := newTeamTestRouter(store)
+
+	rec, body := teamRequest(t, r, "POST", "/v1/teams", `{"name": " Engineering ", "role": "admin"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf(statusErrMsg, http.StatusCreated, rec.Code)
+	}
+	data := body["data"].(map[string]any)
+	if data["name"] != "Engineering" || data["role"] != teamRoleAdmin {
+		t.Errorf("Unexpected team %v", data)
+	}
+
+	rec, body = teamRequest(t, r, "POST", "/v1/teams", `{"name": "Ops", "role": "owner"}`)
+	if rec.Code != http.StatusBadRequest || body["code"] != "invalid_team_role" {
+		t.Errorf("Expected invalid_team_role, got %d: %v", rec.Code, body)
+	}
+	rec, body = teamRequest(t, r, "POST", "/v1/teams", `{}`)
+	if rec.Code != http.StatusBadRequest || body["code"] != "team_name_required" {
+		t.Errorf("Expected team_name_required, got %d: %v", rec.Code, body)
+	}
+}
+
+func TestTeamErrorsAreLocalized(t *testing.T) {
+	r := newTeamTestRouter(newFakeScimStore())
+
+	req := httptest.NewRequest("GET", "/v1/teams/42", nil)
+	req.Header.Set("Accept-Language", "de")
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf(statusErrMsg, http.StatusNotFound, recorder.Code)
+	}
+	if !strings.Contains(recorder.Body.String(), `"error":"Team nicht gefunden"`) {
+		t.Errorf("Expected a German error, got %s", recorder.Body.String())
+	}
+}
+
+func TestAddAndRemoveTeamMember(t *testing.T) {
+	store := newFakeScimStore()
+	r := newTeamTestRouter(store)
+	userID := addFakeMember(store, "jane@example.com")
+	outsider, _ := store.CreateUser(context.Background(), &sqlc.CreateUserParams{Email: "other@example.com", Name: "Other"})
+
+	teamRequest(t, r, "POST", "/v1/teams", `{"name": "Engineering"}`)
+
+	rec, body := teamRequest(t, r, "POST", "/v1/teams/1/members", `{"user_id": 1}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %v", http.StatusOK, rec.Code, body)
+	}
+	if !store.teams[1].members[userID] {
+		t.Error("Expected the user to be a team member")
+	}
+
+	// Only members of the company can join its teams
+	rec, body = teamRequest(t, r, "POST", "/v1/teams/1/members", `{"user_id": 2}`)
+	if rec.Code != http.StatusNotFound || body["code"] != "user_not_in_company" {
+		t.Errorf("Expected user_not_in_company, got %d: %v", rec.Code, body)
+	}
+	if store.teams[1].members[outsider.ID] {
+		t.Error("Expected the outsider not to be added")
+	}
+	rec, body = teamRequest(t, r, "POST", "/v1/teams/9/members", `{"user_id": 1}`)
+	if rec.Code != http.StatusNotFound || body["code"] != "team_not_found" {
+		t.Errorf("Expected team_not_found, got %d: %v", rec.Code, body)
+	}
+
+	rec, body = teamRequest(t, r, "DELETE", "/v1/teams/1/members/1", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %v", http.StatusOK, rec.Code, body)
+	}
+	if store.teams[1].members[userID] {
+		t.Error("Expected the user to be removed from the team")
+	}
+	rec, body = teamRequest(t, r, "DELETE", "/v1/teams/1/members/1", "")
+	if rec.Code != http.StatusNotFound || body["code"] != "team_member_not_found" {
+		t.Errorf("Expected team_member_not_found, got %d: %v", rec.Code, body)
+	}
+}
+
+func TestLeavingCompanyRemovesTeamMemberships(t *testing.T) {
+	store := newFakeScimStore()
+	teamRouter := newTeamTestRouter(store)
+	userID := addFakeMember(store, "jane@example.com")
+	teamRequest(t, teamRouter, "POST", "/v1/teams", `{"name": "Engineering"}`)
+	teamRequest(t, teamRouter, "POST", "/v1/teams/1/members", `{"user_id": 1}`)
+
+	// The identity provider removes the user from the company
+	rec, _ := scimRequest(t, newScimTestRouter(store), "DELETE", "/scim/v2/Users/1", "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf(statusErrMsg, http.StatusNoContent, rec.Code)
+	}
+
+	rec, body := teamRequest(t, teamRouter, "GET", "/v1/teams/1/members", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf(statusErrMsg, http.StatusOK, rec.Code)
+	}
+	if members := body["data"].([]any); len(members) != 0 {
+		t.Errorf("Expected no team members after user %d left, got %v", userID, members)
+	}
+}
+
+func TestTeamWritesAreAudited(t *testing.T) {
+	store := newFakeScimStore()
+	r := newTeamTestRouter(store)
+	userID := addFakeMember(store, "jane@example.com")
+
+	teamRequest(t, r, "POST", "/v1/teams", `{"name": "Engineering"}`)
+	teamRequest(t, r, "PATCH", "/v1/teams/1", `{"role": "admin"}`)
+	teamRequest(t, r, "POST", "/v1/teams/1/members", `{"user_id": 1}`)
+	teamRequest(t, r, "DELETE", "/v1/teams/1/members/1", "")
+	teamRequest(t, r, "DELETE", "/v1/teams/1", "")
+
+	want := []string{"team.created", "team.updated", "team.member_added", "team.member_removed", "team.deleted"}
+	if got := store.audit.Actions(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("Expected audit actions %v, got %v", want, got)
+	}
+	records := store.audit.Records()
+	for _, r := range records {
+		if r.ActorType != auditActorUser || r.ActorUserID != 100 || r.CompanyID != 1 {
+			t.Errorf("Expected an event by user 100 in company 1, got %+v", r)
+		}
+	}
+	if !strings.Contains(string(records[1].Before), `"role":"member"`) || !strings.Contains(string(records[1].After), `"role":"admin"`) {
+		t.Errorf("Expected the role change, got %s -> %s", records[1].Before, records[1].After)
+	}
+	if records[2].TargetID != userID || string(records[2].After) != `{"role":"admin","team_id":1}` {
+		t.Errorf("Expected the admin role grant to the user, got %+v", records[2])
+	}
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportPageSize is how many members are fetched from the database per round trip
+const exportPageSize = 500
+
+// exportColumn describes one selectable column of the members export
+type exportColumn struct {
+	Name  string
+	Value func(row userListRow) any
+}
+
+// exportColumns lists the available columns in their default order
+var exportColumns = []exportColumn{
+	{"id", func(r userListRow) any { return r.ID }},
+	{"email", func(r userListRow) any { return r.Email }},
+	{"name", func(r userListRow) any { return r.Name }},
+	{"role", func(r userListRow) any {
+		if r.IsAdmin.Bool {
+			return "admin"
+		}
+		return "member"
+	}},
+	{"is_admin", func(r userListRow) any { return r.IsAdmin.Bool }},
+	{"created_at", func(r userListRow) any { return formatExportTime(r.CreatedAt) }},
+	{"last_login_at", func(r userListRow) any { return formatExportTime(r.LastLoginAt) }},
+	{"deleted_at", func(r userListRow) any { return formatExportTime(r.DeletedAt) }},
+}
+
+// exportFormats maps the format parameter to its content type and file extension
+var exportFormats = map[string]struct{ contentType, ext string }{
+	"csv":   {"text/csv; charset=utf-8", "csv"},
+	"jsonl": {"application/x-ndjson", "jsonl"},
+	"xlsx":  {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx"},
+}
+
+// exportWriter is implemented by each output format
+type exportWriter interface {
+	WriteRow(values []any) error
+	Flush() error
+	Close() error
+}
+
+// ExportUsers streams company members as CSV, JSON Lines or XLSX (admin only).
+// Accepts format, columns (comma separated) and the same filters as ListUsers.
+func (h *UserHandler) ExportUsers(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	formatInfo, ok := exportFormats[format]
+	if !ok {
+		respondError(c, http.StatusBadRequest, "invalid_export_format")
+		return
+	}
+
+	columns, err := parseExportColumns(c.Query("columns"))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	params, err := parseListUsersParams(c, companyID.(int32))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+	params.CursorID, params.CursorValue, params.CursorTime = sql.NullInt32{}, sql.NullString{}, sql.NullTime{}
+	params.PageLimit = exportPageSize
+
+	// Load the first page before committing to a 200 so database errors still get a proper status
+	page, err := listUsers(c, h.App.Queries, params)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "users_fetch_failed")
+		return
+	}
+
+	filename := fmt.Sprintf("members-%d-%s.%s", companyID.(int32), time.Now().UTC().Format("20060102"), formatInfo.ext)
+	c.Header("Content-Type", formatInfo.contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	w, err := newExportWriter(format, c.Writer, columns)
+	if err != nil {
+		log.Printf("user export for company %d failed: %v", companyID.(int32), err)
+		return
+	}
+
+	values := make([]any, len(columns))
+	for {
+		for _, row := range page {
+			for i, col := range columns {
+				values[i] = col.Value(row)
+			}
+			if err := w.WriteRow(values); err != nil {
+				log.Printf("user export for company %d failed: %v", companyID.(int32), err)
+				return
+			}
+		}
+		if err := w.Flush(); err != nil {
+			log.Printf("user export for company %d failed: %v", companyID.(int32), err)
+			return
+		}
+		c.Writer.Flush()
+
+		if int32(len(page)) < params.PageLimit {
+			break
+		}
+		if err := params.seek(params.cursorAfter(page[len(page)-1])); err != nil {
+			log.Printf("user export for company %d failed: %v", companyID.(int32), err)
+			return
+		}
+		page, err = listUsers(c, h.App.Queries, params)
+		if err != nil {
+			// Headers are already sent; a truncated file is the best signal left
+			log.Printf("user export for company %d failed: %v", companyID.(int32), err)
+			return
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		log.Printf("user export for company %d failed: %v", companyID.(int32), err)
+	}
+}
+
+// parseExportColumns resolves the columns parameter, defaulting to every column except deleted_at
+func parseExportColumns(s string) ([]exportColumn, error) {
+	if strings.TrimSpace(s) == "" {
+		return exportColumns[:len(exportColumns)-1], nil
+	}
+
+	var columns []exportColumn
+	seen := map[string]bool{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			continue
+		}
+		found := false
+		for _, col := range exportColumns {
+			if col.Name == name {
+				columns = append(columns, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, newAPIError("unknown_export_column", name)
+		}
+		seen[name] = true
+	}
+	return columns, nil
+}
+
+// newExportWriter creates the writer for a format and writes its header row if it has one
+func newExportWriter(format string, out io.Writer, columns []exportColumn) (exportWriter, error) {
+	header := make([]any, len(columns))
+	for i, col := range columns {
+		header[i] = col.Name
+	}
+
+	switch format {
+	case "jsonl":
+		return &jsonlExportWriter{enc: json.NewEncoder(out), columns: columns}, nil
+	case "xlsx":
+		x, err := newXLSXWriter(out, "Members")
+		if err != nil {
+			return nil, err
+		}
+		return x, x.WriteRow(header)
+	default:
+		w := &csvExportWriter{w: csv.NewWriter(out)}
+		return w, w.WriteRow(header)
+	}
+}
+
+// csvExportWriter writes rows as CSV records
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (cw *csvExportWriter) WriteRow(values []any) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			record[i] = csvSafe(v)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return cw.w.Write(record)
+}
+
+// csvSafe prefixes text that spreadsheets would run as a formula with a quote, following
+// the OWASP guidance on CSV injection. Names and emails are chosen by users.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func (cw *csvExportWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvExportWriter) Close() error { return cw.Flush() }
+
+// jsonlExportWriter writes one JSON object per line keyed by column name
+type jsonlExportWriter struct {
+	enc     *json.Encoder
+	columns []exportColumn
+}
+
+func (jw *jsonlExportWriter) WriteRow(values []any) error {
+	obj := make(map[string]any, len(values))
+	for i, v := range values {
+		obj[jw.columns[i].Name] = v
+	}
+	return jw.enc.Encode(obj)
+}
+
+func (jw *jsonlExportWriter) Flush() error { return nil }
+
+func (jw *jsonlExportWriter) Close() error { return nil }
+
+// formatExportTime formats a nullable timestamp as RFC 3339, or nil when unset
+func formatExportTime(t sql.NullTime) any {
+	if !t.Valid {
+		return nil
+	}
+	return t.Time.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+var exportTestRow = userListRow{
+	ID:        7,
+	Email:     "jane@example.com",
+	Name:      `Jane "JJ" <Doe>`,
+	CreatedAt: sql.NullTime{Time: time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC), Valid: true},
+	IsAdmin:   sql.NullBool{Bool: true, Valid: true},
+}
+
+func writeExport(t *testing.T, format string, columns []exportColumn) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newExportWriter(format, &buf, columns)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	values := make([]any, len(columns))
+	for i, col := range columns {
+		values[i] = col.Value(exportTestRow)
+	}
+	if err := w.WriteRow(values); err != nil {
+		t.Fatalf("Failed to write row: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	return buf.String()
+}
+
+func TestParseExportColumns(t *testing.T) {
+	columns, err := parseExportColumns("")
+	if err != nil || len(columns) != len(exportColumns)-1 {
+		t.Fatalf("Expected default columns, got %d (%v)", len(columns), err)
+	}
+
+	columns, err = parseExportColumns("email, role,email")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(columns) != 2 || columns[0].Name != "email" || columns[1].Name != "role" {
+		t.Errorf("Unexpected columns: %+v", columns)
+	}
+
+	if _, err := parseExportColumns("email,password"); err == nil {
+		t.Error("Expected error for unknown column")
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	columns, _ := parseExportColumns("id,name,role,last_login_at")
+	out := writeExport(t, "csv", columns)
+
+	expected := "id,name,role,last_login_at\n7,\"Jane \"\"JJ\"\" <Doe>\",admin,\n"
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+}
+
+func TestExportCSVEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := newExportWriter("csv", &buf, exportColumns[:1])
+	for _, v := range []any{"=HYPERLINK(\"http://evil.example\")", "+1", "-2+3", "@SUM(A1)", "\tx", "\rx", "Jane", int32(-7)} {
+		if err := w.WriteRow([]any{v}); err != nil {
+			t.Fatalf("Failed to write row: %v", err)
+		}
+	}
+	w.Close()
+
+	expected := "id\n\"'=HYPERLINK(\"\"http://evil.example\"\")\"\n'+1\n'-2+3\n'@SUM(A1)\n'\tx\n\"'\rx\"\nJane\n-7\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	columns, _ := parseExportColumns("id,is_admin,created_at,last_login_at")
+	out := writeExport(t, "jsonl", columns)
+
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(out), &obj); err != nil {
+		t.Fatalf("Invalid JSON line %q: %v", out, err)
+	}
+	if obj["id"] != float64(7) || obj["is_admin"] != true || obj["created_at"] != "2025-09-01T08:00:00Z" || obj["last_login_at"] != nil {
+		t.Errorf("Unexpected object: %v", obj)
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	columns, _ := parseExportColumns("id,name")
+	out := writeExport(t, "xlsx", columns)
+
+	zr, err := zip.NewReader(strings.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatalf("Invalid zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Expected part %s in workbook", name)
+		}
+	}
+	sheet := files["xl/worksheets/sheet1.xml"]
+	if !strings.Contains(sheet, `<c t="n"><v>7</v></c>`) {
+		t.Errorf("Expected numeric id cell, got %s", sheet)
+	}
+	if !strings.Contains(sheet, "Jane &#34;JJ&#34; &lt;Doe&gt;") {
+		t.Errorf("Expected escaped name cell, got %s", sheet)
+	}
+	if !strings.HasSuffix(sheet, "</sheetData></worksheet>") {
+		t.Error("Expected worksheet to be closed")
+	}
+}
@@ -0,0 +1,373 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	core "project/internal"
+)
+
+// Import limits
+const (
+	maxImportBytes      = 5 << 20 // 5 MB
+	maxImportRows       = 10000
+	syncImportRowLimit  = 500 // larger files are processed as a background job
+	importJobResultsTTL = 24 * time.Hour
+)
+
+// ImportRowResult reports the outcome of a single CSV row
+type ImportRowResult struct {
+	Row    int    `json:"row"`
+	Email  string `json:"email"`
+	Status string `json:"status"` // "created", "added", "error"
+	Error  string `json:"error,omitempty"`
+	UserID int32  `json:"user_id,omitempty"`
+}
+
+// ImportReport summarizes an import run
+type ImportReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Added   int               `json:"added"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// ImportJob tracks a background import
+type ImportJob struct {
+	ID        string        `json:"id"`
+	CompanyID int32         `json:"-"`
+	Status    string        `json:"status"` // "running", "completed", "failed"
+	Error     string        `json:"error,omitempty"`
+	Report    *ImportReport `json:"report,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// importRow is a parsed CSV row; Err is set when the row failed validation
+type importRow struct {
+	Line int
+	Req  CreateUserRequest
+	Err  string
+}
+
+// ImportUsers bulk-creates users from CSV with columns email, name, is_admin (admin only).
+// With ?dry_run=true every row is executed inside a transaction that is rolled back.
+func (h *UserHandler) ImportUsers(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+
+	body, err := importBody(c)
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+	defer body.Close()
+
+	rows, err := parseImportCSV(io.LimitReader(body, maxImportBytes+1))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// Imported users are audited with the import as actor, on behalf of the admin
+	origin := newAuditRecord(c, auditEntry{CompanyID: companyID.(int32)})
+	origin.ActorType = auditActorImport
+
+	if len(rows) <= syncImportRowLimit {
+		report, err := runImport(c, h.App, origin, rows, dryRun)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "import_failed")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": report})
+		return
+	}
+
+	jobID, err := newImportJobID()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "import_job_start_failed")
+		return
+	}
+	job := ImportJob{ID: jobID, CompanyID: companyID.(int32), Status: "running", CreatedAt: time.Now()}
+	h.App.CacheSet(importJobCacheKey(jobID), job, importJobResultsTTL)
+
+	go func(job ImportJob) {
+		report, err := runImport(context.Background(), h.App, origin, rows, dryRun)
+		if err != nil {
+			log.Printf("user import job %s failed: %v", jobID, err)
+			job.Status, job.Error = "failed", "failed to import users"
+		} else {
+			job.Status, job.Report = "completed", report
+		}
+		h.App.CacheSet(importJobCacheKey(jobID), job, importJobResultsTTL)
+	}(job)
+
+	c.JSON(http.StatusAccepted, gin.H{"data": job})
+}
+
+// GetImportJob returns the status and report of a background import (admin only)
+func (h *UserHandler) GetImportJob(c *gin.Context) {
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+
+	cached, exists := h.App.CacheGet(importJobCacheKey(c.Param("job_id")))
+	job, ok := cached.(ImportJob)
+	if !exists || !ok || job.CompanyID != companyID.(int32) {
+		respondError(c, http.StatusNotFound, "import_job_not_found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": job})
+}
+
+// importBody returns the CSV stream from a multipart "file" field or the raw request body
+func importBody(c *gin.Context) (io.ReadCloser, error) {
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			return nil, newAPIError("import_file_required")
+		}
+		if file.Size > maxImportBytes {
+			return nil, newAPIError("import_file_too_large", maxImportBytes)
+		}
+		return file.Open()
+	}
+	if c.Request.Body == nil {
+		return nil, newAPIError("import_body_required")
+	}
+	return c.Request.Body, nil
+}
+
+// parseImportCSV reads and validates all rows. Row-level problems are recorded on the row
+// so they show up in the report; only structural problems fail the whole file.
+func parseImportCSV(r io.Reader) ([]importRow, error) {
+	counter := &countingReader{r: r}
+	reader := csv.NewReader(counter)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, newAPIError("import_csv_empty")
+	}
+	if err != nil {
+		return nil, newAPIError("import_csv_invalid", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	emailCol, hasEmail := columns["email"]
+	nameCol, hasName := columns["name"]
+	adminCol, hasAdmin := columns["is_admin"]
+	if !hasEmail || !hasName {
+		return nil, newAPIError("import_csv_columns")
+	}
+
+	field := func(record []string, col int) string {
+		if col < len(record) {
+			return strings.TrimSpace(record[col])
+		}
+		return ""
+	}
+
+	var rows []importRow
+	seen := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if counter.n > maxImportBytes {
+			return nil, newAPIError("import_csv_too_large", maxImportBytes)
+		}
+		if err == io.EOF {
+			break
+		}
+		if len(rows) >= maxImportRows {
+			return nil, newAPIError("import_csv_too_many_rows", maxImportRows)
+		}
+		if err != nil {
+			// FieldPos is only valid after a successful Read
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rows = append(rows, importRow{Line: parseErr.StartLine, Err: "malformed CSV row"})
+				continue
+			}
+			return nil, newAPIError("import_csv_invalid", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := importRow{Line: line}
+		row.Req.Email = core.NormalizeEmail(field(record, emailCol))
+		row.Req.Name = field(record, nameCol)
+		if hasAdmin {
+			if v := field(record, adminCol); v != "" {
+				isAdmin, err := strconv.ParseBool(v)
+				if err != nil {
+					row.Err = "is_admin must be true or false"
+				}
+				row.Req.IsAdmin = isAdmin
+			}
+		}
+		if row.Err == "" {
+			row.Err = validateImportRow(row.Req)
+		}
+		if row.Err == "" {
+			if first, dup := seen[row.Req.Email]; dup {
+				row.Err = fmt.Sprintf("duplicate of row %d", first)
+			} else {
+				seen[row.Req.Email] = line
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, newAPIError("import_csv_no_rows")
+	}
+	return rows, nil
+}
+
+// validateImportRow applies the same rules as CreateUserRequest binding
+func validateImportRow(req CreateUserRequest) string {
+	if req.Email == "" {
+		return "email is required"
+	}
+	if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+		return "invalid email"
+	}
+	if err := validateName(req.Name); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// runImport applies the rows to the company of origin in a single transaction, isolating
+// each row with a savepoint so that one failing row does not abort the others. Dry runs are
+// always rolled back; committed rows are audited from origin once the transaction is done.
+func runImport(ctx context.Context, app *core.App, origin core.AuditRecord, rows []importRow, dryRun bool) (*ImportReport, error) {
+	companyID := origin.CompanyID
+	var report *ImportReport
+	var imported []importedUser
+	err := app.WithTx(ctx, func(tx *core.Tx) error {
+		// Start over on every attempt in case the transaction is retried
+		report = &ImportReport{DryRun: dryRun, Total: len(rows), Rows: make([]ImportRowResult, 0, len(rows))}
+		imported = imported[:0]
+
+		for _, row := range rows {
+			result := ImportRowResult{Row: row.Line, Email: row.Req.Email}
+			if row.Err != "" {
+				result.Status, result.Error = "error", row.Err
+				report.Failed++
+				report.Rows = append(report.Rows, result)
+				continue
+			}
+
+			var user UserResponse
+			var created bool
+			err := tx.Savepoint(ctx, func() error {
+				var err error
+				user, created, err = createOrAddUser(ctx, tx, companyID, row.Req)
+				return err
+			})
+			switch {
+			case err == nil:
+				if !dryRun {
+					result.UserID = user.ID
+					imported = append(imported, importedUser{user: user, created: created})
+				}
+				if created {
+					result.Status = "created"
+					report.Created++
+				} else {
+					result.Status = "added"
+					report.Added++
+				}
+			case core.IsRetryableTxError(err):
+				// A deadlock is not the row's fault; run the whole import again
+				return err
+			case errors.Is(err, errUserInCompany), errors.Is(err, errLookupUser), errors.Is(err, errCheckMembership),
+				errors.Is(err, errCreateUser), errors.Is(err, errAddUserToCompany):
+				result.Status, result.Error = "error", err.Error()
+				report.Failed++
+			default:
+				// The savepoint itself failed; the transaction is unusable
+				return err
+			}
+			report.Rows = append(report.Rows, result)
+		}
+
+		if dryRun {
+			return core.ErrRollback
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	auditImport(ctx, app, origin, imported)
+	return report, nil
+}
+
+// importedUser is a committed import row
+type importedUser struct {
+	user    UserResponse
+	created bool
+}
+
+// auditImport records an event per imported user, like a single user creation would
+func auditImport(ctx context.Context, app *core.App, origin core.AuditRecord, imported []importedUser) {
+	for _, u := range imported {
+		record := origin
+		record.Action = "user.created"
+		if !u.created {
+			record.Action = "user.added_to_company"
+		}
+		record.TargetType = "user"
+		record.TargetID = u.user.ID
+		record.After = auditState(u.user)
+		appendAudit(ctx, app, record)
+	}
+}
+
+func importJobCacheKey(jobID string) string {
+	return "import_job:" + jobID
+}
+
+func newImportJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// countingReader counts bytes read so oversized uploads can be rejected
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
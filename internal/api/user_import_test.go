@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	core "project/internal"
+	"project/internal/testutil"
+)
+
+func TestParseImportCSV(t *testing.T) {
+	input := "\ufeffEmail,Name,is_admin\n" +
+		"jane@example.com,Jane,true\n" +
+		"JOHN@example.com , John ,\n" +
+		"not-an-email,Nobody,false\n" +
+		"jane@example.com,Jane Again,false\n" +
+		"bob@example.com,,false\n" +
+		"amy@example.com,Amy,sometimes\n"
+
+	rows, err := parseImportCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rows) != 6 {
+		t.Fatalf("Expected 6 rows, got %d", len(rows))
+	}
+
+	expected := []struct {
+		line    int
+		email   string
+		isAdmin bool
+		err     string
+	}{
+		{2, "jane@example.com", true, ""},
+		{3, "john@example.com", false, ""},
+		{4, "not-an-email", false, "invalid email"},
+		{5, "jane@example.com", false, "duplicate of row 2"},
+		{6, "bob@example.com", false, "name cannot be empty"},
+		{7, "amy@example.com", false, "is_admin must be true or false"},
+	}
+	for i, want := range expected {
+		got := rows[i]
+		if got.Line != want.line || got.Req.Email != want.email || got.Req.IsAdmin != want.isAdmin || got.Err != want.err {
+			t.Errorf("Row %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+	if rows[1].Req.Name != "John" {
+		t.Errorf("Expected trimmed name, got %q", rows[1].Req.Name)
+	}
+}
+
+func TestParseImportCSVMalformedRow(t *testing.T) {
+	rows, err := parseImportCSV(strings.NewReader("email,name\na\"b@x.com,Bob\nc@example.com,Carol\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %+v", rows)
+	}
+	if rows[0].Line != 2 || rows[0].Err != "malformed CSV row" {
+		t.Errorf("Expected a malformed row on line 2, got %+v", rows[0])
+	}
+	if rows[1].Line != 3 || rows[1].Err != "" || rows[1].Req.Email != "c@example.com" {
+		t.Errorf("Expected the next row to parse, got %+v", rows[1])
+	}
+}
+
+func TestParseImportCSVStructuralErrors(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		code  string
+	}{
+		"empty":          {"", "import_csv_empty"},
+		"missing column": {"email,is_admin\na@example.com,true\n", "import_csv_columns"},
+		"no data rows":   {"email,name\n", "import_csv_no_rows"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseImportCSV(strings.NewReader(tt.input))
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) || apiErr.code != tt.code {
+				t.Errorf("Expected %s error, got %v", tt.code, err)
+			}
+		})
+	}
+}
+
+func TestParseImportCSVTooManyRows(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("email,name\n")
+	for i := 0; i <= maxImportRows; i++ {
+		b.WriteString("user@example.com,User\n")
+	}
+
+	if _, err := parseImportCSV(strings.NewReader(b.String())); err == nil {
+		t.Error("Expected row limit error")
+	}
+}
+
+func TestAuditImport(t *testing.T) {
+	app := testutil.CreateTestApp()
+	audit := &core.MemoryAuditLog{}
+	app.Audit = audit
+	origin := core.AuditRecord{CompanyID: 7, ActorUserID: 5, ActorType: auditActorImport, IP: "192.0.2.1"}
+
+	auditImport(context.Background(), app, origin, []importedUser{
+		{user: UserResponse{ID: 11, Email: "new@example.com"}, created: true},
+		{user: UserResponse{ID: 12, Email: "existing@example.com"}},
+	})
+
+	records := audit.Records()
+	if len(records) != 2 || records[0].Action != "user.created" || records[1].Action != "user.added_to_company" {
+		t.Fatalf("Expected a created and an added event, got %+v", records)
+	}
+	for i, r := range records {
+		if r.ActorType != auditActorImport || r.ActorUserID != 5 || r.CompanyID != 7 || r.IP != "192.0.2.1" {
+			t.Errorf("Expected the import origin, got %+v", r)
+		}
+		if r.TargetType != "user" || r.TargetID != int32(11+i) {
+			t.Errorf("Expected user %d as target, got %+v", 11+i, r)
+		}
+	}
+	if !strings.Contains(string(records[0].After), `"email":"new@example.com"`) {
+		t.Errorf("Expected the user in the event, got %s", records[0].After)
+	}
+}
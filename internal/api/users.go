@@ -1,9 +1,15 @@
 package api
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	core "project/internal"
@@ -17,6 +23,8 @@ type UserResponse struct {
 	Name      string `json:"name"`
 	CreatedAt string `json:"created_at"`
 	IsAdmin   bool   `json:"is_admin"`
+	Version   int32  `json:"version,omitempty"`
+	DeletedAt string `json:"deleted_at,omitempty"`
 }
 
 // CreateUserRequest represents the request body for creating a user
@@ -26,6 +34,14 @@ type CreateUserRequest struct {
 	IsAdmin bool   `json:"is_admin"`
 }
 
+// UpdateUserRequest represents the request body for updating a company member.
+// Nil fields are left unchanged; Version must match the stored user version.
+type UpdateUserRequest struct {
+	Name    *string `json:"name"`
+	IsAdmin *bool   `json:"is_admin"`
+	Version int32   `json:"version" binding:"required"`
+}
+
 // UserHandler handles user management operations
 type UserHandler struct {
 	App *core.App
@@ -36,22 +52,40 @@ func NewUserHandler(app *core.App) *UserHandler {
 	return &UserHandler{App: app}
 }
 
-// ListUsers returns all users for the company (admin only)
+// ListUsers returns a page of users for the company (admin only).
+// Supports limit, cursor, q (name/email prefix), is_admin, team_id, status (active|deleted|all),
+// sort (created_at|name|email) and order (asc|desc) query parameters.
 func (h *UserHandler) ListUsers(c *gin.Context) {
 	// Get company ID from context (set by AuthRequired middleware)
 	companyID, ok := c.Get("company_id")
 	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "company context not found"})
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+
+	params, err := parseListUsersParams(c, companyID.(int32))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err)
 		return
 	}
+	limit := params.PageLimit
+	params.PageLimit = limit + 1 // fetch one extra row to know whether another page exists
 
 	// Get users for the company
-	users, err := h.App.Queries.ListUsers(c, companyID.(int32))
+	users, err := listUsers(c, h.App.Queries, params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch users"})
+		respondError(c, http.StatusInternalServerError, "users_fetch_failed")
 		return
 	}
 
+	var nextCursor *string
+	if int32(len(users)) > limit {
+		users = users[:limit]
+		last := users[len(users)-1]
+		cur := encodeCursor(params.cursorAfter(last))
+		nextCursor = &cur
+	}
+
 	// Transform to response format
 	response := make([]UserResponse, len(users))
 	for i, user := range users {
@@ -61,10 +95,200 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 			Name:      user.Name,
 			CreatedAt: user.CreatedAt.Time.Format("2006-01-02T15:04:05Z"),
 			IsAdmin:   user.IsAdmin.Bool,
+			Version:   user.Version,
+		}
+		if user.DeletedAt.Valid {
+			response[i].DeletedAt = user.DeletedAt.Time.Format("2006-01-02T15:04:05Z")
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response, "next_cursor": nextCursor})
+}
+
+// listUsersParams are the filters, order and keyset position of a member listing
+type listUsersParams struct {
+	CompanyID   int32
+	SortBy      string
+	SortDir     string
+	Status      string
+	IsAdmin     sql.NullBool
+	TeamID      sql.NullInt32
+	Search      sql.NullString
+	CursorID    sql.NullInt32
+	CursorValue sql.NullString // name or email of the last row when sorting by them
+	CursorTime  sql.NullTime   // creation time of the last row when sorting by created_at
+	PageLimit   int32
+}
+
+// userListRow is a row of the ListUsersBy* queries generated by scripts/gen-list-users.sh,
+// which all select the same columns
+type userListRow struct {
+	ID          int32
+	Email       string
+	Name        string
+	Version     int32
+	CreatedAt   sql.NullTime
+	DeletedAt   sql.NullTime
+	LastLoginAt sql.NullTime
+	IsAdmin     sql.NullBool
+}
+
+// cursorAfter returns the keyset position following row
+func (p *listUsersParams) cursorAfter(row userListRow) pageCursor {
+	cur := pageCursor{Sort: p.SortBy + ":" + p.SortDir, ID: row.ID}
+	switch p.SortBy {
+	case "name":
+		cur.Value = row.Name
+	case "email":
+		cur.Value = row.Email
+	default:
+		if row.CreatedAt.Valid {
+			cur.Value = row.CreatedAt.Time.Format(time.RFC3339Nano)
+		}
+	}
+	return cur
+}
+
+// seek moves the listing past cur, which must belong to the same sort
+func (p *listUsersParams) seek(cur pageCursor) error {
+	p.CursorID = sql.NullInt32{Int32: cur.ID, Valid: true}
+	if p.SortBy != "created_at" {
+		p.CursorValue = sql.NullString{String: cur.Value, Valid: true}
+		return nil
+	}
+	// Members without a creation time sort first; an empty value stands for them
+	p.CursorTime = sql.NullTime{}
+	if cur.Value != "" {
+		t, err := time.Parse(time.RFC3339Nano, cur.Value)
+		if err != nil {
+			return newAPIError("invalid_cursor")
 		}
+		p.CursorTime = sql.NullTime{Time: t, Valid: true}
+	}
+	return nil
+}
+
+// listUsers runs the static query for the listing's sort and direction
+func listUsers(ctx context.Context, q *sqlc.Queries, p *listUsersParams) ([]userListRow, error) {
+	byText := sqlc.ListUsersByNameAscParams{
+		CompanyID:   p.CompanyID,
+		Status:      p.Status,
+		IsAdmin:     p.IsAdmin,
+		TeamID:      p.TeamID,
+		Search:      p.Search,
+		CursorID:    p.CursorID,
+		CursorValue: p.CursorValue,
+		PageLimit:   p.PageLimit,
+	}
+	byTime := sqlc.ListUsersByCreatedAtAscParams{
+		CompanyID:  p.CompanyID,
+		Status:     p.Status,
+		IsAdmin:    p.IsAdmin,
+		TeamID:     p.TeamID,
+		Search:     p.Search,
+		CursorID:   p.CursorID,
+		CursorTime: p.CursorTime,
+		PageLimit:  p.PageLimit,
+	}
+
+	switch p.SortBy + ":" + p.SortDir {
+	case "name:asc":
+		rows, err := q.ListUsersByNameAsc(ctx, &byText)
+		return userListRows(rows, err, func(r sqlc.ListUsersByNameAscRow) userListRow { return userListRow(r) })
+	case "name:desc":
+		rows, err := q.ListUsersByNameDesc(ctx, (*sqlc.ListUsersByNameDescParams)(&byText))
+		return userListRows(rows, err, func(r sqlc.ListUsersByNameDescRow) userListRow { return userListRow(r) })
+	case "email:asc":
+		rows, err := q.ListUsersByEmailAsc(ctx, (*sqlc.ListUsersByEmailAscParams)(&byText))
+		return userListRows(rows, err, func(r sqlc.ListUsersByEmailAscRow) userListRow { return userListRow(r) })
+	case "email:desc":
+		rows, err := q.ListUsersByEmailDesc(ctx, (*sqlc.ListUsersByEmailDescParams)(&byText))
+		return userListRows(rows, err, func(r sqlc.ListUsersByEmailDescRow) userListRow { return userListRow(r) })
+	case "created_at:asc":
+		rows, err := q.ListUsersByCreatedAtAsc(ctx, &byTime)
+		return userListRows(rows, err, func(r sqlc.ListUsersByCreatedAtAscRow) userListRow { return userListRow(r) })
+	default:
+		rows, err := q.ListUsersByCreatedAtDesc(ctx, (*sqlc.ListUsersByCreatedAtDescParams)(&byTime))
+		return userListRows(rows, err, func(r sqlc.ListUsersByCreatedAtDescRow) userListRow { return userListRow(r) })
 	}
+}
 
-	c.JSON(http.StatusOK, gin.H{"data": response})
+func userListRows[T any](rows []T, err error, convert func(T) userListRow) ([]userListRow, error) {
+	if err != nil {
+		return nil, err
+	}
+	out := make([]userListRow, len(rows))
+	for i, r := range rows {
+		out[i] = convert(r)
+	}
+	return out, nil
+}
+
+// parseListUsersParams validates the ListUsers query parameters
+func parseListUsersParams(c *gin.Context, companyID int32) (*listUsersParams, error) {
+	params := &listUsersParams{
+		CompanyID: companyID,
+		SortBy:    c.DefaultQuery("sort", "created_at"),
+		SortDir:   c.DefaultQuery("order", "desc"),
+		Status:    c.DefaultQuery("status", "active"),
+	}
+
+	switch params.SortBy {
+	case "created_at", "name", "email":
+	default:
+		return nil, newAPIError("invalid_sort")
+	}
+	if params.SortDir != "asc" && params.SortDir != "desc" {
+		return nil, newAPIError("invalid_order")
+	}
+	switch params.Status {
+	case "active", "deleted", "all":
+	default:
+		return nil, newAPIError("invalid_status_filter")
+	}
+
+	limit, err := parseLimit(c.Query("limit"))
+	if err != nil {
+		return nil, err
+	}
+	params.PageLimit = limit
+
+	if v := c.Query("is_admin"); v != "" {
+		isAdmin, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, newAPIError("invalid_is_admin_filter")
+		}
+		params.IsAdmin = sql.NullBool{Bool: isAdmin, Valid: true}
+	}
+
+	if v := c.Query("team_id"); v != "" {
+		teamID, err := parseID(v)
+		if err != nil {
+			return nil, newAPIError("invalid_team_filter")
+		}
+		params.TeamID = sql.NullInt32{Int32: teamID, Valid: true}
+	}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		params.Search = sql.NullString{String: escapeLike(strings.ToLower(q)), Valid: true}
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		cur, err := decodeCursor(v, params.SortBy+":"+params.SortDir)
+		if err != nil {
+			return nil, err
+		}
+		if err := params.seek(cur); err != nil {
+			return nil, err
+		}
+	}
+
+	return params, nil
+}
+
+// escapeLike escapes LIKE wildcards so user input only matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
 
 // CreateUser creates a new user and adds them to the company (admin only)
@@ -72,57 +296,146 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	// Get company ID from context
 	companyID, ok := c.Get("company_id")
 	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "company context not found"})
+		respondError(c, http.StatusBadRequest, "company_context_missing")
 		return
 	}
 
 	var req CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		respondError(c, http.StatusBadRequest, "invalid_body")
+		return
+	}
+
+	// Creating the account and the membership must succeed or fail together
+	var user UserResponse
+	var created bool
+	err := h.App.WithTx(c, func(tx *core.Tx) error {
+		var err error
+		user, created, err = createOrAddUser(c, tx, companyID.(int32), req)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errUserInCompany) {
+			respondErr(c, http.StatusConflict, err)
+			return
+		}
+		respondErr(c, http.StatusInternalServerError, err)
 		return
 	}
 
+	action := "user.created"
+	if !created {
+		action = "user.added_to_company"
+	}
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  companyID.(int32),
+		Action:     action,
+		TargetType: "user",
+		TargetID:   user.ID,
+		After:      user,
+	})
+
+	if !created {
+		c.JSON(http.StatusOK, gin.H{
+			"message": localize(c, "user_added"),
+			"user":    user,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": localize(c, "user_created"),
+		"user":    user,
+	})
+}
+
+// Errors returned by createOrAddUser; messages are safe to show to API clients
+var (
+	errUserInCompany    = newAPIError("user_exists_in_company")
+	errLookupUser       = newAPIError("user_lookup_failed")
+	errCheckMembership  = newAPIError("user_membership_check_failed")
+	errCreateUser       = newAPIError("user_create_failed")
+	errAddUserToCompany = newAPIError("user_add_failed")
+)
+
+// Errors returned inside the DeleteUser transaction
+var (
+	errUserNotInCompany = newAPIError("user_not_in_company")
+	errDeleteUser       = newAPIError("user_delete_failed")
+)
+
+// Errors returned inside the UpdateUser transaction
+var (
+	errVersionConflict = newAPIError("user_version_conflict")
+	errUpdateUser      = newAPIError("user_update_failed")
+	errUpdateUserRole  = newAPIError("user_role_update_failed")
+	errSharedUserName  = newAPIError("user_name_shared")
+)
+
+// causeError is a sentinel error that keeps the database error it stands for, so WithTx can
+// still tell a deadlock apart. Its message is the sentinel's, which is safe to show.
+type causeError struct {
+	sentinel, cause error
+}
+
+func (e causeError) Error() string   { return e.sentinel.Error() }
+func (e causeError) Unwrap() []error { return []error{e.sentinel, e.cause} }
+
+// withCause returns sentinel with the error that caused it in its chain
+func withCause(sentinel, cause error) error {
+	return causeError{sentinel: sentinel, cause: cause}
+}
+
+// userStore is the subset of queries needed to create users or add them to a company
+type userStore interface {
+	GetUserByEmail(ctx context.Context, email string) (sqlc.GetUserByEmailRow, error)
+	CheckUserInCompany(ctx context.Context, arg *sqlc.CheckUserInCompanyParams) (bool, error)
+	CreateUser(ctx context.Context, arg *sqlc.CreateUserParams) (sqlc.CreateUserRow, error)
+	AddUserToCompany(ctx context.Context, arg *sqlc.AddUserToCompanyParams) error
+}
+
+// createOrAddUser creates the user if the email is unknown, otherwise adds the existing user
+// to the company. It reports whether a new user account was created.
+func createOrAddUser(ctx context.Context, q userStore, companyID int32, req CreateUserRequest) (UserResponse, bool, error) {
+	// Stored normalized so the admin API, SCIM and CSV imports all find the same account
+	req.Email = core.NormalizeEmail(req.Email)
+
 	// Check if user already exists
-	existingUser, err := h.App.Queries.GetUserByEmail(c, req.Email)
+	existingUser, err := q.GetUserByEmail(ctx, req.Email)
 	if err == nil {
 		// User exists, check if they're already in the company
 		checkParams := &sqlc.CheckUserInCompanyParams{
 			UserID:    existingUser.ID,
-			CompanyID: companyID.(int32),
+			CompanyID: companyID,
 		}
-		inCompany, err := h.App.Queries.CheckUserInCompany(c, checkParams)
+		inCompany, err := q.CheckUserInCompany(ctx, checkParams)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check user company membership"})
-			return
+			return UserResponse{}, false, withCause(errCheckMembership, err)
 		}
 		if inCompany {
-			c.JSON(http.StatusConflict, gin.H{"error": "user already exists in this company"})
-			return
+			return UserResponse{}, false, errUserInCompany
 		}
 
 		// Add existing user to company
 		addParams := &sqlc.AddUserToCompanyParams{
 			UserID:    existingUser.ID,
-			CompanyID: companyID.(int32),
+			CompanyID: companyID,
 			IsAdmin:   sql.NullBool{Bool: req.IsAdmin, Valid: true},
 		}
-		err = h.App.Queries.AddUserToCompany(c, addParams)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add user to company"})
-			return
+		if err := q.AddUserToCompany(ctx, addParams); err != nil {
+			return UserResponse{}, false, withCause(errAddUserToCompany, err)
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": "existing user added to company",
-			"user": UserResponse{
-				ID:        existingUser.ID,
-				Email:     existingUser.Email,
-				Name:      existingUser.Name,
-				CreatedAt: existingUser.CreatedAt.Time.Format("2006-01-02T15:04:05Z"),
-				IsAdmin:   req.IsAdmin,
-			},
-		})
-		return
+		return UserResponse{
+			ID:        existingUser.ID,
+			Email:     existingUser.Email,
+			Name:      existingUser.Name,
+			CreatedAt: existingUser.CreatedAt.Time.Format("2006-01-02T15:04:05Z"),
+			IsAdmin:   req.IsAdmin,
+		}, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return UserResponse{}, false, withCause(errLookupUser, err)
 	}
 
 	// Create new user
@@ -130,34 +443,28 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		Email: req.Email,
 		Name:  req.Name,
 	}
-	newUser, err := h.App.Queries.CreateUser(c, createParams)
+	newUser, err := q.CreateUser(ctx, createParams)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
-		return
+		return UserResponse{}, false, withCause(errCreateUser, err)
 	}
 
 	// Add user to company
 	addParams := &sqlc.AddUserToCompanyParams{
 		UserID:    newUser.ID,
-		CompanyID: companyID.(int32),
+		CompanyID: companyID,
 		IsAdmin:   sql.NullBool{Bool: req.IsAdmin, Valid: true},
 	}
-	err = h.App.Queries.AddUserToCompany(c, addParams)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add user to company"})
-		return
+	if err := q.AddUserToCompany(ctx, addParams); err != nil {
+		return UserResponse{}, false, withCause(errAddUserToCompany, err)
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "user created successfully",
-		"user": UserResponse{
-			ID:        newUser.ID,
-			Email:     newUser.Email,
-			Name:      newUser.Name,
-			CreatedAt: newUser.CreatedAt.Time.Format("2006-01-02T15:04:05Z"),
-			IsAdmin:   req.IsAdmin,
-		},
-	})
+	return UserResponse{
+		ID:        newUser.ID,
+		Email:     newUser.Email,
+		Name:      newUser.Name,
+		CreatedAt: newUser.CreatedAt.Time.Format("2006-01-02T15:04:05Z"),
+		IsAdmin:   req.IsAdmin,
+	}, true, nil
 }
 
 // DeleteUser soft deletes a user from the company (admin only)
@@ -165,73 +472,252 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 	// Get user ID from context
 	requesterID, ok := c.Get("user_id")
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		respondError(c, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
 	// Get company ID from context
 	companyID, ok := c.Get("company_id")
 	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "company context not found"})
+		respondError(c, http.StatusBadRequest, "company_context_missing")
 		return
 	}
 
 	// Get user ID from URL params
 	userID := c.Param("id")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user ID is required"})
+		respondError(c, http.StatusBadRequest, "user_id_required")
 		return
 	}
 
 	// Parse user ID
 	var targetUserID int32
 	if _, err := fmt.Sscanf(userID, "%d", &targetUserID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		respondError(c, http.StatusBadRequest, "invalid_user_id")
 		return
 	}
 
 	// Prevent admin from deleting themselves
 	if targetUserID == requesterID.(int32) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot delete yourself"})
+		respondError(c, http.StatusBadRequest, "cannot_delete_self")
 		return
 	}
 
 	// Check if user exists and is in the company
 	targetUser, err := h.App.Queries.GetUserByID(c, targetUserID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		respondError(c, http.StatusNotFound, "user_not_found")
 		return
 	}
 
-	checkParams := &sqlc.CheckUserInCompanyParams{
-		UserID:    targetUserID,
-		CompanyID: companyID.(int32),
+	// The membership check and the soft delete run in one transaction
+	err = h.App.WithTx(c, func(tx *core.Tx) error {
+		inCompany, err := tx.CheckUserInCompany(c, &sqlc.CheckUserInCompanyParams{
+			UserID:    targetUserID,
+			CompanyID: companyID.(int32),
+		})
+		if err != nil {
+			return withCause(errCheckMembership, err)
+		}
+		if !inCompany {
+			return errUserNotInCompany
+		}
+		if err := tx.SoftDeleteUser(c, targetUserID); err != nil {
+			return withCause(errDeleteUser, err)
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errUserNotInCompany):
+			respondErr(c, http.StatusNotFound, err)
+		case errors.Is(err, errCheckMembership):
+			respondErr(c, http.StatusInternalServerError, errCheckMembership)
+		default:
+			respondErr(c, http.StatusInternalServerError, errDeleteUser)
+		}
+		return
+	}
+
+	deleted := UserResponse{
+		ID:        targetUser.ID,
+		Email:     targetUser.Email,
+		Name:      targetUser.Name,
+		CreatedAt: targetUser.CreatedAt.Time.Format("2006-01-02T15:04:05Z"),
+		IsAdmin:   false,
+	}
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  companyID.(int32),
+		Action:     "user.deleted",
+		TargetType: "user",
+		TargetID:   targetUserID,
+		Before:     deleted,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": localize(c, "user_deleted"),
+		"user":    deleted,
+	})
+}
+
+// UpdateUser updates a company member's name and admin flag (admin only). Members who also
+// belong to other companies keep their name under their own control.
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	requesterID, ok := c.Get("user_id")
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
 	}
-	inCompany, err := h.App.Queries.CheckUserInCompany(c, checkParams)
+
+	companyID, ok := c.Get("company_id")
+	if !ok {
+		respondError(c, http.StatusBadRequest, "company_context_missing")
+		return
+	}
+
+	targetUserID, err := parseID(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check user company membership"})
+		respondError(c, http.StatusBadRequest, "invalid_user_id")
 		return
 	}
-	if !inCompany {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found in this company"})
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_body")
 		return
 	}
+	if req.Name != nil {
+		if err := validateName(*req.Name); err != nil {
+			respondErr(c, http.StatusBadRequest, err)
+			return
+		}
+	}
 
-	// Soft delete the user
-	err = h.App.Queries.SoftDeleteUser(c, targetUserID)
+	// Prevent admin from locking themselves out of user management
+	if req.IsAdmin != nil && !*req.IsAdmin && targetUserID == requesterID.(int32) {
+		respondError(c, http.StatusBadRequest, "cannot_remove_own_admin")
+		return
+	}
+
+	getParams := &sqlc.GetCompanyUserParams{
+		ID:        targetUserID,
+		CompanyID: companyID.(int32),
+	}
+	target, err := h.App.Queries.GetCompanyUser(c, getParams)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user"})
+		if err == sql.ErrNoRows {
+			respondError(c, http.StatusNotFound, "user_not_in_company")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "user_fetch_failed")
 		return
 	}
 
+	// Always bump the version so role changes also take part in the concurrency check
+	updateParams := &sqlc.UpdateUserProfileParams{
+		ID:      targetUserID,
+		Version: req.Version,
+	}
+	if req.Name != nil {
+		updateParams.Name = sql.NullString{String: strings.TrimSpace(*req.Name), Valid: true}
+	}
+
+	var updated sqlc.UpdateUserProfileRow
+	isAdmin := target.IsAdmin.Bool
+	err = h.App.WithTx(c, func(tx *core.Tx) error {
+		// The name is stored once per account, so renaming someone who also belongs to other
+		// companies would rename them there too; only the user can do that from their profile
+		if updateParams.Name.Valid && updateParams.Name.String != target.Name && targetUserID != requesterID.(int32) {
+			shared, err := tx.UserInOtherCompanies(c, &sqlc.UserInOtherCompaniesParams{UserID: targetUserID, CompanyID: companyID.(int32)})
+			if err != nil {
+				return withCause(errUpdateUser, err)
+			}
+			if shared {
+				return errSharedUserName
+			}
+		}
+
+		var err error
+		updated, err = tx.UpdateUserProfile(c, updateParams)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errVersionConflict
+			}
+			return withCause(errUpdateUser, err)
+		}
+		if req.IsAdmin != nil && *req.IsAdmin != target.IsAdmin.Bool {
+			adminParams := &sqlc.SetUserCompanyAdminParams{
+				UserID:    targetUserID,
+				CompanyID: companyID.(int32),
+				IsAdmin:   sql.NullBool{Bool: *req.IsAdmin, Valid: true},
+			}
+			if err := tx.SetUserCompanyAdmin(c, adminParams); err != nil {
+				return withCause(errUpdateUserRole, err)
+			}
+			isAdmin = *req.IsAdmin
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errVersionConflict):
+			respondErr(c, http.StatusConflict, err)
+		case errors.Is(err, errSharedUserName):
+			respondErr(c, http.StatusForbidden, err)
+		case errors.Is(err, errUpdateUserRole):
+			respondErr(c, http.StatusInternalServerError, err)
+		default:
+			respondErr(c, http.StatusInternalServerError, errUpdateUser)
+		}
+		return
+	}
+
+	response := UserResponse{
+		ID:        updated.ID,
+		Email:     updated.Email,
+		Name:      updated.Name,
+		CreatedAt: updated.CreatedAt.Time.Format("2006-01-02T15:04:05Z"),
+		IsAdmin:   isAdmin,
+		Version:   updated.Version,
+	}
+	recordAudit(c, h.App, auditEntry{
+		CompanyID:  companyID.(int32),
+		Action:     "user.updated",
+		TargetType: "user",
+		TargetID:   targetUserID,
+		Before:     gin.H{"name": target.Name, "is_admin": target.IsAdmin.Bool},
+		After:      gin.H{"name": response.Name, "is_admin": response.IsAdmin},
+	})
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "user deleted successfully",
-		"user": UserResponse{
-			ID:        targetUser.ID,
-			Email:     targetUser.Email,
-			Name:      targetUser.Name,
-			CreatedAt: targetUser.CreatedAt.Time.Format("2006-01-02T15:04:05Z"),
-			IsAdmin:   false,
-		},
+		"message": localize(c, "user_updated"),
+		"user":    response,
 	})
 }
+
+// parseID parses a positive int32 identifier from a URL parameter
+func parseID(s string) (int32, error) {
+	id, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if id <= 0 {
+		return 0, fmt.Errorf("id must be positive")
+	}
+	return int32(id), nil
+}
+
+// maxNameLength is the longest display name accepted, in characters
+const maxNameLength = 255
+
+// validateName checks a display name
+func validateName(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return newAPIError("name_empty")
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return newAPIError("name_too_long", maxNameLength)
+	}
+	return nil
+}
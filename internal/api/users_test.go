@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	core "project/internal"
+	"project/internal/db/sqlc"
+)
+
+func newQueryContext(rawQuery string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/v1/users?"+rawQuery, nil)
+	return c
+}
+
+func TestParseListUsersParamsDefaults(t *testing.T) {
+	params, err := parseListUsersParams(newQueryContext(""), 7)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if params.CompanyID != 7 || params.SortBy != "created_at" || params.SortDir != "desc" || params.Status != "active" {
+		t.Errorf("Unexpected defaults: %+v", params)
+	}
+	if params.PageLimit != defaultPageLimit {
+		t.Errorf("Expected limit %d, got %d", defaultPageLimit, params.PageLimit)
+	}
+	if params.IsAdmin.Valid || params.Search.Valid || params.CursorID.Valid {
+		t.Errorf("Expected optional filters to be unset: %+v", params)
+	}
+}
+
+func TestParseListUsersParamsFilters(t *testing.T) {
+	cursor := encodeCursor(pageCursor{Sort: "name:asc", Value: "jane", ID: 12})
+	params, err := parseListUsersParams(newQueryContext("sort=name&order=asc&limit=500&is_admin=true&team_id=3&q=Jo_n%25&status=all&cursor="+cursor), 7)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if params.PageLimit != maxPageLimit {
+		t.Errorf("Expected limit capped at %d, got %d", maxPageLimit, params.PageLimit)
+	}
+	if !params.IsAdmin.Valid || !params.IsAdmin.Bool {
+		t.Error("Expected is_admin filter to be true")
+	}
+	if !params.TeamID.Valid || params.TeamID.Int32 != 3 {
+		t.Errorf("Expected team_id filter 3, got %+v", params.TeamID)
+	}
+	if params.Search.String != `jo\_n\%` {
+		t.Errorf("Expected escaped lowercase search, got %q", params.Search.String)
+	}
+	if params.CursorID.Int32 != 12 || params.CursorValue.String != "jane" {
+		t.Errorf("Unexpected cursor position: %+v", params)
+	}
+}
+
+func TestParseListUsersParamsErrors(t *testing.T) {
+	otherSortCursor := encodeCursor(pageCursor{Sort: "email:asc", Value: "a", ID: 1})
+	queries := []string{
+		"sort=password",
+		"order=sideways",
+		"status=pending",
+		"limit=0",
+		"limit=abc",
+		"is_admin=maybe",
+		"team_id=-1",
+		"cursor=not-base64!",
+		"sort=name&order=asc&cursor=" + otherSortCursor,
+		"cursor=" + encodeCursor(pageCursor{Sort: "created_at:desc", Value: "yesterday", ID: 1}),
+	}
+
+	for _, q := range queries {
+		t.Run(q, func(t *testing.T) {
+			if _, err := parseListUsersParams(newQueryContext(q), 7); err == nil {
+				t.Errorf("Expected error for %q", q)
+			}
+		})
+	}
+}
+
+func TestListUsersCursorRoundTrip(t *testing.T) {
+	created := time.Date(2025, 9, 1, 8, 0, 0, 123456000, time.UTC)
+	row := userListRow{ID: 12, Email: "Jane@example.com", Name: "Jane", CreatedAt: sql.NullTime{Time: created, Valid: true}}
+
+	params, _ := parseListUsersParams(newQueryContext(""), 7)
+	next, err := parseListUsersParams(newQueryContext("cursor="+encodeCursor(params.cursorAfter(row))), 7)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !next.CursorTime.Valid || !next.CursorTime.Time.Equal(created) || next.CursorID.Int32 != 12 {
+		t.Errorf("Unexpected created_at position: %+v", next)
+	}
+
+	// Members without a creation time sort first and keep their place
+	row.CreatedAt = sql.NullTime{}
+	next, err = parseListUsersParams(newQueryContext("cursor="+encodeCursor(params.cursorAfter(row))), 7)
+	if err != nil || next.CursorTime.Valid || next.CursorID.Int32 != 12 {
+		t.Errorf("Unexpected position for a member without creation time: %+v, %v", next, err)
+	}
+
+	params, _ = parseListUsersParams(newQueryContext("sort=email&order=asc"), 7)
+	next, err = parseListUsersParams(newQueryContext("sort=email&order=asc&cursor="+encodeCursor(params.cursorAfter(row))), 7)
+	if err != nil || next.CursorValue.String != "Jane@example.com" {
+		t.Errorf("Unexpected email position: %+v, %v", next, err)
+	}
+}
+
+func TestCreateOrAddUserNormalizesEmail(t *testing.T) {
+	store := newFakeScimStore()
+	ctx := context.Background()
+
+	user, created, err := createOrAddUser(ctx, store, 1, CreateUserRequest{Email: " Jane@Example.COM ", Name: "Jane"})
+	if err != nil || !created {
+		t.Fatalf("Expected a new user, got %v, %v", created, err)
+	}
+	if user.Email != "jane@example.com" || store.users[user.ID].email != "jane@example.com" {
+		t.Errorf("Expected the email stored in lower case, got %q", store.users[user.ID].email)
+	}
+
+	// The admin API, SCIM and imports must all find the same account
+	_, _, err = createOrAddUser(ctx, store, 1, CreateUserRequest{Email: "JANE@example.com", Name: "Jane"})
+	if !errors.Is(err, errUserInCompany) {
+		t.Errorf("Expected errUserInCompany for a differently cased email, got %v", err)
+	}
+	if len(store.users) != 1 {
+		t.Errorf("Expected a single account, got %d", len(store.users))
+	}
+
+	rows, err := parseImportCSV(strings.NewReader("email,name\nJANE@Example.com,Jane\n"))
+	if err != nil || rows[0].Req.Email != "jane@example.com" {
+		t.Errorf("Expected the import to normalize the email, got %+v, %v", rows, err)
+	}
+	state, err := scimUserInput{UserName: " Jane@EXAMPLE.com"}.state(true)
+	if err != nil || state.Email != "jane@example.com" {
+		t.Errorf("Expected SCIM to normalize the email, got %q, %v", state.Email, err)
+	}
+}
+
+// deadlockingStore fails every membership insert with a deadlock
+type deadlockingStore struct {
+	*fakeScimStore
+}
+
+func (deadlockingStore) AddUserToCompany(context.Context, *sqlc.AddUserToCompanyParams) error {
+	return &pgconn.PgError{Code: "40P01"}
+}
+
+func TestCreateOrAddUserKeepsDatabaseError(t *testing.T) {
+	_, _, err := createOrAddUser(context.Background(), deadlockingStore{newFakeScimStore()}, 1, CreateUserRequest{Email: "jane@example.com", Name: "Jane"})
+	if !errors.Is(err, errAddUserToCompany) {
+		t.Fatalf("Expected errAddUserToCompany, got %v", err)
+	}
+	// WithTx must still see the deadlock to run the transaction again
+	if !core.IsRetryableTxError(err) {
+		t.Error("Expected the deadlock to stay in the error chain")
+	}
+	if err.Error() != errAddUserToCompany.Error() {
+		t.Errorf("Expected the client-safe message, got %q", err.Error())
+	}
+}
@@ -14,7 +14,11 @@ type App struct {
 	DB           *sql.DB
 	Queries      *sqlc.Queries
 	Cache        *cache.Cache
-	EmailService *EmailService
+	Mailer       Mailer
+	SMS          SMSSender
+	Audit        AuditLog
+
+	outboxWake chan struct{}
 }
 
 func NewApp(cfg Config, db *sql.DB) *App {
@@ -24,10 +28,14 @@ func NewApp(cfg Config, db *sql.DB) *App {
 		DB:      db,
 		Queries: sqlc.New(db),
 		Cache:   cache.New(cacheTTL, 2*cacheTTL),
+
+		outboxWake: make(chan struct{}, 1),
 	}
 	
-	// Initialize email service
-	app.EmailService = NewEmailService(cfg.EmailAPIKey, cfg.EmailFromAddress)
+	// Initialize the mailer for the configured transport
+	app.Mailer = NewMailer(cfg)
+	app.SMS = NewSMSSender(cfg)
+	app.Audit = chainAuditLog{app}
 	
 	return app
 }
@@ -0,0 +1,426 @@
+package internal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"project/internal/db/sqlc"
+)
+
+// auditChainBatch is how many events a chain verification reads per query
+const auditChainBatch = 500
+
+// AuditRecord is the content of an audit event. Everything in it is covered by the event hash.
+type AuditRecord struct {
+	CompanyID   int32
+	ActorUserID int32 // 0 when the actor is not a user
+	ActorType   string
+	Action      string
+	TargetType  string
+	TargetID    int32
+	IP          string
+	UserAgent   string
+	Before      json.RawMessage
+	After       json.RawMessage
+	CreatedAt   time.Time
+}
+
+// auditHashInput fixes the field order and formats hashed for an event
+type auditHashInput struct {
+	PrevHash    string          `json:"prev_hash"`
+	CompanyID   int32           `json:"company_id"`
+	ActorUserID int32           `json:"actor_user_id"`
+	ActorType   string          `json:"actor_type"`
+	Action      string          `json:"action"`
+	TargetType  string          `json:"target_type"`
+	TargetID    int32           `json:"target_id"`
+	IP          string          `json:"ip"`
+	UserAgent   string          `json:"user_agent"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	CreatedAt   string          `json:"created_at"`
+}
+
+// CanonicalJSON re-encodes a JSON document with sorted keys and no insignificant whitespace,
+// so values read back from JSONB hash the same as the values that were written
+func CanonicalJSON(raw []byte) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return json.RawMessage("{}"), nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// AuditHash computes the hex SHA-256 of an event linked to the hash of its predecessor
+func AuditHash(prevHash string, r AuditRecord) (string, error) {
+	before, err := CanonicalJSON(r.Before)
+	if err != nil {
+		return "", fmt.Errorf("before: %w", err)
+	}
+	after, err := CanonicalJSON(r.After)
+	if err != nil {
+		return "", fmt.Errorf("after: %w", err)
+	}
+	b, err := json.Marshal(auditHashInput{
+		PrevHash:    prevHash,
+		CompanyID:   r.CompanyID,
+		ActorUserID: r.ActorUserID,
+		ActorType:   r.ActorType,
+		Action:      r.Action,
+		TargetType:  r.TargetType,
+		TargetID:    r.TargetID,
+		IP:          r.IP,
+		UserAgent:   r.UserAgent,
+		Before:      before,
+		After:       after,
+		CreatedAt:   r.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AppendAuditEvent writes an event at the head of its company's hash chain
+func (a *App) AppendAuditEvent(ctx context.Context, r AuditRecord) error {
+	var err error
+	if r.Before, err = CanonicalJSON(r.Before); err != nil {
+		return fmt.Errorf("before: %w", err)
+	}
+	if r.After, err = CanonicalJSON(r.After); err != nil {
+		return fmt.Errorf("after: %w", err)
+	}
+	// PostgreSQL keeps microseconds, so hash exactly what will be stored
+	r.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	return a.WithTx(ctx, func(tx *Tx) error {
+		if err := tx.LockAuditChain(ctx, r.CompanyID); err != nil {
+			return err
+		}
+		var prevHash string
+		head, err := tx.GetAuditChainHead(ctx, r.CompanyID)
+		if err == nil {
+			prevHash = head.Hash.String
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+
+		hash, err := AuditHash(prevHash, r)
+		if err != nil {
+			return err
+		}
+		return tx.CreateAuditEvent(ctx, &sqlc.CreateAuditEventParams{
+			CompanyID:   r.CompanyID,
+			ActorUserID: sql.NullInt32{Int32: r.ActorUserID, Valid: r.ActorUserID != 0},
+			ActorType:   r.ActorType,
+			Action:      r.Action,
+			TargetType:  sql.NullString{String: r.TargetType, Valid: r.TargetType != ""},
+			TargetID:    sql.NullInt32{Int32: r.TargetID, Valid: r.TargetID != 0},
+			Ip:          sql.NullString{String: r.IP, Valid: r.IP != ""},
+			UserAgent:   sql.NullString{String: r.UserAgent, Valid: r.UserAgent != ""},
+			Before:      r.Before,
+			After:       r.After,
+			CreatedAt:   r.CreatedAt,
+			PrevHash:    sql.NullString{String: prevHash, Valid: true},
+			Hash:        sql.NullString{String: hash, Valid: true},
+		})
+	})
+}
+
+// AuditLog receives audit events. The App's default writes them to the company hash
+// chain; tests swap in a MemoryAuditLog.
+type AuditLog interface {
+	Append(ctx context.Context, r AuditRecord) error
+}
+
+// chainAuditLog appends events to the database hash chain
+type chainAuditLog struct {
+	app *App
+}
+
+// Append writes the event with AppendAuditEvent
+func (l chainAuditLog) Append(ctx context.Context, r AuditRecord) error {
+	return l.app.AppendAuditEvent(ctx, r)
+}
+
+// MemoryAuditLog records audit events in memory so tests can inspect them
+type MemoryAuditLog struct {
+	mu      sync.Mutex
+	records []AuditRecord
+}
+
+// Append records the event
+func (l *MemoryAuditLog) Append(ctx context.Context, r AuditRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, r)
+	return nil
+}
+
+// Records returns the events appended so far, oldest first
+func (l *MemoryAuditLog) Records() []AuditRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]AuditRecord(nil), l.records...)
+}
+
+// Actions returns the action of every event appended so far, oldest first
+func (l *MemoryAuditLog) Actions() []string {
+	var actions []string
+	for _, r := range l.Records() {
+		actions = append(actions, r.Action)
+	}
+	return actions
+}
+
+// auditRecordFromEvent rebuilds the hashed content of a stored event
+func auditRecordFromEvent(e sqlc.AuditEvent) AuditRecord {
+	return AuditRecord{
+		CompanyID:   e.CompanyID,
+		ActorUserID: e.ActorUserID.Int32,
+		ActorType:   e.ActorType,
+		Action:      e.Action,
+		TargetType:  e.TargetType.String,
+		TargetID:    e.TargetID.Int32,
+		IP:          e.Ip.String,
+		UserAgent:   e.UserAgent.String,
+		Before:      e.Before,
+		After:       e.After,
+		CreatedAt:   e.CreatedAt,
+	}
+}
+
+// AuditChainBreak describes an event or checkpoint that does not match the hash chain
+type AuditChainBreak struct {
+	EventID      int32  `json:"event_id,omitempty"`
+	CheckpointID int32  `json:"checkpoint_id,omitempty"`
+	Reason       string `json:"reason"`
+}
+
+// AuditChainReport summarises the verification of one company's hash chain
+type AuditChainReport struct {
+	CompanyID   int32             `json:"company_id"`
+	Events      int               `json:"events"`
+	Unchained   int               `json:"unchained"` // events written before hash chaining
+	HeadID      int32             `json:"head_id,omitempty"`
+	HeadHash    string            `json:"head_hash,omitempty"`
+	Checkpoints int               `json:"checkpoints"`
+	Breaks      []AuditChainBreak `json:"breaks"`
+}
+
+// auditChainWalker checks events one at a time in id order
+type auditChainWalker struct {
+	report  AuditChainReport
+	started bool
+	prev    string
+	chained int32
+	hashes  map[int32]string // stored hash by event id, for checkpoint checks
+	counts  map[int32]int32  // chained events up to and including an event id
+}
+
+func newAuditChainWalker(companyID int32) *auditChainWalker {
+	return &auditChainWalker{
+		report: AuditChainReport{CompanyID: companyID, Breaks: []AuditChainBreak{}},
+		hashes: map[int32]string{},
+		counts: map[int32]int32{},
+	}
+}
+
+// add verifies the next event of the chain
+func (w *auditChainWalker) add(e sqlc.AuditEvent) {
+	w.report.Events++
+	if !e.Hash.Valid {
+		if w.started {
+			w.fail(e.ID, "event has no hash although the chain has started")
+		} else {
+			w.report.Unchained++
+		}
+		return
+	}
+	w.started = true
+
+	if e.PrevHash.String != w.prev {
+		w.fail(e.ID, "prev_hash does not match the previous event")
+	}
+	if hash, err := AuditHash(e.PrevHash.String, auditRecordFromEvent(e)); err != nil {
+		w.fail(e.ID, fmt.Sprintf("event content cannot be hashed: %v", err))
+	} else if hash != e.Hash.String {
+		w.fail(e.ID, "hash does not match the event content")
+	}
+
+	// Continue from the stored hash so each tampered event is reported once
+	w.prev = e.Hash.String
+	w.chained++
+	w.hashes[e.ID] = e.Hash.String
+	w.counts[e.ID] = w.chained
+	w.report.HeadID = e.ID
+	w.report.HeadHash = e.Hash.String
+}
+
+// checkpoint verifies a signed checkpoint against the events walked so far
+func (w *auditChainWalker) checkpoint(cp sqlc.AuditCheckpoint, pub ed25519.PublicKey) {
+	w.report.Checkpoints++
+	if !VerifyAuditCheckpoint(pub, NewAuditCheckpointPayload(cp), cp.Signature) {
+		w.report.Breaks = append(w.report.Breaks, AuditChainBreak{CheckpointID: cp.ID, Reason: "checkpoint signature is invalid"})
+		return
+	}
+	if hash, ok := w.hashes[cp.LastEventID]; !ok || hash != cp.LastHash {
+		w.report.Breaks = append(w.report.Breaks, AuditChainBreak{CheckpointID: cp.ID, Reason: "checkpoint does not match the event it covers"})
+		return
+	}
+	// The signed count must match the chained events up to the covered one
+	if w.counts[cp.LastEventID] != cp.EventCount {
+		w.report.Breaks = append(w.report.Breaks, AuditChainBreak{CheckpointID: cp.ID, Reason: "checkpoint event count does not match the chain"})
+	}
+}
+
+func (w *auditChainWalker) fail(eventID int32, reason string) {
+	w.report.Breaks = append(w.report.Breaks, AuditChainBreak{EventID: eventID, Reason: reason})
+}
+
+// VerifyAuditChain walks a company's audit events and checkpoints and reports every break
+func VerifyAuditChain(ctx context.Context, q *sqlc.Queries, companyID int32, pub ed25519.PublicKey) (AuditChainReport, error) {
+	w := newAuditChainWalker(companyID)
+	var after int32
+	for {
+		events, err := q.ListAuditChain(ctx, &sqlc.ListAuditChainParams{CompanyID: companyID, ID: after, Limit: auditChainBatch})
+		if err != nil {
+			return w.report, err
+		}
+		for _, e := range events {
+			w.add(e)
+			after = e.ID
+		}
+		if len(events) < auditChainBatch {
+			break
+		}
+	}
+
+	checkpoints, err := q.ListAuditCheckpoints(ctx, companyID)
+	if err != nil {
+		return w.report, err
+	}
+	for _, cp := range checkpoints {
+		w.checkpoint(cp, pub)
+	}
+	return w.report, nil
+}
+
+// AuditCheckpointPayload is the signed content of a checkpoint
+type AuditCheckpointPayload struct {
+	CompanyID   int32  `json:"company_id"`
+	LastEventID int32  `json:"last_event_id"`
+	LastHash    string `json:"last_hash"`
+	EventCount  int32  `json:"event_count"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// NewAuditCheckpointPayload extracts the signed content of a stored checkpoint
+func NewAuditCheckpointPayload(cp sqlc.AuditCheckpoint) AuditCheckpointPayload {
+	return AuditCheckpointPayload{
+		CompanyID:   cp.CompanyID,
+		LastEventID: cp.LastEventID,
+		LastHash:    cp.LastHash,
+		EventCount:  cp.EventCount,
+		CreatedAt:   cp.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// SignAuditCheckpoint returns the base64 Ed25519 signature of a checkpoint
+func SignAuditCheckpoint(key ed25519.PrivateKey, p AuditCheckpointPayload) string {
+	b, _ := json.Marshal(p)
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, b))
+}
+
+// VerifyAuditCheckpoint checks a checkpoint signature
+func VerifyAuditCheckpoint(pub ed25519.PublicKey, p AuditCheckpointPayload, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	b, _ := json.Marshal(p)
+	return ed25519.Verify(pub, b, sig)
+}
+
+// WriteAuditCheckpoints signs the current chain head of every company whose chain moved
+// since its last checkpoint. It returns how many checkpoints were written.
+func (a *App) WriteAuditCheckpoints(ctx context.Context) (int, error) {
+	companies, err := a.Queries.ListAuditCompanies(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	key := a.Cfg.AuditSigningKey()
+	written := 0
+	for _, companyID := range companies {
+		head, err := a.Queries.GetAuditChainHead(ctx, companyID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return written, err
+		}
+		latest, err := a.Queries.GetLatestAuditCheckpoint(ctx, companyID)
+		if err == nil && latest.LastEventID == head.ID {
+			continue
+		}
+		if err != nil && err != sql.ErrNoRows {
+			return written, err
+		}
+
+		count, err := a.Queries.CountAuditChain(ctx, &sqlc.CountAuditChainParams{CompanyID: companyID, ID: head.ID})
+		if err != nil {
+			return written, err
+		}
+		createdAt := time.Now().UTC().Truncate(time.Microsecond)
+		payload := AuditCheckpointPayload{
+			CompanyID:   companyID,
+			LastEventID: head.ID,
+			LastHash:    head.Hash.String,
+			EventCount:  count,
+			CreatedAt:   createdAt.Format(time.RFC3339Nano),
+		}
+		_, err = a.Queries.CreateAuditCheckpoint(ctx, &sqlc.CreateAuditCheckpointParams{
+			CompanyID:   companyID,
+			LastEventID: head.ID,
+			LastHash:    head.Hash.String,
+			EventCount:  count,
+			Signature:   SignAuditCheckpoint(key, payload),
+			CreatedAt:   createdAt,
+		})
+		if err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
+
+// RunAuditCheckpoints writes checkpoints every interval until ctx is cancelled
+func (a *App) RunAuditCheckpoints(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := a.WriteAuditCheckpoints(ctx); err != nil {
+				log.Printf("audit checkpoints: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"project/internal/db/sqlc"
+)
+
+// chainEvents builds a valid hash chain of n events for company 7
+func chainEvents(t *testing.T, n int) []sqlc.AuditEvent {
+	t.Helper()
+	var events []sqlc.AuditEvent
+	prev := ""
+	for i := 1; i <= n; i++ {
+		e := sqlc.AuditEvent{
+			ID:          int32(i),
+			CompanyID:   7,
+			ActorUserID: sql.NullInt32{Int32: 3, Valid: true},
+			ActorType:   "user",
+			Action:      "user.updated",
+			TargetType:  sql.NullString{String: "user", Valid: true},
+			TargetID:    sql.NullInt32{Int32: int32(10 + i), Valid: true},
+			Before:      json.RawMessage(`{"name": "Old", "is_admin": false}`),
+			After:       json.RawMessage(`{"is_admin":true,"name":"New"}`),
+			CreatedAt:   time.Date(2025, 9, 1, 12, 0, i, 123000, time.UTC),
+		}
+		hash, err := AuditHash(prev, auditRecordFromEvent(e))
+		if err != nil {
+			t.Fatalf("AuditHash: %v", err)
+		}
+		e.PrevHash = sql.NullString{String: prev, Valid: true}
+		e.Hash = sql.NullString{String: hash, Valid: true}
+		events = append(events, e)
+		prev = hash
+	}
+	return events
+}
+
+func walk(events []sqlc.AuditEvent) AuditChainReport {
+	w := newAuditChainWalker(7)
+	for _, e := range events {
+		w.add(e)
+	}
+	return w.report
+}
+
+func TestAuditChainVerifies(t *testing.T) {
+	legacy := sqlc.AuditEvent{ID: 0, CompanyID: 7, ActorType: "system", Action: "auth.login"}
+	report := walk(append([]sqlc.AuditEvent{legacy}, chainEvents(t, 5)...))
+
+	if len(report.Breaks) != 0 {
+		t.Fatalf("Expected no breaks, got %+v", report.Breaks)
+	}
+	if report.Events != 6 || report.Unchained != 1 || report.HeadID != 5 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+func TestAuditChainDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(events []sqlc.AuditEvent) []sqlc.AuditEvent
+		eventID int32
+	}{
+		{"modified content", func(e []sqlc.AuditEvent) []sqlc.AuditEvent {
+			e[2].After = json.RawMessage(`{"is_admin":false,"name":"New"}`)
+			return e
+		}, 3},
+		{"deleted event", func(e []sqlc.AuditEvent) []sqlc.AuditEvent {
+			return append(e[:1:1], e[2:]...)
+		}, 3},
+		{"missing hash", func(e []sqlc.AuditEvent) []sqlc.AuditEvent {
+			e[3].Hash = sql.NullString{}
+			return e
+		}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := walk(tt.tamper(chainEvents(t, 5)))
+			if len(report.Breaks) == 0 || report.Breaks[0].EventID != tt.eventID {
+				t.Errorf("Expected the first break at event %d, got %+v", tt.eventID, report.Breaks)
+			}
+		})
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	got, err := CanonicalJSON([]byte(`{ "b": 1, "a": [true, null] }`))
+	if err != nil {
+		t.Fatalf("CanonicalJSON: %v", err)
+	}
+	if string(got) != `{"a":[true,null],"b":1}` {
+		t.Errorf("Unexpected canonical JSON %s", got)
+	}
+	if got, _ := CanonicalJSON(nil); string(got) != "{}" {
+		t.Errorf("Expected empty object for empty input, got %s", got)
+	}
+}
+
+func TestAuditCheckpointSignature(t *testing.T) {
+	cfg := Config{JWTSecret: "test-secret-key"}
+	key := cfg.AuditSigningKey()
+	events := chainEvents(t, 3)
+
+	cp := sqlc.AuditCheckpoint{
+		ID:          1,
+		CompanyID:   7,
+		LastEventID: 3,
+		LastHash:    events[2].Hash.String,
+		EventCount:  3,
+		CreatedAt:   time.Date(2025, 9, 1, 13, 0, 0, 0, time.UTC),
+	}
+	cp.Signature = SignAuditCheckpoint(key, NewAuditCheckpointPayload(cp))
+
+	w := newAuditChainWalker(7)
+	for _, e := range events {
+		w.add(e)
+	}
+	w.checkpoint(cp, key.Public().(ed25519.PublicKey))
+	if len(w.report.Breaks) != 0 {
+		t.Fatalf("Expected checkpoint to verify, got %+v", w.report.Breaks)
+	}
+
+	forged := cp
+	forged.EventCount = 2
+	w.checkpoint(forged, key.Public().(ed25519.PublicKey))
+	if len(w.report.Breaks) != 1 || w.report.Breaks[0].CheckpointID != 1 {
+		t.Errorf("Expected forged checkpoint to be reported, got %+v", w.report.Breaks)
+	}
+
+	// A validly signed checkpoint must also agree with the number of chained events
+	miscounted := cp
+	miscounted.ID = 2
+	miscounted.EventCount = 4
+	miscounted.Signature = SignAuditCheckpoint(key, NewAuditCheckpointPayload(miscounted))
+	w.checkpoint(miscounted, key.Public().(ed25519.PublicKey))
+	if len(w.report.Breaks) != 2 || w.report.Breaks[1].Reason != "checkpoint event count does not match the chain" {
+		t.Errorf("Expected the event count mismatch to be reported, got %+v", w.report.Breaks)
+	}
+}
@@ -1,8 +1,13 @@
 package internal
 
 import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -10,7 +15,27 @@ type Config struct {
 	JWTSecret        string
 	EmailAPIKey      string
 	EmailFromAddress string
+	SenderDomains    []string // domains verified with the email provider that companies may send from
+	EmailTransport   string   // zeptomail, smtp, file, memory, mailbox or log
+	EmailFileDir     string   // directory the file transport writes .eml files to
+	WebhookSecret    string   // shared secret signing the email provider's delivery webhooks
+	EmailHourlyLimit int      // emails queued per hour across all companies; 0 disables the budget
+	RecipientLimit   int      // emails queued per hour to one address; 0 disables the throttle
+	MetricsToken     string   // bearer token for /debug/vars; metrics are not served without it
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	SMTPStartTLS     bool   // refuse SMTP servers that do not offer STARTTLS
+	SMSTransport     string // twilio, memory or log
+	TwilioAccountSID string
+	TwilioAuthToken  string
+	SMSFromNumber    string // E.164 number text messages are sent from
+	WhatsAppFrom     string // E.164 number enabled for WhatsApp; WhatsApp delivery is off without it
 	Environment      string
+	AppBaseURL       string
+	TrustedProxies   []string // proxies whose X-Forwarded-For is used for the client IP
+	AuditKeySeed     string   // base64 Ed25519 seed signing audit checkpoints
 }
 
 func getenv(key, def string) string {
@@ -28,13 +53,163 @@ func LoadConfig() Config {
 	jwt := getenv("JWT_SECRET", "dev-secret-change-me")
 	emailAPIKey := getenv("EMAIL_API_KEY", "")
 	emailFromAddress := getenv("EMAIL_FROM_ADDRESS", "noreply@example.com")
+	emailTransport := getenv("EMAIL_TRANSPORT", "")
+	switch emailTransport {
+	case "", EmailTransportZeptoMail, EmailTransportSMTP, EmailTransportFile, EmailTransportMemory, EmailTransportMailbox, EmailTransportLog:
+	default:
+		log.Fatal("EMAIL_TRANSPORT must be one of zeptomail, smtp, file, memory, mailbox or log")
+	}
+	if emailTransport == EmailTransportZeptoMail && emailAPIKey == "" {
+		log.Fatal("EMAIL_API_KEY is required for the zeptomail transport")
+	}
+	smtpHost := getenv("SMTP_HOST", "")
+	if emailTransport == EmailTransportSMTP && smtpHost == "" {
+		log.Fatal("SMTP_HOST is required for the smtp transport")
+	}
+	smtpPort, err := strconv.Atoi(getenv("SMTP_PORT", "587"))
+	if err != nil || smtpPort < 1 || smtpPort > 65535 {
+		log.Fatal("SMTP_PORT must be a port number")
+	}
+	smtpStartTLS, err := strconv.ParseBool(getenv("SMTP_STARTTLS", "true"))
+	if err != nil {
+		log.Fatal("SMTP_STARTTLS must be true or false")
+	}
+
+	smsTransport := getenv("SMS_TRANSPORT", "")
+	switch smsTransport {
+	case "", SMSTransportTwilio, SMSTransportMemory, SMSTransportLog:
+	default:
+		log.Fatal("SMS_TRANSPORT must be one of twilio, memory or log")
+	}
+	twilioAccountSID := getenv("TWILIO_ACCOUNT_SID", "")
+	smsFromNumber := getenv("SMS_FROM_NUMBER", "")
+	if (Config{SMSTransport: smsTransport, TwilioAccountSID: twilioAccountSID}).smsTransport() == SMSTransportTwilio &&
+		(twilioAccountSID == "" || smsFromNumber == "") {
+		log.Fatal("TWILIO_ACCOUNT_SID and SMS_FROM_NUMBER are required for the twilio transport")
+	}
+	whatsAppFrom := getenv("WHATSAPP_FROM_NUMBER", "")
+	for _, n := range []string{smsFromNumber, whatsAppFrom} {
+		if n != "" && !ValidPhone(n) {
+			log.Fatal("SMS_FROM_NUMBER and WHATSAPP_FROM_NUMBER must be E.164 phone numbers")
+		}
+	}
+
+	emailHourlyLimit, err := strconv.Atoi(getenv("EMAIL_HOURLY_LIMIT", "2000"))
+	if err != nil || emailHourlyLimit < 0 {
+		log.Fatal("EMAIL_HOURLY_LIMIT must be a non-negative number")
+	}
+	recipientLimit, err := strconv.Atoi(getenv("EMAIL_RECIPIENT_HOURLY_LIMIT", "10"))
+	if err != nil || recipientLimit < 0 {
+		log.Fatal("EMAIL_RECIPIENT_HOURLY_LIMIT must be a non-negative number")
+	}
+
 	environment := getenv("ENVIRONMENT", "dev")
+	if emailTransport == EmailTransportMailbox && environment != "dev" {
+		log.Fatal("the mailbox email transport is only available in the dev environment")
+	}
+	appBaseURL := getenv("APP_BASE_URL", "http://localhost:8080")
+
+	var trustedProxies []string
+	for _, p := range strings.Split(getenv("TRUSTED_PROXIES", ""), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			trustedProxies = append(trustedProxies, p)
+		}
+	}
+
+	var senderDomains []string
+	for _, d := range strings.Split(getenv("EMAIL_SENDER_DOMAINS", ""), ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			senderDomains = append(senderDomains, d)
+		}
+	}
+
+	auditKeySeed := getenv("AUDIT_SIGNING_KEY", "")
+	if auditKeySeed != "" {
+		if seed, err := base64.StdEncoding.DecodeString(auditKeySeed); err != nil || len(seed) != ed25519.SeedSize {
+			log.Fatal("AUDIT_SIGNING_KEY must be a base64 encoded 32 byte Ed25519 seed")
+		}
+	} else if environment != "dev" {
+		// A key derived from JWT_SECRET would let anyone holding that secret forge checkpoints
+		log.Fatal("AUDIT_SIGNING_KEY is required outside the dev environment")
+	}
 
 	return Config{
 		DatabaseDSN:      dsn,
 		JWTSecret:        jwt,
 		EmailAPIKey:      emailAPIKey,
 		EmailFromAddress: emailFromAddress,
+		SenderDomains:    senderDomains,
+		EmailTransport:   emailTransport,
+		EmailFileDir:     getenv("EMAIL_FILE_DIR", "mail"),
+		WebhookSecret:    getenv("EMAIL_WEBHOOK_SECRET", ""),
+		EmailHourlyLimit: emailHourlyLimit,
+		RecipientLimit:   recipientLimit,
+		MetricsToken:     getenv("METRICS_TOKEN", ""),
+		SMTPHost:         smtpHost,
+		SMTPPort:         smtpPort,
+		SMTPUsername:     getenv("SMTP_USERNAME", ""),
+		SMTPPassword:     getenv("SMTP_PASSWORD", ""),
+		SMTPStartTLS:     smtpStartTLS,
+		SMSTransport:     smsTransport,
+		TwilioAccountSID: twilioAccountSID,
+		TwilioAuthToken:  getenv("TWILIO_AUTH_TOKEN", ""),
+		SMSFromNumber:    smsFromNumber,
+		WhatsAppFrom:     whatsAppFrom,
 		Environment:      environment,
+		AppBaseURL:       appBaseURL,
+		TrustedProxies:   trustedProxies,
+		AuditKeySeed:     auditKeySeed,
+	}
+}
+
+// emailTransport returns the configured email transport, defaulting to ZeptoMail when an
+// API key is set and to logging otherwise. The dev mailbox is never a default: it shows
+// every OTP and invitation link, so it has to be asked for.
+func (c Config) emailTransport() string {
+	switch {
+	case c.EmailTransport != "":
+		return c.EmailTransport
+	case c.EmailAPIKey != "":
+		return EmailTransportZeptoMail
+	default:
+		return EmailTransportLog
+	}
+}
+
+// smsTransport returns the configured SMS transport, defaulting to Twilio when an account
+// is set and to logging otherwise
+func (c Config) smsTransport() string {
+	switch {
+	case c.SMSTransport != "":
+		return c.SMSTransport
+	case c.TwilioAccountSID != "":
+		return SMSTransportTwilio
+	default:
+		return SMSTransportLog
+	}
+}
+
+// SenderDomainVerified reports whether address is in one of the verified sender domains
+func (c Config) SenderDomainVerified(address string) bool {
+	i := strings.LastIndex(address, "@")
+	if i < 0 {
+		return false
+	}
+	domain := strings.ToLower(address[i+1:])
+	for _, d := range c.SenderDomains {
+		if d == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditSigningKey returns the key signing audit checkpoints. Without AUDIT_SIGNING_KEY it is
+// derived from the JWT secret; LoadConfig only allows that in the dev environment.
+func (c Config) AuditSigningKey() ed25519.PrivateKey {
+	if seed, err := base64.StdEncoding.DecodeString(c.AuditKeySeed); err == nil && len(seed) == ed25519.SeedSize {
+		return ed25519.NewKeyFromSeed(seed)
 	}
+	seed := sha256.Sum256([]byte("audit-checkpoints:" + c.JWTSecret))
+	return ed25519.NewKeyFromSeed(seed[:])
 }
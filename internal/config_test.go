@@ -131,3 +131,23 @@ func TestGetenv(t *testing.T) {
 		})
 	}
 }
+
+func TestSenderDomainVerified(t *testing.T) {
+	cfg := Config{SenderDomains: []string{"acme.com", "mail.example.org"}}
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"hello@acme.com", true},
+		{"hello@ACME.com", true},
+		{"hello@mail.example.org", true},
+		{"hello@example.org", false},
+		{"hello@evil-acme.com", false},
+		{"acme.com", false},
+	}
+	for _, tt := range tests {
+		if got := cfg.SenderDomainVerified(tt.address); got != tt.want {
+			t.Errorf("SenderDomainVerified(%q) = %v, want %v", tt.address, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+-- Each company's events form a hash chain ordered by id. Writers hold LockAuditChain for
+-- the rest of their transaction so two events never link to the same predecessor.
+
+-- name: LockAuditChain :exec
+SELECT pg_advisory_xact_lock(hashtext('audit_events'), $1);
+
+-- name: GetAuditChainHead :one
+SELECT id, hash
+FROM audit_events
+WHERE company_id = $1 AND hash IS NOT NULL
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (
+    company_id, actor_user_id, actor_type, action, target_type, target_id, ip, user_agent,
+    before, after, created_at, prev_hash, hash
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);
+
+-- name: ListAuditEvents :many
+SELECT
+    e.id,
+    e.actor_user_id,
+    u.email AS actor_email,
+    e.actor_type,
+    e.action,
+    e.target_type,
+    e.target_id,
+    e.ip,
+    e.user_agent,
+    e.before,
+    e.after,
+    e.hash,
+    e.created_at
+FROM audit_events e
+LEFT JOIN users u ON u.id = e.actor_user_id
+WHERE e.company_id = sqlc.arg('company_id')
+  AND (sqlc.narg('actor_user_id')::integer IS NULL OR e.actor_user_id = sqlc.narg('actor_user_id')::integer)
+  AND (sqlc.narg('action')::text IS NULL OR e.action = sqlc.narg('action')::text)
+  AND (sqlc.narg('target_type')::text IS NULL OR e.target_type = sqlc.narg('target_type')::text)
+  AND (sqlc.narg('target_id')::integer IS NULL OR e.target_id = sqlc.narg('target_id')::integer)
+  AND (sqlc.narg('since')::timestamp IS NULL OR e.created_at >= sqlc.narg('since')::timestamp)
+  AND (sqlc.narg('until')::timestamp IS NULL OR e.created_at < sqlc.narg('until')::timestamp)
+  AND (sqlc.narg('cursor_id')::integer IS NULL OR e.id < sqlc.narg('cursor_id')::integer)
+ORDER BY e.id DESC
+LIMIT sqlc.arg('page_limit')::integer;
+
+-- name: ListAuditChain :many
+SELECT id, company_id, actor_user_id, actor_type, action, target_type, target_id, ip, user_agent,
+       before, after, created_at, prev_hash, hash
+FROM audit_events
+WHERE company_id = $1 AND id > $2
+ORDER BY id ASC
+LIMIT $3;
+
+-- name: ListAuditCompanies :many
+SELECT DISTINCT company_id
+FROM audit_events
+ORDER BY company_id ASC;
+
+-- name: CountAuditChain :one
+SELECT COUNT(*)::integer
+FROM audit_events
+WHERE company_id = $1 AND hash IS NOT NULL AND id <= $2;
+
+-- name: CreateAuditCheckpoint :one
+INSERT INTO audit_checkpoints (company_id, last_event_id, last_hash, event_count, signature, created_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, company_id, last_event_id, last_hash, event_count, signature, created_at;
+
+-- name: GetLatestAuditCheckpoint :one
+SELECT id, company_id, last_event_id, last_hash, event_count, signature, created_at
+FROM audit_checkpoints
+WHERE company_id = $1
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: ListAuditCheckpoints :many
+SELECT id, company_id, last_event_id, last_hash, event_count, signature, created_at
+FROM audit_checkpoints
+WHERE company_id = $1
+ORDER BY id ASC;
@@ -0,0 +1,122 @@
+-- Hierarchy walks are capped at 10 levels (maxCompanyDepth in the API) so a
+-- corrupted parent chain can never recurse forever.
+
+-- name: ListSubsidiaries :many
+WITH RECURSIVE subtree AS (
+    SELECT c.id, 1 AS depth
+    FROM companies c
+    WHERE c.parent_id = $1
+    UNION ALL
+    SELECT c.id, s.depth + 1
+    FROM subtree s
+    JOIN companies c ON c.parent_id = s.id
+    WHERE s.depth < 10
+)
+SELECT 
+    c.id,
+    c.name,
+    c.address,
+    c.phone,
+    c.email,
+    c.tax_id,
+    c.parent_id,
+    c.inherit_memberships,
+    c.created_at,
+    s.depth
+FROM subtree s
+JOIN companies c ON c.id = s.id
+ORDER BY s.depth ASC, lower(c.name) ASC, c.id ASC;
+
+-- name: GetCompanyDepth :one
+WITH RECURSIVE ancestors AS (
+    SELECT c.parent_id, 0 AS depth
+    FROM companies c
+    WHERE c.id = $1
+    UNION ALL
+    SELECT c.parent_id, a.depth + 1
+    FROM ancestors a
+    JOIN companies c ON c.id = a.parent_id
+    WHERE a.depth < 10
+)
+SELECT MAX(depth)::integer AS depth
+FROM ancestors;
+
+-- name: IsCompanyDescendant :one
+WITH RECURSIVE ancestors AS (
+    SELECT companies.parent_id AS ancestor_id, 1 AS depth
+    FROM companies
+    WHERE companies.id = sqlc.arg('company_id')
+    UNION ALL
+    SELECT companies.parent_id, ancestors.depth + 1
+    FROM ancestors
+    JOIN companies ON companies.id = ancestors.ancestor_id
+    WHERE ancestors.depth < 10
+)
+SELECT EXISTS (
+    SELECT 1
+    FROM ancestors
+    WHERE ancestors.ancestor_id = sqlc.arg('ancestor_id')::int
+);
+
+-- name: CreateSubsidiary :one
+INSERT INTO companies (name, address, phone, email, tax_id, parent_id, inherit_memberships)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, name, address, phone, email, tax_id, parent_id, inherit_memberships, created_at;
+
+-- name: UpdateCompany :one
+UPDATE companies
+SET
+    name = COALESCE(sqlc.narg('name'), name),
+    address = COALESCE(sqlc.narg('address'), address),
+    phone = COALESCE(sqlc.narg('phone'), phone),
+    email = COALESCE(sqlc.narg('email'), email),
+    tax_id = COALESCE(sqlc.narg('tax_id'), tax_id),
+    inherit_memberships = COALESCE(sqlc.narg('inherit_memberships'), inherit_memberships)
+WHERE id = sqlc.arg('id')
+RETURNING id, name, address, phone, email, tax_id, parent_id, inherit_memberships, created_at;
+
+-- name: SetCompanyParent :exec
+UPDATE companies
+SET parent_id = sqlc.narg('parent_id')
+WHERE id = sqlc.arg('id');
+
+-- name: CountCompanyAdmins :one
+-- Active members who are admins of the company in their own right, as GetUserCompanies
+-- resolves it: through is_admin or an admin team of the company, not through a parent
+SELECT COUNT(*)
+FROM user_companies uc
+WHERE uc.company_id = $1 AND uc.active
+  AND (
+      COALESCE(uc.is_admin, FALSE)
+      OR EXISTS (
+          SELECT 1
+          FROM team_members tm
+          JOIN teams t ON t.id = tm.team_id
+          WHERE tm.user_id = uc.user_id AND t.company_id = uc.company_id AND t.role = 'admin'
+      )
+  );
+
+-- name: GetCompanyParent :one
+-- Locks the company so concurrent moves of it within the hierarchy wait for each other
+SELECT parent_id
+FROM companies
+WHERE id = $1
+FOR UPDATE;
+
+-- name: IsDirectCompanyAdmin :one
+-- Admin through the user's own active membership of the company, either flagged or through
+-- an admin team; admin rights inherited from a parent company do not count
+SELECT EXISTS (
+    SELECT 1
+    FROM user_companies uc
+    WHERE uc.user_id = sqlc.arg('user_id') AND uc.company_id = sqlc.arg('company_id') AND uc.active
+      AND (
+          COALESCE(uc.is_admin, FALSE)
+          OR EXISTS (
+              SELECT 1
+              FROM team_members tm
+              JOIN teams t ON t.id = tm.team_id
+              WHERE tm.user_id = uc.user_id AND t.company_id = uc.company_id AND t.role = 'admin'
+          )
+      )
+);
@@ -0,0 +1,33 @@
+-- name: UpdateUserEmail :one
+UPDATE users
+SET
+    email = $2,
+    version = version + 1,
+    updated_at = NOW(),
+    sessions_revoked_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, email, name;
+
+-- name: CreateEmailChangeRevert :exec
+INSERT INTO email_change_reverts (user_id, old_email, new_email, token_hash, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetEmailChangeRevert :one
+SELECT id, user_id, old_email, new_email
+FROM email_change_reverts
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW();
+
+-- name: MarkEmailChangeRevertsUsed :exec
+UPDATE email_change_reverts
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: GetUserSessionsRevokedAt :one
+SELECT sessions_revoked_at
+FROM users
+WHERE id = $1;
+
+-- name: RevokeUserSessions :exec
+UPDATE users
+SET sessions_revoked_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,132 @@
+-- Delivery claims rows with FOR UPDATE SKIP LOCKED so several workers can run at once. A claim
+-- lapses after its lease, which returns the emails of a crashed worker to the queue.
+
+-- name: EnqueueEmail :one
+-- Attachments are a JSON array of {name, content_type, content} with base64 content, and
+-- recipients a JSON array of every lowercased address for the send budgets, so an email,
+-- its attachments and its recipients are queued in one statement
+WITH email AS (
+    INSERT INTO email_outbox (company_id, idempotency_key, to_address, to_name, extra_to, cc, bcc,
+                              from_address, from_name, reply_to, headers, subject, html_body, text_body,
+                              attachment_count, recipient_budget_only)
+    VALUES (sqlc.narg('company_id'), sqlc.narg('idempotency_key'), sqlc.arg('to_address'), sqlc.arg('to_name'),
+            sqlc.arg('extra_to'), sqlc.arg('cc'), sqlc.arg('bcc'), sqlc.arg('from_address'), sqlc.arg('from_name'),
+            sqlc.arg('reply_to'), sqlc.arg('headers'), sqlc.arg('subject'), sqlc.arg('html_body'),
+            sqlc.arg('text_body'), jsonb_array_length(sqlc.arg('attachments')::jsonb),
+            sqlc.arg('recipient_budget_only'))
+    ON CONFLICT (idempotency_key) DO NOTHING
+    RETURNING id
+), attachments AS (
+    INSERT INTO email_outbox_attachments (email_id, position, name, content_type, content)
+    SELECT email.id, a.position, a.value->>'name', a.value->>'content_type', decode(a.value->>'content', 'base64')
+    FROM email, jsonb_array_elements(sqlc.arg('attachments')::jsonb) WITH ORDINALITY AS a(value, position)
+), recipients AS (
+    INSERT INTO email_outbox_recipients (email_id, address)
+    SELECT DISTINCT email.id, r.address
+    FROM email, jsonb_array_elements_text(sqlc.arg('recipients')::jsonb) AS r(address)
+)
+SELECT id FROM email;
+
+-- name: CountRecentEmails :one
+-- Emails queued within the window overall and for one company, leaving out the ones that
+-- spend only the recipient budget, and for the busiest of the lowercased addresses in the
+-- JSON array recipients, whichever field they were sent in
+SELECT COUNT(*) FILTER (WHERE NOT recipient_budget_only) AS total,
+       COUNT(*) FILTER (WHERE company_id = sqlc.arg('company_id')::integer AND NOT recipient_budget_only) AS company,
+       (
+           SELECT COALESCE(MAX(n), 0)::bigint
+           FROM (
+               SELECT COUNT(*) AS n
+               FROM email_outbox_recipients r
+               WHERE r.address IN (SELECT jsonb_array_elements_text(sqlc.arg('recipients')::jsonb))
+                 AND r.created_at > NOW() - make_interval(secs => sqlc.arg('window_seconds')::integer)
+               GROUP BY r.address
+           ) per_address
+       ) AS recipient
+FROM email_outbox
+WHERE created_at > NOW() - make_interval(secs => sqlc.arg('window_seconds')::integer);
+
+-- name: ClaimOutboxEmails :many
+UPDATE email_outbox
+SET status = 'sending',
+    attempts = attempts + 1,
+    locked_until = NOW() + make_interval(secs => sqlc.arg('lease_seconds')::integer)
+WHERE id IN (
+    SELECT id
+    FROM email_outbox
+    WHERE (status = 'pending' AND next_attempt_at <= NOW())
+       OR (status = 'sending' AND locked_until < NOW())
+    ORDER BY next_attempt_at ASC, id ASC
+    LIMIT sqlc.arg('batch_size')::integer
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkOutboxEmailSent :exec
+UPDATE email_outbox
+SET status = 'sent', sent_at = NOW(), locked_until = NULL, last_error = NULL
+WHERE id = $1;
+
+-- name: MarkOutboxEmailFailed :exec
+UPDATE email_outbox
+SET status = $2, last_error = $3, next_attempt_at = $4, locked_until = NULL
+WHERE id = $1;
+
+-- name: ListOutboxEmails :many
+SELECT id, idempotency_key, to_address, subject, status, attempts, last_error,
+       next_attempt_at, sent_at, created_at, delivery_status, delivery_detail, delivery_updated_at,
+       attachment_count
+FROM email_outbox
+WHERE company_id = sqlc.arg('company_id')::integer
+  AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status')::text)
+  AND (sqlc.narg('cursor_id')::integer IS NULL OR id < sqlc.narg('cursor_id')::integer)
+ORDER BY id DESC
+LIMIT sqlc.arg('page_limit')::integer;
+
+-- name: GetOutboxEmail :one
+SELECT id, idempotency_key, to_address, subject, status, attempts, last_error,
+       next_attempt_at, sent_at, created_at, delivery_status, delivery_detail, delivery_updated_at,
+       attachment_count
+FROM email_outbox
+WHERE id = sqlc.arg('id') AND company_id = sqlc.arg('company_id')::integer;
+
+-- name: RetryOutboxEmail :execrows
+UPDATE email_outbox
+SET status = 'pending', attempts = 0, next_attempt_at = NOW(), last_error = NULL
+WHERE id = sqlc.arg('id') AND company_id = sqlc.arg('company_id')::integer AND status = 'dead';
+
+-- name: DeleteSentOutboxEmails :execrows
+DELETE FROM email_outbox
+WHERE status = 'sent' AND sent_at < $1;
+
+-- name: ListOutboxAttachments :many
+SELECT name, content_type, content
+FROM email_outbox_attachments
+WHERE email_id = $1
+ORDER BY position;
+
+-- name: SetOutboxDeliveryStatus :exec
+-- Events can arrive out of order, so a status never replaces a more severe one
+UPDATE email_outbox
+SET delivery_status = sqlc.arg('delivery_status')::text,
+    delivery_detail = sqlc.narg('delivery_detail'),
+    delivery_updated_at = sqlc.arg('occurred_at')::timestamp
+WHERE id = sqlc.arg('id')
+  AND (delivery_status IS NULL
+       OR array_position(ARRAY['soft_bounced', 'delivered', 'bounced', 'complained'], delivery_status::text)
+          <= array_position(ARRAY['soft_bounced', 'delivered', 'bounced', 'complained'], sqlc.arg('delivery_status')::text));
+
+-- name: SuppressEmail :exec
+INSERT INTO email_suppressions (email, reason, detail)
+VALUES ($1, $2, $3)
+ON CONFLICT (email) DO UPDATE
+SET reason = EXCLUDED.reason, detail = EXCLUDED.detail, created_at = NOW();
+
+-- name: GetEmailSuppression :one
+SELECT email, reason, detail, created_at
+FROM email_suppressions
+WHERE email = $1;
+
+-- name: DeleteEmailSuppression :execrows
+DELETE FROM email_suppressions
+WHERE email = $1;
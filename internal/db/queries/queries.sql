@@ -1,26 +1,52 @@
 -- name: GetUserByEmail :one
-SELECT id, email, name, created_at
+-- Emails are stored normalized to lower case, but accounts created before that may not be,
+-- so the match ignores case (served by users_email_lower_id_idx). Should two such accounts
+-- differ only in case, the oldest wins.
+SELECT id, email, name, locale, phone, created_at
 FROM users
-WHERE email = $1 AND deleted_at IS NULL;
+WHERE lower(email) = lower(sqlc.arg('email')::text) AND deleted_at IS NULL
+ORDER BY id
+LIMIT 1;
 
 -- name: GetUserCompanies :many
+-- Direct memberships plus subsidiaries reachable through them: admins of a parent
+-- are admins of every subsidiary, other members only follow subsidiaries that
+-- inherit memberships.
+WITH RECURSIVE access AS (
+    SELECT 
+        uc.company_id,
+        (
+            COALESCE(uc.is_admin, FALSE)
+            OR EXISTS (
+                SELECT 1
+                FROM team_members tm
+                JOIN teams t ON t.id = tm.team_id
+                WHERE tm.user_id = uc.user_id AND t.company_id = uc.company_id AND t.role = 'admin'
+            )
+        ) AS is_admin,
+        uc.created_at,
+        FALSE AS inherited,
+        1 AS depth
+    FROM user_companies uc
+    WHERE uc.user_id = $1 AND uc.active
+    UNION ALL
+    SELECT 
+        child.id,
+        a.is_admin,
+        a.created_at,
+        TRUE,
+        a.depth + 1
+    FROM access a
+    JOIN companies child ON child.parent_id = a.company_id
+    WHERE (a.is_admin OR child.inherit_memberships) AND a.depth < 10
+)
 SELECT 
     c.id as company_id,
     c.name as company_name,
-    uc.is_admin,
-    uc.created_at
-FROM user_companies uc
-JOIN companies c ON c.id = uc.company_id
-WHERE uc.user_id = $1
-ORDER BY uc.created_at ASC;
-
--- name: GetDefaultUserCompany :one
-SELECT 
-    c.id as company_id,
-    c.name as company_name,
-    uc.is_admin
-FROM user_companies uc
-JOIN companies c ON c.id = uc.company_id
-WHERE uc.user_id = $1
-ORDER BY uc.created_at ASC
-LIMIT 1;
+    c.parent_id,
+    bool_or(a.is_admin)::boolean AS is_admin,
+    bool_and(a.inherited)::boolean AS inherited
+FROM access a
+JOIN companies c ON c.id = a.company_id
+GROUP BY c.id, c.name, c.parent_id
+ORDER BY MIN(a.created_at) ASC NULLS LAST, c.id ASC;
@@ -0,0 +1,104 @@
+-- name: CreateScimToken :one
+INSERT INTO scim_tokens (company_id, description, token_hash)
+VALUES ($1, $2, $3)
+RETURNING id, description, created_at;
+
+-- name: ListScimTokens :many
+SELECT id, description, created_at, last_used_at
+FROM scim_tokens
+WHERE company_id = $1 AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: RevokeScimToken :execrows
+UPDATE scim_tokens
+SET revoked_at = NOW()
+WHERE id = $1 AND company_id = $2 AND revoked_at IS NULL;
+
+-- name: GetScimTokenByHash :one
+SELECT id, company_id
+FROM scim_tokens
+WHERE token_hash = $1 AND revoked_at IS NULL;
+
+-- name: TouchScimToken :exec
+UPDATE scim_tokens
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: ListScimUsers :many
+SELECT 
+    u.id,
+    u.email,
+    u.name,
+    u.version,
+    u.created_at,
+    u.updated_at,
+    uc.is_admin,
+    uc.active,
+    uc.external_id
+FROM users u
+JOIN user_companies uc ON u.id = uc.user_id
+WHERE uc.company_id = $1 AND u.deleted_at IS NULL
+ORDER BY u.id ASC;
+
+-- name: ListScimUsersPage :many
+-- A page of company members in id order, optionally narrowed to a userName or externalId.
+-- after_id lets callers walk the company in batches.
+SELECT 
+    u.id,
+    u.email,
+    u.name,
+    u.version,
+    u.created_at,
+    u.updated_at,
+    uc.is_admin,
+    uc.active,
+    uc.external_id
+FROM users u
+JOIN user_companies uc ON u.id = uc.user_id
+WHERE uc.company_id = sqlc.arg('company_id')
+  AND u.deleted_at IS NULL
+  AND u.id > sqlc.arg('after_id')::int
+  AND (sqlc.narg('email')::text IS NULL OR lower(u.email) = lower(sqlc.narg('email')::text))
+  AND (sqlc.narg('external_id')::text IS NULL OR uc.external_id = sqlc.narg('external_id')::text)
+ORDER BY u.id ASC
+LIMIT sqlc.arg('page_limit')::int OFFSET sqlc.arg('page_offset')::int;
+
+-- name: CountScimUsers :one
+SELECT COUNT(*)
+FROM users u
+JOIN user_companies uc ON u.id = uc.user_id
+WHERE uc.company_id = sqlc.arg('company_id')
+  AND u.deleted_at IS NULL
+  AND (sqlc.narg('email')::text IS NULL OR lower(u.email) = lower(sqlc.narg('email')::text))
+  AND (sqlc.narg('external_id')::text IS NULL OR uc.external_id = sqlc.narg('external_id')::text);
+
+-- name: GetScimUser :one
+SELECT 
+    u.id,
+    u.email,
+    u.name,
+    u.version,
+    u.created_at,
+    u.updated_at,
+    uc.is_admin,
+    uc.active,
+    uc.external_id
+FROM users u
+JOIN user_companies uc ON u.id = uc.user_id
+WHERE u.id = $1 AND uc.company_id = $2 AND u.deleted_at IS NULL;
+
+-- name: SetScimMembership :exec
+UPDATE user_companies
+SET active = $3, external_id = $4
+WHERE user_id = $1 AND company_id = $2;
+
+-- name: RemoveUserFromCompany :execrows
+WITH removed_team_members AS (
+    DELETE FROM team_members
+    USING teams
+    WHERE team_members.team_id = teams.id
+      AND team_members.user_id = sqlc.arg('user_id')
+      AND teams.company_id = sqlc.arg('company_id')
+)
+DELETE FROM user_companies
+WHERE user_companies.user_id = sqlc.arg('user_id') AND user_companies.company_id = sqlc.arg('company_id');
@@ -0,0 +1,19 @@
+-- Only overridden settings are stored; defaults live in the settings registry in the API.
+
+-- name: ListCompanySettings :many
+SELECT key, value, updated_by, updated_at
+FROM company_settings
+WHERE company_id = $1
+ORDER BY key ASC;
+
+-- name: UpsertCompanySetting :exec
+INSERT INTO company_settings (company_id, key, value, updated_by)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (company_id, key) DO UPDATE
+SET value = EXCLUDED.value,
+    updated_by = EXCLUDED.updated_by,
+    updated_at = NOW();
+
+-- name: DeleteCompanySetting :exec
+DELETE FROM company_settings
+WHERE company_id = $1 AND key = $2;
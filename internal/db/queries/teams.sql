@@ -0,0 +1,62 @@
+-- name: CreateTeam :one
+INSERT INTO teams (company_id, name, description, role)
+VALUES ($1, $2, $3, $4)
+RETURNING id, name, description, role, created_at, updated_at;
+
+-- name: ListTeams :many
+SELECT 
+    t.id,
+    t.name,
+    t.description,
+    t.role,
+    t.created_at,
+    t.updated_at,
+    (
+        SELECT COUNT(*)
+        FROM team_members tm
+        JOIN users u ON u.id = tm.user_id
+        WHERE tm.team_id = t.id AND u.deleted_at IS NULL
+    ) AS member_count
+FROM teams t
+WHERE t.company_id = $1
+ORDER BY lower(t.name) ASC, t.id ASC;
+
+-- name: GetTeam :one
+SELECT id, name, description, role, created_at, updated_at
+FROM teams
+WHERE id = $1 AND company_id = $2;
+
+-- name: UpdateTeam :one
+UPDATE teams
+SET
+    name = COALESCE(sqlc.narg('name'), name),
+    description = COALESCE(sqlc.narg('description'), description),
+    role = COALESCE(sqlc.narg('role'), role),
+    updated_at = NOW()
+WHERE id = sqlc.arg('id') AND company_id = sqlc.arg('company_id')
+RETURNING id, name, description, role, created_at, updated_at;
+
+-- name: DeleteTeam :execrows
+DELETE FROM teams
+WHERE id = $1 AND company_id = $2;
+
+-- name: ListTeamMembers :many
+SELECT 
+    u.id,
+    u.email,
+    u.name,
+    tm.created_at AS added_at
+FROM team_members tm
+JOIN teams t ON t.id = tm.team_id
+JOIN users u ON u.id = tm.user_id
+WHERE tm.team_id = $1 AND t.company_id = $2 AND u.deleted_at IS NULL
+ORDER BY lower(u.name) ASC, u.id ASC;
+
+-- name: AddTeamMember :exec
+INSERT INTO team_members (team_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveTeamMember :execrows
+DELETE FROM team_members
+WHERE team_id = $1 AND user_id = $2;
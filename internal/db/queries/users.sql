@@ -8,17 +8,7 @@ UPDATE users
 SET deleted_at = NOW()
 WHERE id = $1 AND deleted_at IS NULL;
 
--- name: ListUsers :many
-SELECT 
-    u.id,
-    u.email,
-    u.name,
-    u.created_at,
-    uc.is_admin
-FROM users u
-JOIN user_companies uc ON u.id = uc.user_id
-WHERE uc.company_id = $1 AND u.deleted_at IS NULL
-ORDER BY u.created_at DESC;
+-- Member listings (ListUsersBy*) are generated into users_list.sql by scripts/gen-list-users.sh.
 
 -- name: CreateUser :one
 INSERT INTO users (email, name)
@@ -34,4 +24,68 @@ SELECT EXISTS (
     SELECT 1 
     FROM user_companies 
     WHERE user_id = $1 AND company_id = $2
-);
\ No newline at end of file
+);
+-- name: UserInOtherCompanies :one
+-- Accounts shared with other companies keep their profile under the user's own control
+SELECT EXISTS (
+    SELECT 1
+    FROM user_companies
+    WHERE user_id = $1 AND company_id <> $2
+);
+
+-- name: GetUserProfile :one
+SELECT id, email, name, timezone, locale, phone, version, created_at, updated_at
+FROM users
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetUserLocale :one
+SELECT locale FROM users WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET
+    name = COALESCE(sqlc.narg('name'), name),
+    timezone = COALESCE(sqlc.narg('timezone'), timezone),
+    -- An empty locale clears the preference
+    locale = CASE WHEN sqlc.narg('locale')::text IS NULL THEN locale ELSE NULLIF(sqlc.narg('locale')::text, '') END,
+    version = version + 1,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id') AND version = sqlc.arg('version') AND deleted_at IS NULL
+RETURNING id, email, name, timezone, locale, phone, version, created_at, updated_at;
+
+-- name: SetUserPhone :one
+-- Phones are only stored once verified; a NULL phone removes it
+UPDATE users
+SET phone = sqlc.narg('phone'),
+    phone_verified_at = CASE WHEN sqlc.narg('phone')::text IS NULL THEN NULL ELSE NOW() END,
+    version = version + 1,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id') AND deleted_at IS NULL
+RETURNING id, email, name, timezone, locale, phone, version, created_at, updated_at;
+
+-- name: GetCompanyUser :one
+SELECT 
+    u.id,
+    u.email,
+    u.name,
+    u.version,
+    u.created_at,
+    uc.is_admin
+FROM users u
+JOIN user_companies uc ON u.id = uc.user_id
+WHERE u.id = $1 AND uc.company_id = $2 AND u.deleted_at IS NULL;
+
+-- name: SetUserCompanyAdmin :exec
+UPDATE user_companies
+SET is_admin = $3
+WHERE user_id = $1 AND company_id = $2;
+
+-- name: GetUserDefaultCompanyID :one
+SELECT default_company_id
+FROM users
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: SetUserDefaultCompany :exec
+UPDATE users
+SET default_company_id = $2
+WHERE id = $1;
@@ -2,18 +2,48 @@ package internal
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net/http"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 )
 
-// EmailService handles email operations using ZeptoMail API
-type EmailService struct {
-	apiKey      string
-	fromAddress string
-	client      *http.Client
+// Email transports selectable with EMAIL_TRANSPORT
+const (
+	EmailTransportZeptoMail = "zeptomail"
+	EmailTransportSMTP      = "smtp"
+	EmailTransportFile      = "file"
+	EmailTransportMemory    = "memory"
+	EmailTransportMailbox   = "mailbox" // dev only, browsable at /dev/mailbox
+	EmailTransportLog       = "log"
+)
+
+// Limits on a single email. ZeptoMail accepts at most 15 MB per email, which the
+// attachments stay below after base64 encoding.
+const (
+	MaxEmailRecipients     = 50       // To, Cc and Bcc together
+	MaxEmailAttachmentSize = 10 << 20 // all attachments together, in bytes
+)
+
+// reservedEmailHeaders are built from the message fields and cannot be set in Headers
+var reservedEmailHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Reply-To": true, "Subject": true,
+	"Date": true, "Message-Id": true, "Mime-Version": true, "Content-Type": true,
+	"Content-Transfer-Encoding": true, "Content-Disposition": true,
 }
 
 // EmailAddress represents an email address with optional name
@@ -22,105 +52,290 @@ type EmailAddress struct {
 	Name    string `json:"name,omitempty"`
 }
 
-// EmailRecipient represents a recipient with email address
-type EmailRecipient struct {
-	EmailAddress EmailAddress `json:"email_address"`
+// Attachment is a file attached to an email
+type Attachment struct {
+	Name        string // file name shown to recipients
+	ContentType string // detected from the name and content when empty
+	Data        []byte
 }
 
-// EmailRequest represents the request payload for ZeptoMail API
-type EmailRequest struct {
-	From     EmailAddress     `json:"from"`
-	To       []EmailRecipient `json:"to"`
-	Subject  string           `json:"subject"`
-	HTMLBody string           `json:"htmlbody"`
+// contentType returns the attachment's media type, detecting it when it is not set
+func (a Attachment) contentType() string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+	if t := mime.TypeByExtension(filepath.Ext(a.Name)); t != "" {
+		return t
+	}
+	return http.DetectContentType(a.Data)
 }
 
-// EmailResponse represents the response from ZeptoMail API
-type EmailResponse struct {
-	Data []struct {
-		Code    string `json:"code"`
-		Status  string `json:"status"`
-		Message string `json:"message"`
-	} `json:"data"`
-	Message string `json:"message"`
+// EmailMessage is a single outgoing email
+type EmailMessage struct {
+	To       string
+	ToName   string
+	ExtraTo  []EmailAddress // further To recipients, optional
+	Cc       []EmailAddress
+	Bcc      []EmailAddress
+	From     string // sender address; the transport's configured address when empty
+	FromName string // sender display name, optional
+	ReplyTo  string // optional
+	Subject  string
+	HTMLBody string
+	TextBody string // plain-text alternative, optional
+	// Headers are extra headers such as List-Unsubscribe; the headers built from the
+	// other fields cannot be overridden
+	Headers     map[string]string
+	Attachments []Attachment
+	// Reference identifies the message in delivery webhooks; transports that support it
+	// send it along and the provider echoes it back
+	Reference string
 }
 
-// NewEmailService creates a new email service instance
-func NewEmailService(apiKey, fromAddress string) *EmailService {
-	return &EmailService{
-		apiKey:      apiKey,
-		fromAddress: fromAddress,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+// sender returns the message's sender address, or def when it sets none
+func (m EmailMessage) sender(def string) string {
+	if m.From != "" {
+		return m.From
 	}
+	return def
+}
+
+// toAddresses returns the message's To recipients
+func (m EmailMessage) toAddresses() []EmailAddress {
+	return append([]EmailAddress{{Address: m.To, Name: m.ToName}}, m.ExtraTo...)
 }
 
-// SendEmail sends an email using ZeptoMail API
-func (e *EmailService) SendEmail(to, toName, subject, htmlBody string) error {
-	// If no API key is configured, log the email instead of sending
-	if e.apiKey == "" {
-		log.Printf("EMAIL WOULD BE SENT TO: %s (%s)", to, toName)
-		log.Printf("SUBJECT: %s", subject)
-		log.Printf("BODY: %s", htmlBody)
-		return nil
+// recipients returns the addresses of every recipient, Bcc included
+func (m EmailMessage) recipients() []string {
+	var all []string
+	for _, list := range [][]EmailAddress{m.toAddresses(), m.Cc, m.Bcc} {
+		for _, a := range list {
+			all = append(all, a.Address)
+		}
 	}
+	return all
+}
 
-	emailReq := EmailRequest{
-		From: EmailAddress{
-			Address: e.fromAddress,
-		},
-		To: []EmailRecipient{
-			{
-				EmailAddress: EmailAddress{
-					Address: to,
-					Name:    toName,
-				},
-			},
-		},
-		Subject:  subject,
-		HTMLBody: htmlBody,
+// Validate checks the message's recipients, headers and attachments against what every
+// transport can deliver
+func (m EmailMessage) Validate() error {
+	if m.To == "" {
+		return fmt.Errorf("email has no recipient")
+	}
+	recipients := m.recipients()
+	if len(recipients) > MaxEmailRecipients {
+		return fmt.Errorf("email has %d recipients, at most %d are allowed", len(recipients), MaxEmailRecipients)
+	}
+	for _, address := range recipients {
+		if a, err := mail.ParseAddress(address); err != nil || a.Address != address {
+			return fmt.Errorf("invalid recipient address %q", address)
+		}
+	}
+	for name, value := range m.Headers {
+		if name == "" || strings.ContainsAny(name, ": \t\r\n") || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid email header %q", name)
+		}
+		if reservedEmailHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			return fmt.Errorf("email header %q cannot be set directly", name)
+		}
+	}
+	size := 0
+	for _, a := range m.Attachments {
+		if a.Name == "" || strings.ContainsAny(a.Name, "/\\\r\n") {
+			return fmt.Errorf("invalid attachment name %q", a.Name)
+		}
+		size += len(a.Data)
 	}
+	if size > MaxEmailAttachmentSize {
+		return fmt.Errorf("attachments total %d bytes, at most %d are allowed", size, MaxEmailAttachmentSize)
+	}
+	return nil
+}
 
-	jsonData, err := json.Marshal(emailReq)
-	if err != nil {
-		return fmt.Errorf("failed to marshal email request: %w", err)
+// Mailer delivers email through one transport
+type Mailer interface {
+	Send(ctx context.Context, msg EmailMessage) error
+}
+
+// NewMailer creates the mailer for the configured transport. Without EMAIL_TRANSPORT,
+// ZeptoMail is used when an API key is set and emails are logged otherwise.
+func NewMailer(cfg Config) Mailer {
+	switch cfg.emailTransport() {
+	case EmailTransportZeptoMail:
+		return NewZeptoMailMailer(cfg.EmailAPIKey, cfg.EmailFromAddress)
+	case EmailTransportSMTP:
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			StartTLS: cfg.SMTPStartTLS,
+			From:     cfg.EmailFromAddress,
+		}
+	case EmailTransportFile:
+		return &FileMailer{Dir: cfg.EmailFileDir, From: cfg.EmailFromAddress}
+	case EmailTransportMemory:
+		return &MemoryMailer{}
+	case EmailTransportMailbox:
+		return &Mailbox{From: cfg.EmailFromAddress}
+	default:
+		return LogMailer{}
 	}
+}
 
-	req, err := http.NewRequest("POST", "https://api.zeptomail.com/v1.1/email", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+// LogMailer writes emails to the log instead of sending them
+type LogMailer struct{}
+
+// Send logs the email
+func (LogMailer) Send(ctx context.Context, msg EmailMessage) error {
+	log.Printf("EMAIL WOULD BE SENT TO: %s (%s)", msg.To, msg.ToName)
+	if len(msg.ExtraTo) > 0 || len(msg.Cc) > 0 || len(msg.Bcc) > 0 {
+		log.Printf("ALSO TO: %s, CC: %s, BCC: %s", formatAddressList(msg.ExtraTo), formatAddressList(msg.Cc), formatAddressList(msg.Bcc))
 	}
+	if msg.From != "" || msg.FromName != "" || msg.ReplyTo != "" {
+		log.Printf("FROM: %s (%s), REPLY-TO: %s", msg.From, msg.FromName, msg.ReplyTo)
+	}
+	log.Printf("SUBJECT: %s", msg.Subject)
+	log.Printf("BODY: %s", msg.HTMLBody)
+	if msg.TextBody != "" {
+		log.Printf("TEXT: %s", msg.TextBody)
+	}
+	for _, a := range msg.Attachments {
+		log.Printf("ATTACHMENT: %s (%s, %d bytes)", a.Name, a.contentType(), len(a.Data))
+	}
+	return nil
+}
 
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Zoho-enczapikey "+e.apiKey)
+// formatAddressList formats addresses for an address list header
+func formatAddressList(addresses []EmailAddress) string {
+	formatted := make([]string, len(addresses))
+	for i, a := range addresses {
+		formatted[i] = (&mail.Address{Name: a.Name, Address: a.Address}).String()
+	}
+	return strings.Join(formatted, ", ")
+}
 
-	resp, err := e.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send email request: %w", err)
+// buildMIME renders msg as an RFC 5322 message sent from msg's sender or from. With a text
+// body the body is multipart/alternative, otherwise a single quoted-printable HTML part.
+// Attachments wrap the body in multipart/mixed. Bcc recipients are left out of the headers.
+func buildMIME(from string, msg EmailMessage, date time.Time) []byte {
+	from = msg.sender(from)
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", (&mail.Address{Name: msg.FromName, Address: from}).String())
+	header("To", formatAddressList(msg.toAddresses()))
+	if len(msg.Cc) > 0 {
+		header("Cc", formatAddressList(msg.Cc))
+	}
+	if msg.ReplyTo != "" {
+		header("Reply-To", (&mail.Address{Address: msg.ReplyTo}).String())
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", newMessageID(from))
+	for _, name := range slices.Sorted(maps.Keys(msg.Headers)) {
+		header(textproto.CanonicalMIMEHeaderKey(name), mime.QEncoding.Encode("utf-8", msg.Headers[name]))
 	}
-	defer resp.Body.Close()
+	header("MIME-Version", "1.0")
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		var emailResp EmailResponse
-		if err := json.NewDecoder(resp.Body).Decode(&emailResp); err == nil {
-			return fmt.Errorf("email API error (status %d): %s", resp.StatusCode, emailResp.Message)
+	body, content := mimeBody(msg)
+	if len(msg.Attachments) == 0 {
+		for _, name := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			if v := body.Get(name); v != "" {
+				header(name, v)
+			}
 		}
-		return fmt.Errorf("email API error with status: %d", resp.StatusCode)
+		buf.WriteString("\r\n")
+		buf.Write(content)
+		return buf.Bytes()
 	}
 
-	var emailResp EmailResponse
-	if err := json.NewDecoder(resp.Body).Decode(&emailResp); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}))
+	buf.WriteString("\r\n")
+	w, _ := mw.CreatePart(body)
+	w.Write(content)
+	for _, a := range msg.Attachments {
+		w, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachmentMediaType(a)},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		writeBase64(w, a.Data)
 	}
+	mw.Close()
+	return buf.Bytes()
+}
 
-	// Check if there are any errors in the response data
-	for _, data := range emailResp.Data {
-		if data.Status != "success" {
-			return fmt.Errorf("email send failed: %s", data.Message)
-		}
+// mimeBody renders the text and HTML bodies of msg as one MIME entity
+func mimeBody(msg EmailMessage) (textproto.MIMEHeader, []byte) {
+	var buf bytes.Buffer
+	if msg.TextBody == "" {
+		writeQuotedPrintable(&buf, msg.HTMLBody)
+		return textproto.MIMEHeader{
+			"Content-Type":              {`text/html; charset="utf-8"`},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}, buf.Bytes()
 	}
 
-	return nil
+	mw := multipart.NewWriter(&buf)
+	// Clients show the last part they support, so the HTML part goes last
+	for _, part := range []struct{ contentType, body string }{
+		{`text/plain; charset="utf-8"`, msg.TextBody},
+		{`text/html; charset="utf-8"`, msg.HTMLBody},
+	} {
+		w, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		writeQuotedPrintable(w, part.body)
+	}
+	mw.Close()
+	return textproto.MIMEHeader{
+		"Content-Type": {mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()})},
+	}, buf.Bytes()
+}
+
+// attachmentMediaType returns the Content-Type of an attachment part, carrying its name for
+// clients that ignore Content-Disposition
+func attachmentMediaType(a Attachment) string {
+	mediaType, params, err := mime.ParseMediaType(a.contentType())
+	if err != nil {
+		mediaType, params = "application/octet-stream", nil
+	}
+	if params == nil {
+		params = map[string]string{}
+	}
+	params["name"] = a.Name
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// writeQuotedPrintable writes s to w in quoted-printable encoding
+func writeQuotedPrintable(w io.Writer, s string) {
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(s))
+	qp.Close()
+}
+
+// writeBase64 writes data to w in base64 with the 76 character lines MIME requires
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
+
+// newMessageID returns a unique Message-ID in the sender's domain
+func newMessageID(from string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 && i < len(from)-1 {
+		domain = from[i+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
 }
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"time"
+
+	"project/internal/db/sqlc"
+)
+
+// Scopes of the email send budgets
+const (
+	EmailBudgetGlobal    = "global"
+	EmailBudgetCompany   = "company"
+	EmailBudgetRecipient = "recipient"
+)
+
+// EmailBudgetWindow is the period the send budgets count queued emails over
+const EmailBudgetWindow = time.Hour
+
+// emailMetrics counts queued and refused emails; served with the other expvars
+var emailMetrics = expvar.NewMap("email")
+
+// EmailBudgetError is returned by EnqueueEmail when a send budget is used up
+type EmailBudgetError struct {
+	Scope string // EmailBudgetGlobal, EmailBudgetCompany or EmailBudgetRecipient
+	Limit int    // emails per EmailBudgetWindow
+}
+
+func (e *EmailBudgetError) Error() string {
+	return fmt.Sprintf("%s email budget of %d per hour exhausted", e.Scope, e.Limit)
+}
+
+// EmailUsage is how many emails were queued in the current budget window
+type EmailUsage struct {
+	Total     int64
+	Company   int64
+	Recipient int64
+}
+
+// RecentEmailUsage counts the emails queued in the last EmailBudgetWindow, overall, for a
+// company and for the busiest of the recipient addresses
+func RecentEmailUsage(ctx context.Context, q *sqlc.Queries, companyID int32, recipients []string) (EmailUsage, error) {
+	row, err := q.CountRecentEmails(ctx, &sqlc.CountRecentEmailsParams{
+		WindowSeconds: int32(EmailBudgetWindow / time.Second),
+		CompanyID:     companyID,
+		Recipients:    jsonList(budgetRecipients(recipients)),
+	})
+	if err != nil {
+		return EmailUsage{}, err
+	}
+	return EmailUsage{Total: row.Total, Company: row.Company, Recipient: row.Recipient}, nil
+}
+
+// budgetRecipients returns the distinct normalized addresses the recipient budget counts
+func budgetRecipients(addresses []string) []string {
+	seen := make(map[string]bool, len(addresses))
+	var out []string
+	for _, a := range addresses {
+		a = NormalizeEmail(a)
+		if a == "" || seen[a] {
+			continue
+		}
+		seen[a] = true
+		out = append(out, a)
+	}
+	return out
+}
+
+// checkEmailBudget returns an EmailBudgetError when e would exceed a send budget. Emails
+// queued concurrently can overshoot a budget slightly; it bounds abuse, not exact counts.
+func (a *App) checkEmailBudget(ctx context.Context, q *sqlc.Queries, e OutboxEmail) error {
+	if e.Essential {
+		return nil
+	}
+	usage, err := RecentEmailUsage(ctx, q, e.CompanyID, e.Message.recipients())
+	if err != nil {
+		return err
+	}
+	exceeded := a.exceededEmailBudget(usage, e)
+	if exceeded == nil {
+		return nil
+	}
+	emailMetrics.Add("refused_"+exceeded.Scope, 1)
+	a.alertEmailBudget(ctx, exceeded, e.CompanyID)
+	return exceeded
+}
+
+// exceededEmailBudget returns the budget that one more email would exceed, checking the
+// narrowest scope first, or nil
+func (a *App) exceededEmailBudget(usage EmailUsage, e OutboxEmail) *EmailBudgetError {
+	switch {
+	case a.Cfg.RecipientLimit > 0 && usage.Recipient >= int64(a.Cfg.RecipientLimit):
+		return &EmailBudgetError{Scope: EmailBudgetRecipient, Limit: a.Cfg.RecipientLimit}
+	case e.RecipientBudgetOnly:
+		return nil
+	case e.CompanyID != 0 && e.CompanyLimit > 0 && usage.Company >= int64(e.CompanyLimit):
+		return &EmailBudgetError{Scope: EmailBudgetCompany, Limit: e.CompanyLimit}
+	case a.Cfg.EmailHourlyLimit > 0 && usage.Total >= int64(a.Cfg.EmailHourlyLimit):
+		return &EmailBudgetError{Scope: EmailBudgetGlobal, Limit: a.Cfg.EmailHourlyLimit}
+	}
+	return nil
+}
+
+// alertEmailBudget reports an exhausted global or company budget once per window: in the
+// log, and in the audit log of the company. Recipient throttling is expected under attack
+// and only counted.
+func (a *App) alertEmailBudget(ctx context.Context, exceeded *EmailBudgetError, companyID int32) {
+	if exceeded.Scope == EmailBudgetRecipient {
+		return
+	}
+	key := "email_budget_alert:" + exceeded.Scope
+	if exceeded.Scope == EmailBudgetCompany {
+		key = fmt.Sprintf("%s:%d", key, companyID)
+	}
+	if _, alerted := a.CacheGet(key); alerted {
+		return
+	}
+	a.CacheSet(key, true, EmailBudgetWindow)
+	emailMetrics.Add("alerts", 1)
+
+	if exceeded.Scope == EmailBudgetGlobal {
+		log.Printf("ALERT: %v, emails are being refused", exceeded)
+		return
+	}
+	log.Printf("ALERT: %v for company %d, its emails are being refused", exceeded, companyID)
+	after, _ := json.Marshal(map[string]any{"scope": exceeded.Scope, "limit": exceeded.Limit})
+	if err := a.Audit.Append(ctx, AuditRecord{
+		CompanyID:  companyID,
+		ActorType:  "system",
+		Action:     "email.budget_exhausted",
+		TargetType: "company",
+		TargetID:   companyID,
+		After:      after,
+	}); err != nil {
+		log.Printf("email budget: record audit event for company %d: %v", companyID, err)
+	}
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"context"
+	"expvar"
+	"strings"
+	"testing"
+)
+
+func TestExceededEmailBudget(t *testing.T) {
+	app := &App{Cfg: Config{EmailHourlyLimit: 100, RecipientLimit: 5}}
+	company := OutboxEmail{CompanyID: 7, CompanyLimit: 20}
+	loginOTP := OutboxEmail{CompanyID: 7, CompanyLimit: 20, RecipientBudgetOnly: true}
+
+	tests := []struct {
+		name  string
+		usage EmailUsage
+		email OutboxEmail
+		want  string
+	}{
+		{"within budgets", EmailUsage{Total: 99, Company: 19, Recipient: 4}, company, ""},
+		{"recipient throttled first", EmailUsage{Total: 100, Company: 20, Recipient: 5}, company, EmailBudgetRecipient},
+		{"company budget", EmailUsage{Total: 100, Company: 20, Recipient: 1}, company, EmailBudgetCompany},
+		{"global budget", EmailUsage{Total: 100, Company: 3, Recipient: 1}, company, EmailBudgetGlobal},
+		{"no company budget without company", EmailUsage{Total: 50, Company: 50}, OutboxEmail{CompanyLimit: 20}, ""},
+		{"login OTP skips company and global budgets", EmailUsage{Total: 100, Company: 20, Recipient: 4}, loginOTP, ""},
+		{"login OTP keeps recipient budget", EmailUsage{Total: 0, Company: 0, Recipient: 5}, loginOTP, EmailBudgetRecipient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := app.exceededEmailBudget(tt.usage, tt.email)
+			switch {
+			case tt.want == "" && got != nil:
+				t.Errorf("expected no budget to be exceeded, got %v", got)
+			case tt.want != "" && (got == nil || got.Scope != tt.want):
+				t.Errorf("expected the %s budget to be exceeded, got %v", tt.want, got)
+			}
+		})
+	}
+
+	unlimited := &App{}
+	if got := unlimited.exceededEmailBudget(EmailUsage{Total: 1e6, Recipient: 1e6}, OutboxEmail{}); got != nil {
+		t.Errorf("zero limits must disable the budgets, got %v", got)
+	}
+}
+
+func TestBudgetRecipients(t *testing.T) {
+	msg := EmailMessage{
+		To:      "Jane@Example.com",
+		ExtraTo: []EmailAddress{{Address: "bob@example.com"}},
+		Cc:      []EmailAddress{{Address: " jane@example.com "}},
+		Bcc:     []EmailAddress{{Address: "audit@example.com"}},
+	}
+	got := budgetRecipients(msg.recipients())
+	want := []string{"jane@example.com", "bob@example.com", "audit@example.com"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("budgetRecipients() = %v, want %v", got, want)
+	}
+	if got := string(jsonList(budgetRecipients(nil))); got != "[]" {
+		t.Errorf("expected no recipients to marshal as [], got %s", got)
+	}
+}
+
+func TestEssentialEmailsSkipBudgets(t *testing.T) {
+	// Without a database any usage lookup would fail
+	app := &App{Cfg: Config{EmailHourlyLimit: 1, RecipientLimit: 1}}
+	if err := app.checkEmailBudget(context.Background(), nil, OutboxEmail{Essential: true}); err != nil {
+		t.Errorf("checkEmailBudget() error = %v", err)
+	}
+}
+
+// emailMetric returns the current value of an email counter
+func emailMetric(name string) int64 {
+	if v, ok := emailMetrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestAlertEmailBudgetOncePerWindow(t *testing.T) {
+	app := NewApp(Config{EmailTransport: EmailTransportMemory}, nil)
+	start := emailMetric("alerts")
+
+	exceeded := &EmailBudgetError{Scope: EmailBudgetGlobal, Limit: 1}
+	app.alertEmailBudget(context.Background(), exceeded, 0)
+	app.alertEmailBudget(context.Background(), exceeded, 0)
+	app.alertEmailBudget(context.Background(), &EmailBudgetError{Scope: EmailBudgetRecipient, Limit: 1}, 0)
+
+	if got := emailMetric("alerts") - start; got != 1 {
+		t.Errorf("expected 1 alert, got %d", got)
+	}
+}
@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/internal/db/sqlc"
+)
+
+// Delivery statuses reported by the email provider, from least to most severe
+const (
+	DeliverySoftBounce = "soft_bounced"
+	DeliveryDelivered  = "delivered"
+	DeliveryHardBounce = "bounced"
+	DeliveryComplaint  = "complained"
+)
+
+// webhookTolerance bounds the age of a signed webhook so recorded requests cannot be replayed
+const webhookTolerance = 5 * time.Minute
+
+// outboxReferencePrefix marks the references of outbox emails
+const outboxReferencePrefix = "outbox:"
+
+// ErrInvalidSignature is returned for webhooks that are unsigned, stale or signed with
+// another secret
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// DeliveryEvent is the provider's report on one sent email
+type DeliveryEvent struct {
+	Status     string // one of the Delivery* statuses
+	Reference  string // EmailMessage.Reference of the email, empty when it had none
+	Recipient  string
+	Detail     string // bounce reason or diagnostic, optional
+	OccurredAt time.Time
+}
+
+// outboxReference returns the reference sent with an outbox email
+func outboxReference(id int32) string {
+	return outboxReferencePrefix + strconv.Itoa(int(id))
+}
+
+// outboxID returns the outbox email a reference points to
+func outboxID(reference string) (int32, bool) {
+	s, ok := strings.CutPrefix(reference, outboxReferencePrefix)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return int32(id), true
+}
+
+// NormalizeEmail returns the form addresses are suppressed under
+func NormalizeEmail(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// VerifyWebhookSignature checks a ZeptoMail producer-signature header of the form
+// "ts=<unix millis>;s=<base64 HMAC-SHA256 of ts and body>;s-algorithm=HmacSHA256"
+func VerifyWebhookSignature(secret, header string, body []byte, now time.Time) error {
+	if secret == "" {
+		return ErrInvalidSignature
+	}
+	var ts, sig string
+	for _, part := range strings.Split(header, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "ts":
+			ts = v
+		case "s":
+			sig = v
+		case "s-algorithm":
+			if v != "HmacSHA256" {
+				return ErrInvalidSignature
+			}
+		}
+	}
+	millis, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.UnixMilli(millis)); age > webhookTolerance || age < -webhookTolerance {
+		return ErrInvalidSignature
+	}
+	got, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal(got, webhookMAC(secret, ts, body)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SignWebhook returns the producer-signature header for body, as the provider sends it
+func SignWebhook(secret string, body []byte, now time.Time) string {
+	ts := strconv.FormatInt(now.UnixMilli(), 10)
+	return fmt.Sprintf("ts=%s;s=%s;s-algorithm=HmacSHA256", ts, base64.StdEncoding.EncodeToString(webhookMAC(secret, ts, body)))
+}
+
+func webhookMAC(secret, ts string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// zeptoMailStatuses maps ZeptoMail webhook events to delivery statuses; opens and clicks
+// are not delivery events and are ignored
+var zeptoMailStatuses = map[string]string{
+	"softbounce":   DeliverySoftBounce,
+	"delivered":    DeliveryDelivered,
+	"hardbounce":   DeliveryHardBounce,
+	"feedbackloop": DeliveryComplaint,
+}
+
+// zeptoMailWebhook is the part of a ZeptoMail webhook payload that reports delivery
+type zeptoMailWebhook struct {
+	EventName    []string `json:"event_name"`
+	EventMessage []struct {
+		EmailInfo struct {
+			ClientReference string           `json:"client_reference"`
+			To              []EmailRecipient `json:"to"`
+			ProcessedTime   string           `json:"processed_time"`
+		} `json:"email_info"`
+		EventData []struct {
+			Object  string `json:"object"`
+			Details []struct {
+				Reason            string `json:"reason"`
+				BouncedRecipient  string `json:"bounced_recipient"`
+				Time              string `json:"time"`
+				DiagnosticMessage string `json:"diagnostic_message"`
+			} `json:"details"`
+		} `json:"event_data"`
+	} `json:"event_message"`
+}
+
+// zeptoMailTimeLayouts are the timestamp formats seen in ZeptoMail webhooks
+var zeptoMailTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.000-0700", "2006-01-02T15:04:05-0700"}
+
+func parseZeptoMailTime(s string, def time.Time) time.Time {
+	for _, layout := range zeptoMailTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return def
+}
+
+// ParseZeptoMailWebhook extracts the delivery events from a ZeptoMail webhook payload.
+// Events that do not report delivery are skipped; received is used when a event carries
+// no timestamp.
+func ParseZeptoMailWebhook(body []byte, received time.Time) ([]DeliveryEvent, error) {
+	var payload zeptoMailWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	var events []DeliveryEvent
+	for _, msg := range payload.EventMessage {
+		info := msg.EmailInfo
+		sentAt := parseZeptoMailTime(info.ProcessedTime, received)
+		for _, data := range msg.EventData {
+			status, ok := zeptoMailStatuses[data.Object]
+			if !ok {
+				continue
+			}
+			if len(data.Details) == 0 {
+				for _, to := range info.To {
+					events = append(events, DeliveryEvent{
+						Status:     status,
+						Reference:  info.ClientReference,
+						Recipient:  to.EmailAddress.Address,
+						OccurredAt: sentAt,
+					})
+				}
+				continue
+			}
+			for _, d := range data.Details {
+				recipient := d.BouncedRecipient
+				if recipient == "" && len(info.To) > 0 {
+					recipient = info.To[0].EmailAddress.Address
+				}
+				detail := d.Reason
+				if d.DiagnosticMessage != "" {
+					detail = strings.TrimPrefix(detail+": "+d.DiagnosticMessage, ": ")
+				}
+				events = append(events, DeliveryEvent{
+					Status:     status,
+					Reference:  info.ClientReference,
+					Recipient:  recipient,
+					Detail:     detail,
+					OccurredAt: parseZeptoMailTime(d.Time, sentAt),
+				})
+			}
+		}
+	}
+	return events, nil
+}
+
+// RecordDeliveryEvent stores the delivery status of the outbox email an event reports on
+// and suppresses recipients that hard-bounced or complained. Recording the same event
+// twice is harmless, so providers may retry.
+func (a *App) RecordDeliveryEvent(ctx context.Context, e DeliveryEvent) error {
+	detail := sql.NullString{String: e.Detail, Valid: e.Detail != ""}
+	return a.WithTx(ctx, func(tx *Tx) error {
+		if id, ok := outboxID(e.Reference); ok {
+			if err := tx.SetOutboxDeliveryStatus(ctx, &sqlc.SetOutboxDeliveryStatusParams{
+				DeliveryStatus: e.Status,
+				DeliveryDetail: detail,
+				OccurredAt:     e.OccurredAt,
+				ID:             id,
+			}); err != nil {
+				return err
+			}
+		}
+		if (e.Status != DeliveryHardBounce && e.Status != DeliveryComplaint) || e.Recipient == "" {
+			return nil
+		}
+		return tx.SuppressEmail(ctx, &sqlc.SuppressEmailParams{
+			Email:  NormalizeEmail(e.Recipient),
+			Reason: e.Status,
+			Detail: detail,
+		})
+	})
+}
+
+// EmailSuppression returns why address no longer receives email, or "" if it does
+func EmailSuppression(ctx context.Context, q *sqlc.Queries, address string) (string, error) {
+	s, err := q.GetEmailSuppression(ctx, NormalizeEmail(address))
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return s.Reason, nil
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseZeptoMailWebhook(t *testing.T) {
+	received := time.Date(2025, 9, 24, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		file string
+		want []DeliveryEvent
+	}{
+		{"hardbounce.json", []DeliveryEvent{{
+			Status:     DeliveryHardBounce,
+			Reference:  "outbox:42",
+			Recipient:  "Jane.Doe@example.org",
+			Detail:     "Mailbox does not exist: 550 5.1.1 <Jane.Doe@example.org>: Recipient address rejected: User unknown",
+			OccurredAt: time.Date(2025, 9, 24, 9, 15, 4, 871000000, time.UTC),
+		}}},
+		{"softbounce.json", []DeliveryEvent{{
+			Status:     DeliverySoftBounce,
+			Reference:  "outbox:43",
+			Recipient:  "john@example.net",
+			Detail:     "Mailbox full: 452 4.2.2 The email account that you tried to reach is over quota",
+			OccurredAt: time.Date(2025, 9, 24, 9, 30, 13, 552000000, time.UTC),
+		}}},
+		{"feedbackloop.json", []DeliveryEvent{{
+			Status:     DeliveryComplaint,
+			Reference:  "outbox:45",
+			Recipient:  "spam.reporter@example.com",
+			OccurredAt: time.Date(2025, 9, 24, 9, 46, 55, 731000000, time.UTC),
+		}}},
+		{"open.json", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata", "zeptomail", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			events, err := ParseZeptoMailWebhook(body, received)
+			if err != nil {
+				t.Fatalf("ParseZeptoMailWebhook() error = %v", err)
+			}
+			if len(events) != len(tt.want) {
+				t.Fatalf("got %d events %+v, want %d", len(events), events, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got := events[i]; got != want {
+					t.Errorf("event %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+
+	if _, err := ParseZeptoMailWebhook([]byte("not json"), received); err == nil {
+		t.Error("expected an error for an invalid payload")
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"event_name":["hardbounce"]}`)
+	now := time.Now()
+	valid := SignWebhook("secret", body, now)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		ok     bool
+	}{
+		{"valid", "secret", valid, body, true},
+		{"wrong secret", "other", valid, body, false},
+		{"tampered body", "secret", valid, []byte(`{"event_name":["delivered"]}`), false},
+		{"stale", "secret", SignWebhook("secret", body, now.Add(-10*time.Minute)), body, false},
+		{"other algorithm", "secret", valid + ";s-algorithm=HmacSHA1", body, false},
+		{"missing", "secret", "", body, false},
+		{"no secret configured", "", SignWebhook("", body, now), body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(tt.secret, tt.header, tt.body, now)
+			if tt.ok && err != nil {
+				t.Errorf("expected a valid signature, got %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("expected ErrInvalidSignature, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOutboxReference(t *testing.T) {
+	if id, ok := outboxID(outboxReference(42)); !ok || id != 42 {
+		t.Errorf("outboxID(outboxReference(42)) = %d, %v", id, ok)
+	}
+	for _, ref := range []string{"", "42", "outbox:", "outbox:abc", "outbox:-1", "invite:42"} {
+		if _, ok := outboxID(ref); ok {
+			t.Errorf("outboxID(%q) should not match", ref)
+		}
+	}
+}
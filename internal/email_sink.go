@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer writes each email as an .eml file into Dir, for local development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes the email to a new file named after the send time
+func (f *FileMailer) Send(ctx context.Context, msg EmailMessage) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	now := time.Now()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000Z"), hex.EncodeToString(suffix))
+	if err := os.WriteFile(filepath.Join(f.Dir, name), buildMIME(f.From, msg, now), 0o600); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return nil
+}
+
+// MemoryMailer records emails in memory so tests can inspect them
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []EmailMessage
+}
+
+// Send records the email
+func (m *MemoryMailer) Send(ctx context.Context, msg EmailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Messages returns the emails sent so far, oldest first
+func (m *MemoryMailer) Messages() []EmailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]EmailMessage(nil), m.sent...)
+}
+
+// Reset forgets all recorded emails
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = nil
+}
+
+// MailboxSize is how many emails the dev mailbox keeps; older ones are dropped
+const MailboxSize = 200
+
+// MailboxMessage is an email captured by the Mailbox
+type MailboxMessage struct {
+	ID         int
+	ReceivedAt time.Time
+	EmailMessage
+}
+
+// Mailbox keeps the most recent emails in memory so developers can read them at
+// /dev/mailbox instead of in the log. It is only available in the dev environment.
+type Mailbox struct {
+	From string // sender of emails that set none
+
+	mu     sync.Mutex
+	nextID int
+	msgs   []MailboxMessage
+}
+
+// Send validates and captures the email
+func (m *Mailbox) Send(ctx context.Context, msg EmailMessage) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	msg.From = msg.sender(m.From)
+	// Record the content type each transport would send
+	attachments := make([]Attachment, len(msg.Attachments))
+	for i, a := range msg.Attachments {
+		a.ContentType = a.contentType()
+		attachments[i] = a
+	}
+	msg.Attachments = attachments
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	m.msgs = append(m.msgs, MailboxMessage{ID: m.nextID, ReceivedAt: time.Now(), EmailMessage: msg})
+	if len(m.msgs) > MailboxSize {
+		m.msgs = append([]MailboxMessage(nil), m.msgs[len(m.msgs)-MailboxSize:]...)
+	}
+	return nil
+}
+
+// Messages returns the captured emails, newest first
+func (m *Mailbox) Messages() []MailboxMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msgs := make([]MailboxMessage, len(m.msgs))
+	for i, msg := range m.msgs {
+		msgs[len(m.msgs)-1-i] = msg
+	}
+	return msgs
+}
+
+// Message returns the captured email with id, if it is still kept
+func (m *Mailbox) Message(id int) (MailboxMessage, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, msg := range m.msgs {
+		if msg.ID == id {
+			return msg, true
+		}
+	}
+	return MailboxMessage{}, false
+}
+
+// Clear drops all captured emails
+func (m *Mailbox) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.msgs = nil
+}
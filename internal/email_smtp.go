@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// smtpTimeout bounds a whole SMTP conversation when the context has no deadline
+const smtpTimeout = 30 * time.Second
+
+// SMTPMailer sends email through an SMTP server. STARTTLS is used whenever the server
+// offers it; with StartTLS set, servers that do not offer it are refused.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	StartTLS bool
+	From     string
+
+	// TLSConfig overrides the STARTTLS configuration, e.g. to trust a private CA
+	TLSConfig *tls.Config
+}
+
+// Send delivers the email to the SMTP server
+func (s *SMTPMailer) Send(ctx context.Context, msg EmailMessage) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start smtp session: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		cfg := &tls.Config{ServerName: s.Host}
+		if s.TLSConfig != nil {
+			cfg = s.TLSConfig.Clone()
+		}
+		if err := c.StartTLS(cfg); err != nil {
+			return fmt.Errorf("smtp starttls failed: %w", err)
+		}
+	} else if s.StartTLS {
+		return fmt.Errorf("smtp server %s does not support STARTTLS", addr)
+	}
+
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("smtp authentication failed: %w", err)
+		}
+	}
+
+	if err := c.Mail(msg.sender(s.From)); err != nil {
+		return fmt.Errorf("smtp MAIL FROM rejected: %w", err)
+	}
+	for _, rcpt := range msg.recipients() {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s rejected: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA rejected: %w", err)
+	}
+	if _, err := w.Write(buildMIME(s.From, msg, time.Now())); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp server rejected email: %w", err)
+	}
+	return c.Quit()
+}
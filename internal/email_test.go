@@ -1,19 +1,34 @@
 package internal
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEmailServiceStatusCodes(t *testing.T) {
 	// Test the core logic of status code validation
 	// This tests the fix for the "email API error (status 201): OK" issue
-	
+
 	// Test that both 200 and 201 are considered success status codes
 	successCodes := []int{http.StatusOK, http.StatusCreated}
 	errorCodes := []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError}
-	
+
 	for _, code := range successCodes {
 		t.Run(fmt.Sprintf("Status %d should be considered success", code), func(t *testing.T) {
 			// Test the condition logic from the fixed code
@@ -23,7 +38,7 @@ func TestEmailServiceStatusCodes(t *testing.T) {
 			}
 		})
 	}
-	
+
 	for _, code := range errorCodes {
 		t.Run(fmt.Sprintf("Status %d should be considered error", code), func(t *testing.T) {
 			// Test the condition logic from the fixed code
@@ -35,36 +50,530 @@ func TestEmailServiceStatusCodes(t *testing.T) {
 	}
 }
 
-func TestEmailServiceWithoutAPIKey(t *testing.T) {
-	// Test that email service works without API key (logs instead of sending)
-	emailService := NewEmailService("", "test@example.com")
-	
-	err := emailService.SendEmail("recipient@example.com", "Test User", "Test Subject", "<p>Test Body</p>")
-	
+func TestNewMailerTransports(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"no api key logs", Config{}, "internal.LogMailer"},
+		{"api key uses zeptomail", Config{EmailAPIKey: "key"}, "*internal.ZeptoMailMailer"},
+		{"smtp", Config{EmailTransport: EmailTransportSMTP, SMTPHost: "mail.example.com"}, "*internal.SMTPMailer"},
+		{"file", Config{EmailTransport: EmailTransportFile, EmailFileDir: "mail"}, "*internal.FileMailer"},
+		{"memory overrides api key", Config{EmailTransport: EmailTransportMemory, EmailAPIKey: "key"}, "*internal.MemoryMailer"},
+		{"dev logs by default", Config{Environment: "dev"}, "internal.LogMailer"},
+		{"mailbox", Config{Environment: "dev", EmailTransport: EmailTransportMailbox}, "*internal.Mailbox"},
+		{"dev with api key uses zeptomail", Config{Environment: "dev", EmailAPIKey: "key"}, "*internal.ZeptoMailMailer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmt.Sprintf("%T", NewMailer(tt.cfg)); got != tt.want {
+				t.Errorf("NewMailer() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZeptoMailMailerSend(t *testing.T) {
+	var got EmailRequest
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"data":[{"code":"EM_104","status":"success","message":"OK"}],"message":"OK"}`))
+	}))
+	defer srv.Close()
+
+	m := NewZeptoMailMailer("test-api-key", "noreply@example.com")
+	m.endpoint = srv.URL
+	err := m.Send(context.Background(), EmailMessage{To: "jane@example.com", ToName: "Jane", Subject: "Hi", HTMLBody: "<p>Hi</p>"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if auth != "Zoho-enczapikey test-api-key" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if got.From.Address != "noreply@example.com" || len(got.To) != 1 || got.To[0].EmailAddress.Address != "jane@example.com" || got.HTMLBody != "<p>Hi</p>" {
+		t.Errorf("unexpected request payload: %+v", got)
+	}
+}
+
+func TestZeptoMailMailerSenderIdentity(t *testing.T) {
+	var got EmailRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"data":[{"status":"success"}]}`))
+	}))
+	defer srv.Close()
+
+	m := NewZeptoMailMailer("test-api-key", "noreply@example.com")
+	m.endpoint = srv.URL
+	err := m.Send(context.Background(), EmailMessage{
+		To: "jane@example.com", From: "hello@acme.com", FromName: "Acme", ReplyTo: "support@acme.com", Subject: "Hi",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got.From != (EmailAddress{Address: "hello@acme.com", Name: "Acme"}) {
+		t.Errorf("From = %+v", got.From)
+	}
+	if len(got.ReplyTo) != 1 || got.ReplyTo[0].Address != "support@acme.com" {
+		t.Errorf("ReplyTo = %+v", got.ReplyTo)
+	}
+}
+
+func TestZeptoMailMailerRecipientsAndAttachments(t *testing.T) {
+	var got EmailRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"data":[{"status":"success"}]}`))
+	}))
+	defer srv.Close()
+
+	m := NewZeptoMailMailer("test-api-key", "noreply@example.com")
+	m.endpoint = srv.URL
+	err := m.Send(context.Background(), EmailMessage{
+		To:          "jane@example.com",
+		ExtraTo:     []EmailAddress{{Address: "john@example.com", Name: "John"}},
+		Cc:          []EmailAddress{{Address: "finance@example.com"}},
+		Bcc:         []EmailAddress{{Address: "archive@example.com"}},
+		Subject:     "Invoice",
+		Headers:     map[string]string{"X-Invoice-Id": "INV-1"},
+		Attachments: []Attachment{{Name: "invoice.pdf", Data: []byte("%PDF-1.7")}},
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if len(got.To) != 2 || got.To[1].EmailAddress != (EmailAddress{Address: "john@example.com", Name: "John"}) {
+		t.Errorf("To = %+v", got.To)
+	}
+	if len(got.Cc) != 1 || got.Cc[0].EmailAddress.Address != "finance@example.com" || len(got.Bcc) != 1 || got.Bcc[0].EmailAddress.Address != "archive@example.com" {
+		t.Errorf("Cc = %+v, Bcc = %+v", got.Cc, got.Bcc)
+	}
+	if got.MimeHeaders["X-Invoice-Id"] != "INV-1" {
+		t.Errorf("MimeHeaders = %+v", got.MimeHeaders)
+	}
+	want := EmailAttachment{Content: "JVBERi0xLjc=", MimeType: "application/pdf", Name: "invoice.pdf"}
+	if len(got.Attachments) != 1 || got.Attachments[0] != want {
+		t.Errorf("Attachments = %+v, want %+v", got.Attachments, want)
+	}
+}
+
+func TestZeptoMailMailerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message":"Invalid API Token"}`))
+	}))
+	defer srv.Close()
+
+	m := NewZeptoMailMailer("bad-key", "noreply@example.com")
+	m.endpoint = srv.URL
+	err := m.Send(context.Background(), EmailMessage{To: "jane@example.com", Subject: "Hi"})
+	if err == nil || !strings.Contains(err.Error(), "Invalid API Token") {
+		t.Errorf("Send() error = %v, want API error", err)
+	}
+}
+
+// smtpSession is what the test SMTP server received
+type smtpSession struct {
+	auth, from, data string
+	rcpts            []string
+}
+
+// startTestSMTPServer runs a minimal SMTP server for one session and reports what it received
+func startTestSMTPServer(t *testing.T, extensions ...string) (int, <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	done := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { fmt.Fprintf(conn, "%s\r\n", s) }
+
+		var sess smtpSession
+		reply("220 localhost ESMTP test")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				done <- sess
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch cmd {
+			case "EHLO":
+				reply("250-localhost")
+				for _, ext := range extensions {
+					reply("250-" + ext)
+				}
+				reply("250 8BITMIME")
+			case "AUTH":
+				sess.auth = line
+				reply("235 2.7.0 Authentication successful")
+			case "MAIL":
+				sess.from = line
+				reply("250 OK")
+			case "RCPT":
+				sess.rcpts = append(sess.rcpts, line)
+				reply("250 OK")
+			case "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var b strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					b.WriteString(l)
+				}
+				sess.data = b.String()
+				reply("250 OK queued")
+			case "QUIT":
+				reply("221 Bye")
+				done <- sess
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, done
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	port, done := startTestSMTPServer(t, "AUTH PLAIN")
+
+	m := &SMTPMailer{Host: "127.0.0.1", Port: port, Username: "mailer", Password: "secret", From: "noreply@example.com"}
+	err := m.Send(context.Background(), EmailMessage{To: "jane@example.com", ToName: "Jane Doe", Subject: "Your OTP Code", HTMLBody: "<p>123456</p>"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	sess := <-done
+	if !strings.HasPrefix(sess.auth, "AUTH PLAIN ") {
+		t.Errorf("expected AUTH PLAIN, got %q", sess.auth)
+	}
+	if sess.from != "MAIL FROM:<noreply@example.com> BODY=8BITMIME" && sess.from != "MAIL FROM:<noreply@example.com>" {
+		t.Errorf("MAIL = %q", sess.from)
+	}
+	if len(sess.rcpts) != 1 || sess.rcpts[0] != "RCPT TO:<jane@example.com>" {
+		t.Errorf("RCPT = %q", sess.rcpts)
+	}
+	for _, want := range []string{"To: \"Jane Doe\" <jane@example.com>\r\n", "Subject: Your OTP Code\r\n", "Content-Type: text/html", "<p>123456</p>"} {
+		if !strings.Contains(sess.data, want) {
+			t.Errorf("message missing %q:\n%s", want, sess.data)
+		}
+	}
+}
+
+func TestSMTPMailerSendsToAllRecipients(t *testing.T) {
+	port, done := startTestSMTPServer(t)
+
+	m := &SMTPMailer{Host: "127.0.0.1", Port: port, From: "noreply@example.com"}
+	err := m.Send(context.Background(), EmailMessage{
+		To:      "jane@example.com",
+		ExtraTo: []EmailAddress{{Address: "john@example.com"}},
+		Cc:      []EmailAddress{{Address: "finance@example.com"}},
+		Bcc:     []EmailAddress{{Address: "archive@example.com"}},
+		Subject: "Invoice",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	sess := <-done
+	want := []string{"RCPT TO:<jane@example.com>", "RCPT TO:<john@example.com>", "RCPT TO:<finance@example.com>", "RCPT TO:<archive@example.com>"}
+	if strings.Join(sess.rcpts, "\n") != strings.Join(want, "\n") {
+		t.Errorf("RCPT = %q, want %q", sess.rcpts, want)
+	}
+	if strings.Contains(sess.data, "archive@example.com") {
+		t.Errorf("Bcc recipient leaked into the message:\n%s", sess.data)
+	}
+}
+
+func TestSMTPMailerRequiresStartTLS(t *testing.T) {
+	port, _ := startTestSMTPServer(t)
+
+	m := &SMTPMailer{Host: "127.0.0.1", Port: port, StartTLS: true, From: "noreply@example.com"}
+	err := m.Send(context.Background(), EmailMessage{To: "jane@example.com", Subject: "Hi"})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Send() error = %v, want STARTTLS error", err)
+	}
+}
+
+func TestFileMailerWritesEML(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := &FileMailer{Dir: dir, From: "noreply@example.com"}
+	for i := 0; i < 2; i++ {
+		if err := m.Send(context.Background(), EmailMessage{To: "jane@example.com", Subject: "Grüße", HTMLBody: "<p>Hi</p>"}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected 2 .eml files, got %v (%v)", files, err)
+	}
+	b, err := os.ReadFile(files[0])
 	if err != nil {
-		t.Errorf("Expected no error when API key is empty, but got: %v", err)
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=\r\n") {
+		t.Errorf("expected encoded subject, got:\n%s", b)
+	}
+}
+
+func TestMemoryMailerRecords(t *testing.T) {
+	m := &MemoryMailer{}
+	m.Send(context.Background(), EmailMessage{To: "a@example.com"})
+	m.Send(context.Background(), EmailMessage{To: "b@example.com"})
+
+	msgs := m.Messages()
+	if len(msgs) != 2 || msgs[0].To != "a@example.com" || msgs[1].To != "b@example.com" {
+		t.Errorf("Messages() = %+v", msgs)
+	}
+	m.Reset()
+	if len(m.Messages()) != 0 {
+		t.Error("expected no messages after Reset")
+	}
+}
+
+func TestMailboxKeepsRecentMessages(t *testing.T) {
+	m := &Mailbox{From: "noreply@example.com"}
+	err := m.Send(context.Background(), EmailMessage{
+		To:          "jane@example.com",
+		Subject:     "Hi",
+		Attachments: []Attachment{{Name: "report.pdf", Data: []byte("%PDF-1.4")}},
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if err := m.Send(context.Background(), EmailMessage{Subject: "no recipient"}); err == nil {
+		t.Error("expected invalid emails to be rejected")
+	}
+
+	first, ok := m.Message(1)
+	if !ok || first.From != "noreply@example.com" || first.Attachments[0].ContentType != "application/pdf" {
+		t.Errorf("Message(1) = %+v, %v", first, ok)
+	}
+
+	for i := 0; i < MailboxSize; i++ {
+		m.Send(context.Background(), EmailMessage{To: fmt.Sprintf("user%d@example.com", i)})
+	}
+	msgs := m.Messages()
+	if len(msgs) != MailboxSize || msgs[0].ID != MailboxSize+1 || msgs[len(msgs)-1].ID != 2 {
+		t.Errorf("expected the newest %d messages newest first, got IDs %d to %d", MailboxSize, msgs[0].ID, msgs[len(msgs)-1].ID)
+	}
+	if _, ok := m.Message(1); ok {
+		t.Error("expected the oldest message to be dropped")
+	}
+
+	m.Clear()
+	if len(m.Messages()) != 0 {
+		t.Error("expected no messages after Clear")
 	}
 }
 
-func TestNewEmailService(t *testing.T) {
-	apiKey := "test-api-key"
-	fromAddress := "test@example.com"
-	
-	service := NewEmailService(apiKey, fromAddress)
-	
-	if service == nil {
-		t.Fatal("Expected non-nil email service")
+func TestBuildMIMEMultipartAlternative(t *testing.T) {
+	raw := buildMIME("noreply@example.com", EmailMessage{
+		To:       "jane@example.com",
+		Subject:  "Hi",
+		HTMLBody: "<p>Hi Jane</p>",
+		TextBody: "Hi Jane\n",
+	}, time.Now())
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
 	}
-	
-	if service.apiKey != apiKey {
-		t.Errorf("Expected API key %q, got %q", apiKey, service.apiKey)
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v)", msg.Header.Get("Content-Type"), err)
 	}
-	
-	if service.fromAddress != fromAddress {
-		t.Errorf("Expected from address %q, got %q", fromAddress, service.fromAddress)
+
+	var types, bodies []string
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(p) // quoted-printable is decoded by the reader
+		types = append(types, strings.SplitN(p.Header.Get("Content-Type"), ";", 2)[0])
+		bodies = append(bodies, string(b))
+	}
+	if len(types) != 2 || types[0] != "text/plain" || types[1] != "text/html" {
+		t.Fatalf("part types = %v", types)
+	}
+	if bodies[0] != "Hi Jane\r\n" || bodies[1] != "<p>Hi Jane</p>" {
+		t.Errorf("part bodies = %q", bodies)
+	}
+}
+
+func TestBuildMIMESenderIdentity(t *testing.T) {
+	raw := buildMIME("noreply@example.com", EmailMessage{
+		To:       "jane@example.com",
+		From:     "hello@acme.com",
+		FromName: "Acme Support",
+		ReplyTo:  "support@acme.com",
+		Subject:  "Hi",
+		HTMLBody: "<p>Hi</p>",
+	}, time.Now())
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if got := msg.Header.Get("From"); got != `"Acme Support" <hello@acme.com>` {
+		t.Errorf("From = %q", got)
+	}
+	if got := msg.Header.Get("Reply-To"); got != "<support@acme.com>" {
+		t.Errorf("Reply-To = %q", got)
+	}
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@acme.com>") {
+		t.Errorf("Message-ID = %q, want it in the sender's domain", msg.Header.Get("Message-ID"))
+	}
+
+	raw = buildMIME("noreply@example.com", EmailMessage{To: "jane@example.com", Subject: "Hi"}, time.Now())
+	if msg, _ = mail.ReadMessage(bytes.NewReader(raw)); msg.Header.Get("From") != "<noreply@example.com>" || msg.Header.Get("Reply-To") != "" {
+		t.Errorf("Expected the default sender and no Reply-To, got From %q Reply-To %q", msg.Header.Get("From"), msg.Header.Get("Reply-To"))
+	}
+}
+
+func TestBuildMIMEAttachments(t *testing.T) {
+	raw := buildMIME("noreply@example.com", EmailMessage{
+		To:       "jane@example.com",
+		ExtraTo:  []EmailAddress{{Address: "john@example.com", Name: "John"}},
+		Cc:       []EmailAddress{{Address: "finance@example.com"}},
+		Bcc:      []EmailAddress{{Address: "archive@example.com"}},
+		Subject:  "Export",
+		HTMLBody: "<p>Your export</p>",
+		TextBody: "Your export\n",
+		Headers:  map[string]string{"x-export-id": "42"},
+		Attachments: []Attachment{
+			{Name: "users.csv", ContentType: "text/csv", Data: []byte("id,email\n1,jane@example.com\n")},
+			{Name: "Übersicht.pdf", Data: bytes.Repeat([]byte("%PDF"), 100)},
+		},
+	}, time.Now())
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if got := msg.Header.Get("To"); got != `<jane@example.com>, "John" <john@example.com>` {
+		t.Errorf("To = %q", got)
+	}
+	if got := msg.Header.Get("Cc"); got != "<finance@example.com>" {
+		t.Errorf("Cc = %q", got)
+	}
+	if msg.Header.Get("Bcc") != "" {
+		t.Error("Bcc must not appear in the headers")
+	}
+	if got := msg.Header.Get("X-Export-Id"); got != "42" {
+		t.Errorf("X-Export-Id = %q", got)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q (%v)", msg.Header.Get("Content-Type"), err)
+	}
+
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	body, err := r.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(body.Header.Get("Content-Type"), "multipart/alternative;") {
+		t.Errorf("body Content-Type = %q", body.Header.Get("Content-Type"))
+	}
+
+	for _, want := range []struct{ name, contentType, data string }{
+		{"users.csv", "text/csv", "id,email\n1,jane@example.com\n"},
+		{"Übersicht.pdf", "application/pdf", strings.Repeat("%PDF", 100)},
+	} {
+		p, err := r.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.FileName() != want.name {
+			t.Errorf("FileName() = %q, want %q", p.FileName(), want.name)
+		}
+		if ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type")); ct != want.contentType {
+			t.Errorf("%s Content-Type = %q, want %q", want.name, ct, want.contentType)
+		}
+		b, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, p))
+		if err != nil || string(b) != want.data {
+			t.Errorf("%s content = %q (%v)", want.name, b, err)
+		}
+	}
+	if _, err := r.NextPart(); err != io.EOF {
+		t.Errorf("expected no further parts, got %v", err)
+	}
+}
+
+func TestEmailMessageValidate(t *testing.T) {
+	many := make([]EmailAddress, MaxEmailRecipients)
+	for i := range many {
+		many[i] = EmailAddress{Address: fmt.Sprintf("user%d@example.com", i)}
+	}
+	tests := []struct {
+		name string
+		msg  EmailMessage
+		ok   bool
+	}{
+		{"minimal", EmailMessage{To: "jane@example.com"}, true},
+		{"no recipient", EmailMessage{}, false},
+		{"invalid cc", EmailMessage{To: "jane@example.com", Cc: []EmailAddress{{Address: "not an address"}}}, false},
+		{"too many recipients", EmailMessage{To: "jane@example.com", Bcc: many}, false},
+		{"custom header", EmailMessage{To: "jane@example.com", Headers: map[string]string{"List-Unsubscribe": "<https://example.com/u>"}}, true},
+		{"reserved header", EmailMessage{To: "jane@example.com", Headers: map[string]string{"subject": "Spoofed"}}, false},
+		{"header injection", EmailMessage{To: "jane@example.com", Headers: map[string]string{"X-Id": "1\r\nBcc: evil@example.com"}}, false},
+		{"attachment without name", EmailMessage{To: "jane@example.com", Attachments: []Attachment{{Data: []byte("x")}}}, false},
+		{"attachment path", EmailMessage{To: "jane@example.com", Attachments: []Attachment{{Name: "../etc/passwd", Data: []byte("x")}}}, false},
+		{"attachments too large", EmailMessage{To: "jane@example.com", Attachments: []Attachment{
+			{Name: "a.bin", Data: make([]byte, MaxEmailAttachmentSize/2+1)},
+			{Name: "b.bin", Data: make([]byte, MaxEmailAttachmentSize/2)},
+		}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.msg.Validate()
+			if tt.ok && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("expected a validation error")
+			}
+		})
+	}
+}
+
+func TestAttachmentContentType(t *testing.T) {
+	tests := []struct {
+		attachment Attachment
+		want       string
+	}{
+		{Attachment{Name: "report.csv", ContentType: "text/csv"}, "text/csv"},
+		{Attachment{Name: "invoice.pdf"}, "application/pdf"},
+		{Attachment{Name: "logo", Data: []byte("\x89PNG\r\n\x1a\n")}, "image/png"},
+		{Attachment{Name: "blob", Data: []byte{0, 1, 2, 3}}, "application/octet-stream"},
 	}
-	
-	if service.client == nil {
-		t.Error("Expected non-nil HTTP client")
+	for _, tt := range tests {
+		if got := tt.attachment.contentType(); got != tt.want {
+			t.Errorf("contentType(%s) = %q, want %q", tt.attachment.Name, got, tt.want)
+		}
 	}
 }
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// zeptoMailEndpoint is the ZeptoMail send API
+const zeptoMailEndpoint = "https://api.zeptomail.com/v1.1/email"
+
+// ZeptoMailMailer sends email using the ZeptoMail API
+type ZeptoMailMailer struct {
+	apiKey      string
+	fromAddress string
+	endpoint    string
+	client      *http.Client
+}
+
+// EmailRecipient represents a recipient with email address
+type EmailRecipient struct {
+	EmailAddress EmailAddress `json:"email_address"`
+}
+
+// EmailAttachment is a file attached to a ZeptoMail email
+type EmailAttachment struct {
+	Content  string `json:"content"` // base64 encoded
+	MimeType string `json:"mime_type"`
+	Name     string `json:"name"`
+}
+
+// EmailRequest represents the request payload for ZeptoMail API
+type EmailRequest struct {
+	From        EmailAddress      `json:"from"`
+	To          []EmailRecipient  `json:"to"`
+	Cc          []EmailRecipient  `json:"cc,omitempty"`
+	Bcc         []EmailRecipient  `json:"bcc,omitempty"`
+	ReplyTo     []EmailAddress    `json:"reply_to,omitempty"`
+	Subject     string            `json:"subject"`
+	HTMLBody    string            `json:"htmlbody"`
+	TextBody    string            `json:"textbody,omitempty"`
+	MimeHeaders map[string]string `json:"mime_headers,omitempty"`
+	Attachments []EmailAttachment `json:"attachments,omitempty"`
+	// ClientReference is echoed back in webhook events about the email
+	ClientReference string `json:"client_reference,omitempty"`
+}
+
+// zeptoMailRecipients converts addresses to ZeptoMail recipients
+func zeptoMailRecipients(addresses []EmailAddress) []EmailRecipient {
+	if len(addresses) == 0 {
+		return nil
+	}
+	recipients := make([]EmailRecipient, len(addresses))
+	for i, a := range addresses {
+		recipients[i] = EmailRecipient{EmailAddress: a}
+	}
+	return recipients
+}
+
+// EmailResponse represents the response from ZeptoMail API
+type EmailResponse struct {
+	Data []struct {
+		Code    string `json:"code"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"data"`
+	Message string `json:"message"`
+}
+
+// NewZeptoMailMailer creates a new ZeptoMail mailer instance
+func NewZeptoMailMailer(apiKey, fromAddress string) *ZeptoMailMailer {
+	return &ZeptoMailMailer{
+		apiKey:      apiKey,
+		fromAddress: fromAddress,
+		endpoint:    zeptoMailEndpoint,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Send sends an email using ZeptoMail API
+func (e *ZeptoMailMailer) Send(ctx context.Context, msg EmailMessage) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	emailReq := EmailRequest{
+		From: EmailAddress{
+			Address: msg.sender(e.fromAddress),
+			Name:    msg.FromName,
+		},
+		To:              zeptoMailRecipients(msg.toAddresses()),
+		Cc:              zeptoMailRecipients(msg.Cc),
+		Bcc:             zeptoMailRecipients(msg.Bcc),
+		Subject:         msg.Subject,
+		HTMLBody:        msg.HTMLBody,
+		TextBody:        msg.TextBody,
+		MimeHeaders:     msg.Headers,
+		ClientReference: msg.Reference,
+	}
+	if msg.ReplyTo != "" {
+		emailReq.ReplyTo = []EmailAddress{{Address: msg.ReplyTo}}
+	}
+	for _, a := range msg.Attachments {
+		emailReq.Attachments = append(emailReq.Attachments, EmailAttachment{
+			Content:  base64.StdEncoding.EncodeToString(a.Data),
+			MimeType: a.contentType(),
+			Name:     a.Name,
+		})
+	}
+
+	jsonData, err := json.Marshal(emailReq)
+	if err != nil {
+		return fmt.Errorf("failed to marshal email request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Zoho-enczapikey "+e.apiKey)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send email request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var emailResp EmailResponse
+		if err := json.NewDecoder(resp.Body).Decode(&emailResp); err == nil {
+			return fmt.Errorf("email API error (status %d): %s", resp.StatusCode, emailResp.Message)
+		}
+		return fmt.Errorf("email API error with status: %d", resp.StatusCode)
+	}
+
+	var emailResp EmailResponse
+	if err := json.NewDecoder(resp.Body).Decode(&emailResp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Check if there are any errors in the response data
+	for _, data := range emailResp.Data {
+		if data.Status != "success" {
+			return fmt.Errorf("email send failed: %s", data.Message)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+// Package emails renders the transactional emails sent to users. Templates are embedded,
+// share a layout and partials, and are auto-escaped by html/template. Their text comes from
+// the i18n catalogs in the recipient's locale. Every email also gets a plain-text
+// alternative generated from its HTML.
+package emails
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"path"
+	"strings"
+
+	"project/internal/i18n"
+)
+
+//go:embed templates
+var files embed.FS
+
+// Template names
+const (
+	OTP          = "otp"
+	Invitation   = "invitation"
+	EmailChanged = "email_changed"
+	Notification = "notification"
+)
+
+// OTP purposes
+const (
+	OTPLogin       = "login"
+	OTPEmailChange = "email_change"
+)
+
+// Colors of unbranded emails
+const (
+	defaultAccent     = "#007bff"
+	defaultHeader     = "#f8f9fa"
+	defaultButtonText = "#ffffff"
+)
+
+// Brand styles the emails of one company. Colors are #rrggbb; empty fields use the defaults.
+type Brand struct {
+	Name            string
+	Color           string // accent color of headings, codes and buttons
+	HeaderColor     string // background of the heading
+	ButtonTextColor string
+	LogoURL         string // shown above the heading, optional
+	Footer          string // replaces the default footer text
+}
+
+// Base holds what every email template uses
+type Base struct {
+	Brand  Brand
+	Name   string // recipient's name; a localized "User" when empty
+	Locale string // catalog locale; i18n.Default when empty or unsupported
+}
+
+func (b Base) locale() string {
+	return i18n.Resolve(b.Locale)
+}
+
+// localized is implemented by every data type through its embedded Base
+type localized interface {
+	locale() string
+}
+
+// OTPData fills the one-time password email
+type OTPData struct {
+	Base
+	Purpose    string // OTPLogin or OTPEmailChange
+	Code       string
+	TTLMinutes int
+}
+
+// InvitationData fills the invitation to join a company
+type InvitationData struct {
+	Base
+	InviterName   string
+	CompanyName   string
+	AcceptURL     string
+	ExpiresInDays int
+}
+
+// EmailChangedData fills the notice sent to the previous address after an email change
+type EmailChangedData struct {
+	Base
+	NewEmail   string
+	RevertURL  string
+	RevertDays int
+}
+
+// NotificationData fills a generic notification with an optional call to action
+type NotificationData struct {
+	Base
+	Title       string
+	Paragraphs  []string
+	ActionURL   string
+	ActionLabel string
+}
+
+// Rendered is a rendered email
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// buttonData is the argument of the button partial
+type buttonData struct {
+	URL       string
+	Label     template.HTML
+	Color     string
+	TextColor string
+}
+
+// funcs are available to every template. t and lang are replaced per render with
+// versions bound to the recipient's locale.
+var funcs = template.FuncMap{
+	"accent": accent,
+	"header": func(b Brand) string { return orDefault(b.HeaderColor, defaultHeader) },
+	"button": func(url string, label any, b Brand) buttonData {
+		return buttonData{URL: url, Label: escape(label), Color: accent(b), TextColor: orDefault(b.ButtonTextColor, defaultButtonText)}
+	},
+	"strong": func(s string) template.HTML {
+		return "<strong>" + template.HTML(template.HTMLEscapeString(s)) + "</strong>"
+	},
+	"t":    translator(i18n.Default),
+	"lang": func() string { return i18n.Default },
+}
+
+// templates maps a template name to the set parsed from it, the layout and the partials
+var templates = mustParse()
+
+func mustParse() map[string]*template.Template {
+	names, err := fs.Glob(files, "templates/*.html")
+	if err != nil {
+		panic(err)
+	}
+	set := make(map[string]*template.Template)
+	for _, file := range names {
+		name := strings.TrimSuffix(path.Base(file), ".html")
+		if name == "layout" {
+			continue
+		}
+		set[name] = template.Must(template.New(name).Funcs(funcs).ParseFS(files,
+			"templates/layout.html", "templates/partials/*.html", file))
+	}
+	return set
+}
+
+// accent returns the brand's accent color or the default one
+func accent(b Brand) string {
+	return orDefault(b.Color, defaultAccent)
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// translator returns the t function for locale. It looks up a catalog message and fills in
+// the arguments, escaping strings so that only markup passed as template.HTML survives.
+func translator(locale string) func(key string, args ...any) template.HTML {
+	return func(key string, args ...any) template.HTML {
+		msg := template.HTMLEscapeString(i18n.Message(locale, key))
+		if len(args) == 0 {
+			return template.HTML(msg)
+		}
+		for i, a := range args {
+			if s, ok := a.(string); ok {
+				args[i] = escape(s)
+			}
+		}
+		return template.HTML(fmt.Sprintf(msg, args...))
+	}
+}
+
+// escape returns v as HTML, escaping it unless it already is template.HTML
+func escape(v any) template.HTML {
+	if h, ok := v.(template.HTML); ok {
+		return h
+	}
+	return template.HTML(template.HTMLEscapeString(fmt.Sprint(v)))
+}
+
+// Render renders the named template with data, which must be the template's data type.
+// The text is in the locale of data's Base.
+func Render(name string, data any) (Rendered, error) {
+	parsed, ok := templates[name]
+	if !ok {
+		return Rendered{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	locale := i18n.Default
+	if l, ok := data.(localized); ok {
+		locale = l.locale()
+	}
+	// The parsed set is never executed itself so it can be cloned for every locale
+	t, err := parsed.Clone()
+	if err != nil {
+		return Rendered{}, fmt.Errorf("clone %s: %w", name, err)
+	}
+	t.Funcs(template.FuncMap{
+		"t":    translator(locale),
+		"lang": func() string { return locale },
+	})
+
+	var subject, body bytes.Buffer
+	if err := t.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Rendered{}, fmt.Errorf("render %s subject: %w", name, err)
+	}
+	if err := t.ExecuteTemplate(&body, "layout", data); err != nil {
+		return Rendered{}, fmt.Errorf("render %s: %w", name, err)
+	}
+
+	return Rendered{
+		// The subject goes into a header, so undo the HTML escaping and keep it on one line
+		Subject: strings.Join(strings.Fields(html.UnescapeString(subject.String())), " "),
+		HTML:    body.String(),
+		Text:    htmlToText(body.String()),
+	}, nil
+}
@@ -0,0 +1,190 @@
+package emails
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderEscapesData(t *testing.T) {
+	r, err := Render(EmailChanged, EmailChangedData{
+		Base:       Base{Name: "<script>alert(1)</script>"},
+		NewEmail:   "new@example.com",
+		RevertURL:  "http://localhost/v1/email/revert?token=a&b",
+		RevertDays: 7,
+	})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	if strings.Contains(r.HTML, "<script>") {
+		t.Error("Expected user name to be escaped")
+	}
+	if !strings.Contains(r.HTML, `href="http://localhost/v1/email/revert?token=a&amp;b"`) {
+		t.Errorf("Expected revert URL to be escaped in the href:\n%s", r.HTML)
+	}
+	if r.Subject != "Your email address was changed" {
+		t.Errorf("Subject = %q", r.Subject)
+	}
+}
+
+func TestRenderRejectsUnsafeValues(t *testing.T) {
+	r, err := Render(Notification, NotificationData{
+		Base:        Base{Brand: Brand{Color: "red;background:url(x)"}},
+		Title:       "Heads up",
+		ActionURL:   "javascript:alert(1)",
+		ActionLabel: "Open",
+	})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if strings.Contains(r.HTML, "javascript:") {
+		t.Error("Expected javascript: URL to be filtered")
+	}
+	if strings.Contains(r.HTML, "url(x)") {
+		t.Error("Expected unsafe CSS to be filtered")
+	}
+}
+
+func TestRenderOTP(t *testing.T) {
+	r, err := Render(OTP, OTPData{
+		Base:       Base{Brand: Brand{Name: "Acme & Co", Color: "#112233"}, Name: "Jane"},
+		Code:       "482913",
+		TTLMinutes: 15,
+	})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	for _, want := range []string{"Acme &amp; Co Verification", "color: #112233", "482913", "expire in 15 minutes"} {
+		if !strings.Contains(r.HTML, want) {
+			t.Errorf("HTML missing %q", want)
+		}
+	}
+	for _, want := range []string{"Acme & Co Verification\n\nHello Jane,", "482913", "- This code will expire in 15 minutes\n- Do not share"} {
+		if !strings.Contains(r.Text, want) {
+			t.Errorf("Text missing %q:\n%s", want, r.Text)
+		}
+	}
+	if strings.Contains(r.Text, "<") || strings.Contains(r.Text, "font-family") {
+		t.Errorf("Text contains markup or styles:\n%s", r.Text)
+	}
+}
+
+func TestRenderInvitationSubject(t *testing.T) {
+	r, err := Render(Invitation, InvitationData{
+		InviterName:   "Tom & Jerry",
+		CompanyName:   "Acme",
+		AcceptURL:     "https://app.example.com/invitations/abc",
+		ExpiresInDays: 7,
+	})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if r.Subject != "Tom & Jerry invited you to join Acme" {
+		t.Errorf("Subject = %q", r.Subject)
+	}
+	if !strings.Contains(r.Text, "Accept invitation (https://app.example.com/invitations/abc)") {
+		t.Errorf("Expected link target in text:\n%s", r.Text)
+	}
+	if !strings.Contains(r.Text, "Hello User,") {
+		t.Errorf("Expected fallback name in text:\n%s", r.Text)
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if _, err := Render("missing", nil); err == nil {
+		t.Error("Expected error for unknown template")
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	got := htmlToText(`<html><head><style>p { color: red }</style></head><body>
+<p>First   line<br>second</p><p>See <a href="https://example.com">the docs</a> and <a href="https://example.com/x">https://example.com/x</a>.</p>
+<ul><li>one</li><li>two</li></ul></body></html>`)
+	want := "First line\nsecond\n\nSee the docs (https://example.com) and https://example.com/x.\n\n- one\n- two\n"
+	if got != want {
+		t.Errorf("htmlToText() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderLocalized(t *testing.T) {
+	r, err := Render(EmailChanged, EmailChangedData{
+		Base:       Base{Name: "Jürgen <J>", Locale: "de"},
+		NewEmail:   "neu@example.com",
+		RevertURL:  "http://localhost/v1/email/revert?token=x",
+		RevertDays: 7,
+	})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	if r.Subject != "Ihre E-Mail-Adresse wurde geändert" {
+		t.Errorf("Subject = %q", r.Subject)
+	}
+	for _, want := range []string{
+		`<html lang="de">`,
+		"Hallo Jürgen &lt;J&gt;,",
+		"in <strong>neu@example.com</strong> geändert",
+		"innerhalb von 7 Tagen",
+		">Änderung rückgängig machen</a>",
+	} {
+		if !strings.Contains(r.HTML, want) {
+			t.Errorf("Expected HTML to contain %q:\n%s", want, r.HTML)
+		}
+	}
+	if !strings.Contains(r.Text, "Änderung rückgängig machen (http://localhost/v1/email/revert?token=x)") {
+		t.Errorf("Expected localized link in the text part:\n%s", r.Text)
+	}
+}
+
+func TestRenderFallsBackToDefaultLocale(t *testing.T) {
+	r, err := Render(OTP, OTPData{Base: Base{Locale: "pt-BR"}, Code: "123456", TTLMinutes: 5})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if r.Subject != "Your OTP Code" || !strings.Contains(r.Text, "Hello User,") {
+		t.Errorf("Expected the English email, got %q:\n%s", r.Subject, r.Text)
+	}
+}
+
+func TestRenderBranding(t *testing.T) {
+	brand := Brand{
+		Name:            "Acme",
+		Color:           "#112233",
+		HeaderColor:     "#445566",
+		ButtonTextColor: "#000000",
+		LogoURL:         "https://cdn.acme.com/logo.png",
+		Footer:          "Acme Inc, 1 Main Street",
+	}
+	r, err := Render(Invitation, InvitationData{
+		Base:          Base{Brand: brand},
+		CompanyName:   "Acme",
+		AcceptURL:     "https://app.acme.com/accept",
+		ExpiresInDays: 7,
+	})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`<img src="https://cdn.acme.com/logo.png" alt="Acme"`,
+		"background-color: #445566",
+		"background-color: #112233; color: #000000",
+		"<p>Acme Inc, 1 Main Street</p>",
+	} {
+		if !strings.Contains(r.HTML, want) {
+			t.Errorf("Expected HTML to contain %q:\n%s", want, r.HTML)
+		}
+	}
+	if strings.Contains(r.HTML, "automated message") {
+		t.Error("Expected the custom footer to replace the default one")
+	}
+
+	r, err = Render(Invitation, InvitationData{Base: Base{Brand: Brand{LogoURL: "javascript:alert(1)"}}, CompanyName: "Acme"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if strings.Contains(r.HTML, "javascript:") {
+		t.Error("Expected unsafe logo URL to be filtered")
+	}
+}
@@ -0,0 +1,117 @@
+package emails
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// blockBreaks is the number of line breaks around block elements
+var blockBreaks = map[atom.Atom]int{
+	atom.P: 2, atom.Div: 2, atom.H1: 2, atom.H2: 2, atom.H3: 2, atom.Ul: 2, atom.Ol: 2, atom.Table: 2,
+	atom.Li: 1, atom.Tr: 1,
+}
+
+// htmlToText renders the visible text of an HTML email. Paragraphs and list items keep
+// their line breaks and links are followed by their target.
+func htmlToText(s string) string {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return ""
+	}
+	var w textWriter
+	w.node(doc)
+	return strings.TrimSpace(w.b.String()) + "\n"
+}
+
+// textWriter collapses whitespace the way a browser would while writing text
+type textWriter struct {
+	b        strings.Builder
+	space    bool // a space is due before the next word
+	newlines int  // line breaks at the end of the output
+}
+
+func (w *textWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+		switch n.DataAtom {
+		case atom.Head, atom.Style, atom.Script:
+			return
+		case atom.Br:
+			w.b.WriteString("\n")
+			w.newlines++
+			w.space = false
+			return
+		case atom.Li:
+			w.lineBreak(1)
+			w.text("- ")
+		}
+	}
+
+	breaks := blockBreaks[n.DataAtom]
+	if n.Type == html.ElementNode && n.DataAtom != atom.Li {
+		w.lineBreak(breaks)
+	}
+	start := w.b.Len()
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+	if n.DataAtom == atom.A {
+		href := attr(n, "href")
+		if href != "" && !strings.Contains(w.b.String()[start:], href) {
+			w.text(" (" + href + ")")
+		}
+	}
+	w.lineBreak(breaks)
+}
+
+// text writes s with runs of whitespace collapsed to one space
+func (w *textWriter) text(s string) {
+	if s == "" {
+		return
+	}
+	words := strings.Fields(s)
+	if isSpace(s[0]) {
+		w.space = true
+	}
+	for i, word := range words {
+		if w.newlines == 0 && w.b.Len() > 0 && (w.space || i > 0) {
+			w.b.WriteByte(' ')
+		}
+		w.b.WriteString(word)
+		w.newlines = 0
+		w.space = false
+	}
+	if isSpace(s[len(s)-1]) {
+		w.space = true
+	}
+}
+
+// lineBreak ends the current line so that at least n line breaks separate it from what follows
+func (w *textWriter) lineBreak(n int) {
+	if n == 0 || w.b.Len() == 0 {
+		return
+	}
+	for w.newlines < n {
+		w.b.WriteByte('\n')
+		w.newlines++
+	}
+	w.space = false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
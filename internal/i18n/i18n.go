@@ -0,0 +1,147 @@
+// Package i18n holds the message catalogs used for API responses and emails. Each
+// supported locale has an embedded JSON catalog mapping stable message keys to text;
+// messages may contain fmt verbs filled from the arguments passed to T.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Default is the locale used when nothing else matches. Its catalog is complete; other
+// catalogs fall back to it for missing keys.
+const Default = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+// catalogs maps a locale to its messages
+var catalogs = mustLoad()
+
+// supported lists the locales with a catalog, Default first
+var supported = supportedLocales()
+
+// matcher picks the best supported locale for a list of requested ones
+var matcher = language.NewMatcher(tags(supported))
+
+func mustLoad() map[string]map[string]string {
+	names, err := fs.Glob(files, "locales/*.json")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]map[string]string)
+	for _, file := range names {
+		b, err := files.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(b, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: parse %s: %v", file, err))
+		}
+		loaded[strings.TrimSuffix(path.Base(file), ".json")] = messages
+	}
+	if _, ok := loaded[Default]; !ok {
+		panic("i18n: missing catalog for " + Default)
+	}
+	return loaded
+}
+
+func supportedLocales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		if l != Default {
+			locales = append(locales, l)
+		}
+	}
+	sort.Strings(locales)
+	return append([]string{Default}, locales...)
+}
+
+func tags(locales []string) []language.Tag {
+	t := make([]language.Tag, len(locales))
+	for i, l := range locales {
+		t[i] = language.Make(l)
+	}
+	return t
+}
+
+// Supported returns the locales with a catalog, Default first
+func Supported() []string {
+	return append([]string(nil), supported...)
+}
+
+// IsSupported reports whether locale has a catalog
+func IsSupported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// normalize maps a locale tag such as "de-AT" to a supported locale, or "" if none fits
+func normalize(locale string) string {
+	if IsSupported(locale) {
+		return locale
+	}
+	base, _, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	base = strings.ToLower(base)
+	if IsSupported(base) {
+		return base
+	}
+	return ""
+}
+
+// Match returns the supported locale that best fits an Accept-Language header, or "" when
+// the header is empty, malformed or names no supported language
+func Match(acceptLanguage string) string {
+	requested, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(requested) == 0 {
+		return ""
+	}
+	_, i, confidence := matcher.Match(requested...)
+	if confidence == language.No {
+		return ""
+	}
+	return supported[i]
+}
+
+// Resolve returns the first candidate that maps to a supported locale, or Default.
+// Candidates are tried in order of preference; empty ones are skipped.
+func Resolve(candidates ...string) string {
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		if l := normalize(c); l != "" {
+			return l
+		}
+	}
+	return Default
+}
+
+// Message returns the unformatted message for key in locale, falling back to the default
+// catalog and then to the key itself
+func Message(locale, key string) string {
+	if msg, ok := catalogs[locale][key]; ok {
+		return msg
+	}
+	if msg, ok := catalogs[Default][key]; ok {
+		return msg
+	}
+	return key
+}
+
+// T returns the message for key in locale formatted with args
+func T(locale, key string, args ...any) string {
+	msg := Message(locale, key)
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
@@ -0,0 +1,93 @@
+package i18n
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"de", "de"},
+		{"de-AT,de;q=0.9,en;q=0.8", "de"},
+		{"fr-FR,es;q=0.7", "es"},
+		{"en-GB", "en"},
+		{"ja", ""},
+		{"not a header;;", ""},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.header); got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		candidates []string
+		want       string
+	}{
+		{nil, Default},
+		{[]string{"", "es"}, "es"},
+		{[]string{"de-CH", "es"}, "de"},
+		{[]string{"pt-BR", "", "es"}, "es"},
+		{[]string{"pt-BR"}, Default},
+	}
+	for _, tt := range tests {
+		if got := Resolve(tt.candidates...); got != tt.want {
+			t.Errorf("Resolve(%q) = %q, want %q", tt.candidates, got, tt.want)
+		}
+	}
+}
+
+func TestTFallsBack(t *testing.T) {
+	if got := T("de", "user_not_found"); got != "Benutzer nicht gefunden" {
+		t.Errorf("T(de) = %q", got)
+	}
+	if got := T("xx", "user_not_found"); got != "user not found" {
+		t.Errorf("T(xx) = %q, want the default message", got)
+	}
+	if got := T("de", "no.such.key"); got != "no.such.key" {
+		t.Errorf("T(unknown key) = %q, want the key", got)
+	}
+	if got := T("es", "name_too_long", 255); got != "el nombre debe tener como máximo 255 caracteres" {
+		t.Errorf("T(args) = %q", got)
+	}
+}
+
+var verbPattern = regexp.MustCompile(`%[a-z]`)
+
+// Every catalog must translate every default message with the same format verbs
+func TestCatalogsComplete(t *testing.T) {
+	for _, locale := range Supported() {
+		for key, msg := range catalogs[Default] {
+			translated, ok := catalogs[locale][key]
+			if !ok {
+				t.Errorf("%s: missing %q", locale, key)
+				continue
+			}
+			want, got := verbPattern.FindAllString(msg, -1), verbPattern.FindAllString(translated, -1)
+			sort.Strings(want)
+			sort.Strings(got)
+			if len(want) != len(got) {
+				t.Errorf("%s: %q has verbs %v, want %v", locale, key, got, want)
+				continue
+			}
+			for i := range want {
+				if want[i] != got[i] {
+					t.Errorf("%s: %q has verbs %v, want %v", locale, key, got, want)
+					break
+				}
+			}
+		}
+		for key := range catalogs[locale] {
+			if _, ok := catalogs[Default][key]; !ok {
+				t.Errorf("%s: %q is not in the default catalog", locale, key)
+			}
+		}
+	}
+}
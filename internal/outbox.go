@@ -0,0 +1,317 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"project/internal/db/sqlc"
+)
+
+// Outbox email statuses
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSending = "sending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusDead    = "dead"
+)
+
+const (
+	outboxBatchSize   = 20
+	outboxLease       = 2 * time.Minute
+	outboxSendTimeout = 30 * time.Second
+	outboxMaxAttempts = 8
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = 2 * time.Hour
+	outboxRetention   = 7 * 24 * time.Hour // sent emails are deleted after this
+)
+
+// OutboxEmail is an email waiting in the outbox
+type OutboxEmail struct {
+	CompanyID int32 // 0 when the email belongs to no company
+	// IdempotencyKey makes enqueueing the same email twice a no-op; empty disables the check
+	IdempotencyKey string
+	// CompanyLimit is the company's send budget per EmailBudgetWindow; 0 sets none
+	CompanyLimit int
+	// Essential emails such as security notices skip the send budgets
+	Essential bool
+	// RecipientBudgetOnly emails spend only the recipient budget and do not count toward the
+	// company and global ones; for emails an unauthenticated request can trigger, such as
+	// login OTPs, so that flooding such an endpoint cannot exhaust a company's budget
+	RecipientBudgetOnly bool
+	Message             EmailMessage
+}
+
+// outboxAttachment is an attachment as EnqueueEmail passes it to the database; the content
+// marshals as base64
+type outboxAttachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+}
+
+// jsonList marshals a list so that an empty one is stored as [] rather than null
+func jsonList[T any](list []T) json.RawMessage {
+	if len(list) == 0 {
+		return json.RawMessage("[]")
+	}
+	b, _ := json.Marshal(list)
+	return b
+}
+
+// EnqueueEmail adds an email to the outbox. Pass a transaction's queries to enqueue the
+// email atomically with the change it reports. It returns false when an email with the
+// same idempotency key is already queued, and an *EmailBudgetError when a send budget is
+// used up.
+func (a *App) EnqueueEmail(ctx context.Context, q *sqlc.Queries, e OutboxEmail) (bool, error) {
+	if err := e.Message.Validate(); err != nil {
+		return false, err
+	}
+	if err := a.checkEmailBudget(ctx, q, e); err != nil {
+		return false, err
+	}
+	headers := json.RawMessage("{}")
+	if len(e.Message.Headers) > 0 {
+		headers, _ = json.Marshal(e.Message.Headers)
+	}
+	attachments := make([]outboxAttachment, len(e.Message.Attachments))
+	for i, a := range e.Message.Attachments {
+		attachments[i] = outboxAttachment{Name: a.Name, ContentType: a.contentType(), Content: a.Data}
+	}
+
+	_, err := q.EnqueueEmail(ctx, &sqlc.EnqueueEmailParams{
+		CompanyID:           sql.NullInt32{Int32: e.CompanyID, Valid: e.CompanyID != 0},
+		IdempotencyKey:      sql.NullString{String: e.IdempotencyKey, Valid: e.IdempotencyKey != ""},
+		ToAddress:           e.Message.To,
+		ToName:              e.Message.ToName,
+		ExtraTo:             jsonList(e.Message.ExtraTo),
+		Cc:                  jsonList(e.Message.Cc),
+		Bcc:                 jsonList(e.Message.Bcc),
+		FromAddress:         e.Message.From,
+		FromName:            e.Message.FromName,
+		ReplyTo:             e.Message.ReplyTo,
+		Headers:             headers,
+		Subject:             e.Message.Subject,
+		HtmlBody:            e.Message.HTMLBody,
+		TextBody:            e.Message.TextBody,
+		Attachments:         jsonList(attachments),
+		Recipients:          jsonList(budgetRecipients(e.Message.recipients())),
+		RecipientBudgetOnly: e.RecipientBudgetOnly,
+	})
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	emailMetrics.Add("enqueued", 1)
+	return true, nil
+}
+
+// outboxMessage rebuilds the message of a claimed outbox email
+func (a *App) outboxMessage(ctx context.Context, e sqlc.EmailOutbox) (EmailMessage, error) {
+	msg := EmailMessage{
+		To:        e.ToAddress,
+		ToName:    e.ToName,
+		From:      e.FromAddress,
+		FromName:  e.FromName,
+		ReplyTo:   e.ReplyTo,
+		Subject:   e.Subject,
+		HTMLBody:  e.HtmlBody,
+		TextBody:  e.TextBody,
+		Reference: outboxReference(e.ID),
+	}
+	for _, field := range []struct {
+		raw json.RawMessage
+		dst any
+	}{
+		{e.ExtraTo, &msg.ExtraTo},
+		{e.Cc, &msg.Cc},
+		{e.Bcc, &msg.Bcc},
+		{e.Headers, &msg.Headers},
+	} {
+		if len(field.raw) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(field.raw, field.dst); err != nil {
+			return EmailMessage{}, fmt.Errorf("invalid stored email: %w", err)
+		}
+	}
+	if e.AttachmentCount == 0 {
+		return msg, nil
+	}
+
+	rows, err := a.Queries.ListOutboxAttachments(ctx, e.ID)
+	if err != nil {
+		return EmailMessage{}, fmt.Errorf("failed to load attachments: %w", err)
+	}
+	for _, r := range rows {
+		msg.Attachments = append(msg.Attachments, Attachment{Name: r.Name, ContentType: r.ContentType, Data: r.Content})
+	}
+	return msg, nil
+}
+
+// dropSuppressed removes the recipients suppressed reports a reason for from every list of
+// msg and returns them as "address (reason)". A suppressed primary recipient is replaced by
+// the next To or Cc recipient. Blind copies are never promoted, as the other recipients
+// would see their address, so it reports false when no To or Cc recipient is left.
+func dropSuppressed(msg *EmailMessage, suppressed func(address string) string) ([]string, bool) {
+	var dropped []string
+	keep := func(list []EmailAddress) []EmailAddress {
+		var kept []EmailAddress
+		for _, r := range list {
+			if reason := suppressed(r.Address); reason != "" {
+				dropped = append(dropped, fmt.Sprintf("%s (%s)", r.Address, reason))
+				continue
+			}
+			kept = append(kept, r)
+		}
+		return kept
+	}
+
+	to := keep([]EmailAddress{{Address: msg.To, Name: msg.ToName}})
+	msg.ExtraTo, msg.Cc, msg.Bcc = keep(msg.ExtraTo), keep(msg.Cc), keep(msg.Bcc)
+	if len(to) == 0 {
+		for _, list := range []*[]EmailAddress{&msg.ExtraTo, &msg.Cc} {
+			if len(*list) > 0 {
+				to, *list = (*list)[:1], (*list)[1:]
+				break
+			}
+		}
+	}
+	if len(to) == 0 {
+		return dropped, false
+	}
+	msg.To, msg.ToName = to[0].Address, to[0].Name
+	return dropped, true
+}
+
+// NotifyOutbox wakes the outbox worker so a newly committed email goes out without waiting
+// for the next poll
+func (a *App) NotifyOutbox() {
+	select {
+	case a.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// outboxBackoff returns the delay before retrying an email that failed attempt times
+func outboxBackoff(attempt int32) time.Duration {
+	d := outboxBaseBackoff
+	for i := int32(1); i < attempt && d < outboxMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, outboxMaxBackoff)
+}
+
+// DeliverOutbox claims one batch of due emails and sends them, returning how many were sent
+func (a *App) DeliverOutbox(ctx context.Context) (int, error) {
+	emails, err := a.Queries.ClaimOutboxEmails(ctx, &sqlc.ClaimOutboxEmailsParams{
+		LeaseSeconds: int32(outboxLease / time.Second),
+		BatchSize:    outboxBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, e := range emails {
+		if a.deliverOutboxEmail(ctx, e) {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// deliverOutboxEmail sends one claimed email, rescheduling it with backoff on failure and
+// dead-lettering it once it runs out of attempts
+func (a *App) deliverOutboxEmail(ctx context.Context, e sqlc.EmailOutbox) bool {
+	msg, err := a.outboxMessage(ctx, e)
+	if err == nil {
+		// Sending to an address that bounced or complained hurts the sender reputation. A
+		// failed lookup does not hold the email back.
+		dropped, ok := dropSuppressed(&msg, func(address string) string {
+			reason, _ := EmailSuppression(ctx, a.Queries, address)
+			return reason
+		})
+		if !ok {
+			if err := a.Queries.MarkOutboxEmailFailed(ctx, &sqlc.MarkOutboxEmailFailedParams{
+				ID:            e.ID,
+				Status:        OutboxStatusDead,
+				LastError:     sql.NullString{String: "no To or Cc recipient left, suppressed: " + strings.Join(dropped, ", "), Valid: true},
+				NextAttemptAt: time.Now(),
+			}); err != nil {
+				log.Printf("email outbox: mark %d suppressed: %v", e.ID, err)
+			}
+			return false
+		}
+		if len(dropped) > 0 {
+			log.Printf("email outbox: %d skips %d suppressed recipients", e.ID, len(dropped))
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, outboxSendTimeout)
+		err = a.Mailer.Send(sendCtx, msg)
+		cancel()
+	}
+
+	if err == nil {
+		if err := a.Queries.MarkOutboxEmailSent(ctx, e.ID); err != nil {
+			log.Printf("email outbox: mark %d sent: %v", e.ID, err)
+		}
+		return true
+	}
+
+	params := &sqlc.MarkOutboxEmailFailedParams{
+		ID:            e.ID,
+		Status:        OutboxStatusPending,
+		LastError:     sql.NullString{String: err.Error(), Valid: true},
+		NextAttemptAt: time.Now().Add(outboxBackoff(e.Attempts)),
+	}
+	if e.Attempts >= outboxMaxAttempts {
+		params.Status = OutboxStatusDead
+		log.Printf("email outbox: giving up on %d after %d attempts: %v", e.ID, e.Attempts, err)
+	}
+	if err := a.Queries.MarkOutboxEmailFailed(ctx, params); err != nil {
+		log.Printf("email outbox: mark %d failed: %v", e.ID, err)
+	}
+	return false
+}
+
+// RunEmailOutbox delivers queued email every interval, or sooner when notified, until ctx
+// is cancelled. Sent emails past the retention period are deleted hourly.
+func (a *App) RunEmailOutbox(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleanup.C:
+			cutoff := sql.NullTime{Time: time.Now().Add(-outboxRetention), Valid: true}
+			if _, err := a.Queries.DeleteSentOutboxEmails(ctx, cutoff); err != nil {
+				log.Printf("email outbox: cleanup: %v", err)
+			}
+			continue
+		case <-ticker.C:
+		case <-a.outboxWake:
+		}
+
+		// Keep going while full batches come back so a backlog drains quickly
+		for {
+			n, err := a.DeliverOutbox(ctx)
+			if err != nil {
+				log.Printf("email outbox: %v", err)
+				break
+			}
+			if n < outboxBatchSize {
+				break
+			}
+		}
+	}
+}
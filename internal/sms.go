@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMS transports selectable with SMS_TRANSPORT
+const (
+	SMSTransportTwilio = "twilio"
+	SMSTransportMemory = "memory"
+	SMSTransportLog    = "log"
+)
+
+// Channels a text message can be delivered over
+const (
+	SMSChannelSMS      = "sms"
+	SMSChannelWhatsApp = "whatsapp"
+)
+
+// phonePattern matches phone numbers in E.164 format
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// ValidPhone reports whether phone is an E.164 phone number such as +4915112345678
+func ValidPhone(phone string) bool {
+	return phonePattern.MatchString(phone)
+}
+
+// SMSMessage is a single outgoing text message
+type SMSMessage struct {
+	To      string // E.164 phone number
+	Channel string // SMSChannelSMS or SMSChannelWhatsApp
+	Body    string
+}
+
+// SMSSender delivers text messages through one transport
+type SMSSender interface {
+	Send(ctx context.Context, msg SMSMessage) error
+}
+
+// NewSMSSender creates the sender for the configured SMS transport. Without SMS_TRANSPORT,
+// Twilio is used when an account is set and messages are logged otherwise.
+func NewSMSSender(cfg Config) SMSSender {
+	switch cfg.smsTransport() {
+	case SMSTransportTwilio:
+		return NewTwilioSender(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.SMSFromNumber, cfg.WhatsAppFrom)
+	case SMSTransportMemory:
+		return &MemorySMSSender{}
+	default:
+		return LogSMSSender{}
+	}
+}
+
+// twilioEndpoint is the Twilio Messages API; %s is the account SID
+const twilioEndpoint = "https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json"
+
+// TwilioSender sends SMS and WhatsApp messages using the Twilio Messages API
+type TwilioSender struct {
+	accountSID   string
+	authToken    string
+	fromNumber   string
+	whatsAppFrom string
+	endpoint     string
+	client       *http.Client
+}
+
+// NewTwilioSender creates a Twilio sender. WhatsApp messages need whatsAppFrom, a number
+// enabled for WhatsApp in the Twilio account.
+func NewTwilioSender(accountSID, authToken, fromNumber, whatsAppFrom string) *TwilioSender {
+	return &TwilioSender{
+		accountSID:   accountSID,
+		authToken:    authToken,
+		fromNumber:   fromNumber,
+		whatsAppFrom: whatsAppFrom,
+		endpoint:     fmt.Sprintf(twilioEndpoint, url.PathEscape(accountSID)),
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// twilioError is the error body of the Twilio API
+type twilioError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Send sends the message using the Twilio API
+func (t *TwilioSender) Send(ctx context.Context, msg SMSMessage) error {
+	from, to := t.fromNumber, msg.To
+	if msg.Channel == SMSChannelWhatsApp {
+		if t.whatsAppFrom == "" {
+			return fmt.Errorf("whatsapp is not configured")
+		}
+		// Twilio selects the WhatsApp channel by address prefix
+		from, to = "whatsapp:"+t.whatsAppFrom, "whatsapp:"+msg.To
+	}
+	form := url.Values{"From": {from}, "To": {to}, "Body": {msg.Body}}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.accountSID, t.authToken)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send sms request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var apiErr twilioError
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err == nil && apiErr.Message != "" {
+			return fmt.Errorf("sms API error (status %d, code %d): %s", resp.StatusCode, apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("sms API error with status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// MemorySMSSender records messages in memory so tests can inspect them
+type MemorySMSSender struct {
+	mu   sync.Mutex
+	sent []SMSMessage
+}
+
+// Send records the message
+func (m *MemorySMSSender) Send(ctx context.Context, msg SMSMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first
+func (m *MemorySMSSender) Messages() []SMSMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]SMSMessage(nil), m.sent...)
+}
+
+// LogSMSSender writes messages to the log instead of sending them
+type LogSMSSender struct{}
+
+// Send logs the message
+func (LogSMSSender) Send(ctx context.Context, msg SMSMessage) error {
+	log.Printf("%s WOULD BE SENT TO: %s", strings.ToUpper(msg.Channel), msg.To)
+	log.Printf("BODY: %s", msg.Body)
+	return nil
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidPhone(t *testing.T) {
+	for _, phone := range []string{"+4915112345678", "+14155550123", "+1234567"} {
+		if !ValidPhone(phone) {
+			t.Errorf("ValidPhone(%q) = false, want true", phone)
+		}
+	}
+	for _, phone := range []string{"", "015112345678", "+0151123456", "+49 151 12345678", "+123456", "+1234567890123456"} {
+		if ValidPhone(phone) {
+			t.Errorf("ValidPhone(%q) = true, want false", phone)
+		}
+	}
+}
+
+func TestTwilioSenderSend(t *testing.T) {
+	var form url.Values
+	var path, user, pass string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		user, pass, _ = r.BasicAuth()
+		r.ParseForm()
+		form = r.PostForm
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid":"SM123","status":"queued"}`))
+	}))
+	defer srv.Close()
+
+	s := NewTwilioSender("AC123", "token", "+15005550006", "+14155238886")
+	if !strings.HasSuffix(s.endpoint, "/Accounts/AC123/Messages.json") {
+		t.Errorf("endpoint = %q", s.endpoint)
+	}
+	s.endpoint = srv.URL + "/Messages.json"
+
+	err := s.Send(context.Background(), SMSMessage{To: "+4915112345678", Channel: SMSChannelSMS, Body: "123456"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if path != "/Messages.json" || user != "AC123" || pass != "token" {
+		t.Errorf("unexpected request to %q as %q:%q", path, user, pass)
+	}
+	if form.Get("From") != "+15005550006" || form.Get("To") != "+4915112345678" || form.Get("Body") != "123456" {
+		t.Errorf("unexpected form %v", form)
+	}
+
+	err = s.Send(context.Background(), SMSMessage{To: "+4915112345678", Channel: SMSChannelWhatsApp, Body: "123456"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if form.Get("From") != "whatsapp:+14155238886" || form.Get("To") != "whatsapp:+4915112345678" {
+		t.Errorf("unexpected WhatsApp form %v", form)
+	}
+}
+
+func TestTwilioSenderErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":21211,"message":"The 'To' number is not a valid phone number.","status":400}`))
+	}))
+	defer srv.Close()
+
+	s := NewTwilioSender("AC123", "token", "+15005550006", "")
+	s.endpoint = srv.URL
+	err := s.Send(context.Background(), SMSMessage{To: "+4915112345678", Channel: SMSChannelSMS, Body: "123456"})
+	if err == nil || !strings.Contains(err.Error(), "21211") {
+		t.Errorf("expected the API error, got %v", err)
+	}
+
+	err = s.Send(context.Background(), SMSMessage{To: "+4915112345678", Channel: SMSChannelWhatsApp, Body: "123456"})
+	if err == nil || !strings.Contains(err.Error(), "whatsapp") {
+		t.Errorf("expected WhatsApp to be unavailable, got %v", err)
+	}
+}
+
+func TestNewSMSSender(t *testing.T) {
+	if _, ok := NewSMSSender(Config{}).(LogSMSSender); !ok {
+		t.Error("expected the log transport by default")
+	}
+	if _, ok := NewSMSSender(Config{TwilioAccountSID: "AC123"}).(*TwilioSender); !ok {
+		t.Error("expected the Twilio transport when an account is set")
+	}
+	m, ok := NewSMSSender(Config{SMSTransport: SMSTransportMemory}).(*MemorySMSSender)
+	if !ok {
+		t.Fatal("expected the memory transport")
+	}
+	m.Send(context.Background(), SMSMessage{To: "+4915112345678", Body: "hi"})
+	if msgs := m.Messages(); len(msgs) != 1 || msgs[0].Body != "hi" {
+		t.Errorf("Messages() = %+v", msgs)
+	}
+}
@@ -12,8 +12,10 @@ import (
 // CreateTestApp creates a test application instance with mock database
 func CreateTestApp() *core.App {
 	cfg := core.Config{
-		DatabaseDSN: "postgres://test",
-		JWTSecret:   "test-secret-key",
+		DatabaseDSN:    "postgres://test",
+		JWTSecret:      "test-secret-key",
+		EmailTransport: core.EmailTransportMemory,
+		SMSTransport:   core.SMSTransportMemory,
 	}
 
 	// Create a mock database connection (won't actually connect)
@@ -30,7 +32,8 @@ func CreateTestConfig() core.Config {
 	}
 }
 
-// CreateValidJWTToken creates a valid JWT token for testing
+// CreateValidJWTToken creates a valid JWT token for testing.
+// A companyID of 0 omits company_id, like the limited tokens issued to users without a company.
 func CreateValidJWTToken(secret string, userID, companyID int32, isAdmin bool, tokenType string) (string, error) {
 	var expiration time.Duration
 	if tokenType == "refresh" {
@@ -47,6 +50,9 @@ func CreateValidJWTToken(secret string, userID, companyID int32, isAdmin bool, t
 		"exp":        time.Now().Add(expiration).Unix(),
 		"iat":        time.Now().Unix(),
 	}
+	if companyID == 0 {
+		delete(claims, "company_id")
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(secret))
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"project/internal/db/sqlc"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// maxTxAttempts bounds how often WithTx runs a transaction that keeps deadlocking
+const maxTxAttempts = 3
+
+// ErrRollback can be returned from a WithTx callback to roll the transaction back
+// without WithTx reporting an error, e.g. for dry runs
+var ErrRollback = errors.New("transaction rolled back")
+
+// Tx is a database transaction with the queries bound to it
+type Tx struct {
+	*sqlc.Queries
+	tx *sql.Tx
+}
+
+// Savepoint runs fn inside a savepoint, so a failure only undoes fn's own writes and the
+// transaction stays usable. fn's error is returned unchanged.
+func (t *Tx) Savepoint(ctx context.Context, fn func() error) error {
+	if _, err := t.tx.ExecContext(ctx, "SAVEPOINT tx_step"); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := t.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT tx_step"); rbErr != nil {
+			return rbErr
+		}
+		return err
+	}
+	_, err := t.tx.ExecContext(ctx, "RELEASE SAVEPOINT tx_step")
+	return err
+}
+
+// WithTx runs fn in a transaction, committing if it returns nil and rolling back otherwise.
+// Transactions run at READ COMMITTED, where deadlocks are the only failure worth retrying;
+// they are retried, so fn must be safe to run more than once and must keep the database
+// error in the chain of any error it maps it to.
+func (a *App) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	for attempt := 1; ; attempt++ {
+		err := a.runTx(ctx, fn)
+		if errors.Is(err, ErrRollback) {
+			return nil
+		}
+		if err == nil || attempt == maxTxAttempts || !IsRetryableTxError(err) {
+			return err
+		}
+
+		// Back off a little so the conflicting transaction can finish
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt*attempt) * 20 * time.Millisecond):
+		}
+	}
+}
+
+// runTx runs fn once in a new transaction
+func (a *App) runTx(ctx context.Context, fn func(tx *Tx) error) error {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&Tx{Queries: a.Queries.WithTx(tx), tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsRetryableTxError reports whether err is a deadlock, after which running the whole
+// transaction again can succeed
+func IsRetryableTxError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "40P01"
+}
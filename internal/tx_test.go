@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"project/internal/db/sqlc"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsRetryableTxError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, true},
+		{"wrapped deadlock", fmt.Errorf("update user: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, false},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"plain error", errors.New("boom"), false},
+		{"rollback sentinel", ErrRollback, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryableTxError(tt.err); got != tt.want {
+				t.Errorf("IsRetryableTxError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// txCounter is a database/sql driver that only counts transactions
+type txCounter struct {
+	mu                         sync.Mutex
+	begins, commits, rollbacks int
+}
+
+func (d *txCounter) Open(string) (driver.Conn, error) { return txCounterConn{d}, nil }
+
+type txCounterConn struct{ d *txCounter }
+
+func (c txCounterConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("statements are not supported")
+}
+func (c txCounterConn) Close() error { return nil }
+func (c txCounterConn) Begin() (driver.Tx, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.begins++
+	return txCounterTx{c.d}, nil
+}
+
+type txCounterTx struct{ d *txCounter }
+
+func (t txCounterTx) Commit() error {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.commits++
+	return nil
+}
+func (t txCounterTx) Rollback() error {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.rollbacks++
+	return nil
+}
+
+func (d *txCounter) connector() driver.Connector { return txCounterConnector{d} }
+
+type txCounterConnector struct{ d *txCounter }
+
+func (c txCounterConnector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c txCounterConnector) Driver() driver.Driver                        { return c.d }
+
+func newTxCounterApp(t *testing.T) (*App, *txCounter) {
+	counter := &txCounter{}
+	db := sql.OpenDB(counter.connector())
+	t.Cleanup(func() { db.Close() })
+	return &App{DB: db, Queries: sqlc.New(db)}, counter
+}
+
+func TestWithTx(t *testing.T) {
+	errFailed := errors.New("failed to update user")
+	deadlock := &pgconn.PgError{Code: "40P01"}
+
+	tests := []struct {
+		name      string
+		errs      []error // returned by fn on each attempt, nil once exhausted
+		wantErr   error
+		calls     int
+		commits   int
+		rollbacks int
+	}{
+		{"commit", nil, nil, 1, 1, 0},
+		{"error rolls back", []error{errFailed}, errFailed, 1, 0, 1},
+		{"rollback sentinel", []error{ErrRollback}, nil, 1, 0, 1},
+		{"deadlock is retried", []error{fmt.Errorf("%w: %w", errFailed, deadlock)}, nil, 2, 1, 1},
+		{"retries are bounded", []error{deadlock, deadlock, deadlock, deadlock}, deadlock, maxTxAttempts, 0, maxTxAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, counter := newTxCounterApp(t)
+			calls := 0
+			err := app.WithTx(t.Context(), func(tx *Tx) error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("WithTx() = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.calls || counter.begins != tt.calls || counter.commits != tt.commits || counter.rollbacks != tt.rollbacks {
+				t.Errorf("calls %d, begins %d, commits %d, rollbacks %d; want %d calls, %d commits, %d rollbacks",
+					calls, counter.begins, counter.commits, counter.rollbacks, tt.calls, tt.commits, tt.rollbacks)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN sessions_revoked_at TIMESTAMP;
+
+CREATE TABLE email_change_reverts (
+    id          SERIAL PRIMARY KEY,
+    user_id     INTEGER NOT NULL CONSTRAINT email_change_reverts_user_id_users_id_fk
+                REFERENCES users ON DELETE CASCADE,
+    old_email   VARCHAR(255) NOT NULL,
+    new_email   VARCHAR(255) NOT NULL,
+    token_hash  VARCHAR(64) NOT NULL CONSTRAINT email_change_reverts_token_hash_unique UNIQUE,
+    expires_at  TIMESTAMP NOT NULL,
+    used_at     TIMESTAMP,
+    created_at  TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX email_change_reverts_user_id_idx ON email_change_reverts (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS email_change_reverts;
+ALTER TABLE users DROP COLUMN sessions_revoked_at;
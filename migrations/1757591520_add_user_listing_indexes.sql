@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE INDEX user_companies_company_id_idx ON user_companies (company_id);
+CREATE INDEX users_email_lower_prefix_idx ON users (lower(email) text_pattern_ops);
+CREATE INDEX users_name_lower_prefix_idx ON users (lower(name) text_pattern_ops);
+-- Keyset orders of ListUsersBy*; the expressions must match the queries exactly
+CREATE INDEX users_created_at_id_idx ON users ((COALESCE(created_at, '-infinity'::timestamp)), id);
+CREATE INDEX users_name_lower_id_idx ON users (lower(name), id);
+CREATE INDEX users_email_lower_id_idx ON users (lower(email), id);
+
+-- +goose Down
+DROP INDEX IF EXISTS users_email_lower_id_idx;
+DROP INDEX IF EXISTS users_name_lower_id_idx;
+DROP INDEX IF EXISTS users_created_at_id_idx;
+DROP INDEX IF EXISTS users_name_lower_prefix_idx;
+DROP INDEX IF EXISTS users_email_lower_prefix_idx;
+DROP INDEX IF EXISTS user_companies_company_id_idx;
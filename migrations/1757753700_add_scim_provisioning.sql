@@ -0,0 +1,26 @@
+-- +goose Up
+ALTER TABLE user_companies ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE user_companies ADD COLUMN external_id VARCHAR(255);
+
+CREATE UNIQUE INDEX user_companies_company_id_external_id_unique
+    ON user_companies (company_id, external_id)
+    WHERE external_id IS NOT NULL;
+
+CREATE TABLE scim_tokens (
+    id           SERIAL PRIMARY KEY,
+    company_id   INTEGER NOT NULL CONSTRAINT scim_tokens_company_id_companies_id_fk
+                 REFERENCES companies ON DELETE CASCADE,
+    description  VARCHAR(255) NOT NULL DEFAULT '',
+    token_hash   VARCHAR(64) NOT NULL CONSTRAINT scim_tokens_token_hash_unique UNIQUE,
+    created_at   TIMESTAMP DEFAULT NOW(),
+    last_used_at TIMESTAMP,
+    revoked_at   TIMESTAMP
+);
+
+CREATE INDEX scim_tokens_company_id_idx ON scim_tokens (company_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS scim_tokens;
+DROP INDEX IF EXISTS user_companies_company_id_external_id_unique;
+ALTER TABLE user_companies DROP COLUMN external_id;
+ALTER TABLE user_companies DROP COLUMN active;
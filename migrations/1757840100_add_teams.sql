@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE teams (
+    id          SERIAL PRIMARY KEY,
+    company_id  INTEGER NOT NULL CONSTRAINT teams_company_id_companies_id_fk
+                REFERENCES companies ON DELETE CASCADE,
+    name        VARCHAR(255) NOT NULL,
+    description VARCHAR(1000) NOT NULL DEFAULT '',
+    role        VARCHAR(20) NOT NULL DEFAULT 'member'
+                CONSTRAINT teams_role_check CHECK (role IN ('member', 'admin')),
+    created_at  TIMESTAMP DEFAULT NOW(),
+    updated_at  TIMESTAMP DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX teams_company_id_name_unique ON teams (company_id, lower(name));
+
+CREATE TABLE team_members (
+    team_id    INTEGER NOT NULL CONSTRAINT team_members_team_id_teams_id_fk
+               REFERENCES teams ON DELETE CASCADE,
+    user_id    INTEGER NOT NULL CONSTRAINT team_members_user_id_users_id_fk
+               REFERENCES users ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT team_members_team_id_user_id_pk PRIMARY KEY (team_id, user_id)
+);
+
+CREATE INDEX team_members_user_id_idx ON team_members (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS team_members;
+DROP TABLE IF EXISTS teams;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE companies ADD COLUMN parent_id INTEGER
+    CONSTRAINT companies_parent_id_companies_id_fk REFERENCES companies ON DELETE SET NULL;
+ALTER TABLE companies ADD COLUMN inherit_memberships BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE companies ADD CONSTRAINT companies_parent_id_not_self CHECK (parent_id <> id);
+
+CREATE INDEX companies_parent_id_idx ON companies (parent_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS companies_parent_id_idx;
+ALTER TABLE companies DROP CONSTRAINT IF EXISTS companies_parent_id_not_self;
+ALTER TABLE companies DROP COLUMN inherit_memberships;
+ALTER TABLE companies DROP COLUMN parent_id;
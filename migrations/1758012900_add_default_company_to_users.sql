@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN default_company_id INTEGER
+    CONSTRAINT users_default_company_id_companies_id_fk REFERENCES companies ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN default_company_id;
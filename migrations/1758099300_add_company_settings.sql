@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE company_settings (
+    company_id INTEGER NOT NULL CONSTRAINT company_settings_company_id_companies_id_fk
+               REFERENCES companies ON DELETE CASCADE,
+    key        VARCHAR(100) NOT NULL,
+    value      JSONB NOT NULL,
+    updated_by INTEGER CONSTRAINT company_settings_updated_by_users_id_fk
+               REFERENCES users ON DELETE SET NULL,
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (company_id, key)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS company_settings;
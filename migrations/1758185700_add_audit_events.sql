@@ -0,0 +1,38 @@
+-- +goose Up
+-- Audit events have no foreign keys so the log outlives the users and companies it mentions.
+CREATE TABLE audit_events (
+    id            SERIAL PRIMARY KEY,
+    company_id    INTEGER NOT NULL,
+    actor_user_id INTEGER,
+    actor_type    VARCHAR(20) NOT NULL CONSTRAINT audit_events_actor_type_check
+                  CHECK (actor_type IN ('user', 'scim', 'system')),
+    action        VARCHAR(100) NOT NULL,
+    target_type   VARCHAR(50),
+    target_id     INTEGER,
+    ip            VARCHAR(45),
+    user_agent    VARCHAR(500),
+    before        JSONB NOT NULL DEFAULT '{}',
+    after         JSONB NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX audit_events_company_id_id_idx ON audit_events (company_id, id DESC);
+CREATE INDEX audit_events_company_id_actor_user_id_idx ON audit_events (company_id, actor_user_id);
+CREATE INDEX audit_events_company_id_target_idx ON audit_events (company_id, target_type, target_id);
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only();
+DROP TABLE IF EXISTS audit_events;
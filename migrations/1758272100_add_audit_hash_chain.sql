@@ -0,0 +1,22 @@
+-- +goose Up
+-- Events written before chaining keep NULL hashes; each company's chain starts at its first
+-- hashed event, whose prev_hash is empty.
+ALTER TABLE audit_events ADD COLUMN prev_hash VARCHAR(64);
+ALTER TABLE audit_events ADD COLUMN hash VARCHAR(64);
+
+CREATE TABLE audit_checkpoints (
+    id            SERIAL PRIMARY KEY,
+    company_id    INTEGER NOT NULL,
+    last_event_id INTEGER NOT NULL,
+    last_hash     VARCHAR(64) NOT NULL,
+    event_count   INTEGER NOT NULL,
+    signature     TEXT NOT NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX audit_checkpoints_company_id_id_idx ON audit_checkpoints (company_id, id DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_checkpoints;
+ALTER TABLE audit_events DROP COLUMN hash;
+ALTER TABLE audit_events DROP COLUMN prev_hash;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- Outgoing email is written here, usually in the same transaction as the change it reports,
+-- and delivered by a background worker.
+CREATE TABLE email_outbox (
+    id              SERIAL PRIMARY KEY,
+    company_id      INTEGER REFERENCES companies(id) ON DELETE SET NULL,
+    idempotency_key VARCHAR(255) UNIQUE,
+    to_address      VARCHAR(255) NOT NULL,
+    to_name         VARCHAR(255) NOT NULL DEFAULT '',
+    subject         TEXT NOT NULL,
+    html_body       TEXT NOT NULL,
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending' CONSTRAINT email_outbox_status_check
+                    CHECK (status IN ('pending', 'sending', 'sent', 'dead')),
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    locked_until    TIMESTAMP,
+    sent_at         TIMESTAMP,
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX email_outbox_due_idx ON email_outbox (next_attempt_at) WHERE status IN ('pending', 'sending');
+CREATE INDEX email_outbox_company_id_id_idx ON email_outbox (company_id, id DESC);
+CREATE INDEX email_outbox_sent_at_idx ON email_outbox (sent_at) WHERE status = 'sent';
+
+-- +goose Down
+DROP TABLE IF EXISTS email_outbox;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE email_outbox ADD COLUMN text_body TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS text_body;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- A NULL locale means the user has no preference, so the request and company decide.
+-- The old default cannot be told apart from an explicit choice and is dropped.
+ALTER TABLE users ALTER COLUMN locale DROP NOT NULL;
+ALTER TABLE users ALTER COLUMN locale DROP DEFAULT;
+UPDATE users SET locale = NULL WHERE locale = 'en';
+
+-- +goose Down
+UPDATE users SET locale = 'en' WHERE locale IS NULL;
+ALTER TABLE users ALTER COLUMN locale SET DEFAULT 'en';
+ALTER TABLE users ALTER COLUMN locale SET NOT NULL;
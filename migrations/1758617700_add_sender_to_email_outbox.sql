@@ -0,0 +1,10 @@
+-- +goose Up
+-- Empty values fall back to the configured sender
+ALTER TABLE email_outbox ADD COLUMN from_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE email_outbox ADD COLUMN from_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE email_outbox ADD COLUMN reply_to TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS reply_to;
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS from_name;
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS from_address;
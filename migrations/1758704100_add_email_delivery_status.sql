@@ -0,0 +1,22 @@
+-- +goose Up
+-- Delivery status reported by the email provider's webhooks after an email was handed over
+ALTER TABLE email_outbox ADD COLUMN delivery_status VARCHAR(20) CONSTRAINT email_outbox_delivery_status_check
+    CHECK (delivery_status IN ('delivered', 'soft_bounced', 'bounced', 'complained'));
+ALTER TABLE email_outbox ADD COLUMN delivery_detail TEXT;
+ALTER TABLE email_outbox ADD COLUMN delivery_updated_at TIMESTAMP;
+
+-- Addresses that hard-bounced or complained; nothing is sent to them until an admin lifts it.
+-- Addresses are stored lowercased.
+CREATE TABLE email_suppressions (
+    email      VARCHAR(255) PRIMARY KEY,
+    reason     VARCHAR(20) NOT NULL CONSTRAINT email_suppressions_reason_check
+               CHECK (reason IN ('bounced', 'complained')),
+    detail     TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS email_suppressions;
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS delivery_updated_at;
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS delivery_detail;
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS delivery_status;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- Further recipients as JSON arrays of {address, name}, extra headers as a JSON object
+ALTER TABLE email_outbox ADD COLUMN extra_to JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE email_outbox ADD COLUMN cc JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE email_outbox ADD COLUMN bcc JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE email_outbox ADD COLUMN headers JSONB NOT NULL DEFAULT '{}';
+-- Lets delivery skip the attachment lookup for the common email without any
+ALTER TABLE email_outbox ADD COLUMN attachment_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE email_outbox_attachments (
+    email_id     INTEGER NOT NULL REFERENCES email_outbox(id) ON DELETE CASCADE,
+    position     INTEGER NOT NULL,
+    name         VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    content      BYTEA NOT NULL,
+    PRIMARY KEY (email_id, position)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS email_outbox_attachments;
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS attachment_count;
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS headers;
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS bcc;
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS cc;
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS extra_to;
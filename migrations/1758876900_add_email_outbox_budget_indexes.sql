@@ -0,0 +1,8 @@
+-- +goose Up
+-- Send budgets count the emails queued in the last hour, overall and per recipient
+CREATE INDEX email_outbox_created_at_idx ON email_outbox (created_at);
+CREATE INDEX email_outbox_recipient_created_at_idx ON email_outbox (lower(to_address), created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS email_outbox_recipient_created_at_idx;
+DROP INDEX IF EXISTS email_outbox_created_at_idx;
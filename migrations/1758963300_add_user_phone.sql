@@ -0,0 +1,8 @@
+-- +goose Up
+-- Optional phone number in E.164 format for OTPs by SMS or WhatsApp; only stored once verified
+ALTER TABLE users ADD COLUMN phone VARCHAR(16) CONSTRAINT users_phone_check CHECK (phone ~ '^\+[1-9][0-9]{6,14}$');
+ALTER TABLE users ADD COLUMN phone_verified_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS phone_verified_at;
+ALTER TABLE users DROP COLUMN IF EXISTS phone;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- CSV imports are audited as their own actor, with the admin who started them as the user
+ALTER TABLE audit_events DROP CONSTRAINT audit_events_actor_type_check;
+ALTER TABLE audit_events ADD CONSTRAINT audit_events_actor_type_check
+    CHECK (actor_type IN ('user', 'scim', 'import', 'system'));
+
+-- +goose Down
+-- The log is append-only, so import events stay; the old check only applies to new rows
+ALTER TABLE audit_events DROP CONSTRAINT audit_events_actor_type_check;
+ALTER TABLE audit_events ADD CONSTRAINT audit_events_actor_type_check
+    CHECK (actor_type IN ('user', 'scim', 'system')) NOT VALID;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- Every recipient of a queued email, To, Cc and Bcc alike, lowercased, so the per-address
+-- send budget counts all of them rather than just the first To address
+CREATE TABLE email_outbox_recipients (
+    email_id   INTEGER NOT NULL REFERENCES email_outbox(id) ON DELETE CASCADE,
+    address    VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (email_id, address)
+);
+
+CREATE INDEX email_outbox_recipients_address_created_at_idx ON email_outbox_recipients (address, created_at);
+
+-- Emails still inside a budget window must count from the start
+INSERT INTO email_outbox_recipients (email_id, address, created_at)
+SELECT e.id, lower(trim(r.address)), e.created_at
+FROM email_outbox e,
+     LATERAL (
+         SELECT e.to_address AS address
+         UNION
+         SELECT a->>'address'
+         FROM jsonb_array_elements(e.extra_to || e.cc || e.bcc) AS a
+     ) r
+WHERE e.created_at > NOW() - INTERVAL '1 hour'
+ON CONFLICT DO NOTHING;
+
+DROP INDEX IF EXISTS email_outbox_recipient_created_at_idx;
+
+-- +goose Down
+CREATE INDEX email_outbox_recipient_created_at_idx ON email_outbox (lower(to_address), created_at);
+DROP TABLE IF EXISTS email_outbox_recipients;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Emails an unauthenticated request can trigger, such as login OTPs, spend only the
+-- per-address budget and stay out of the company and global counts
+ALTER TABLE email_outbox ADD COLUMN recipient_budget_only BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS recipient_budget_only;
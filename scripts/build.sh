@@ -55,6 +55,7 @@ if [ "$SKIP_SQLC" = false ]; then
         echo "Install SQLC: https://docs.sqlc.dev/en/stable/overview/install.html"
         exit 1
     fi
+    ./scripts/gen-list-users.sh
     sqlc generate
     echo "✅ SQLC code generated successfully"
 else
@@ -0,0 +1,76 @@
+#!/bin/bash
+
+# Script to generate the member listing queries in internal/db/queries/users_list.sql
+# Usage: ./scripts/gen-list-users.sh
+#
+# Member listings need one static query per sort and direction: a single query choosing
+# its ORDER BY with CASE cannot use the users indexes, so Postgres would sort the whole
+# company on every page. The variants share their select and filters, which are written
+# once below; only the sort key, the keyset comparison and the direction differ.
+
+set -e
+
+OUT="internal/db/queries/users_list.sql"
+
+# query NAME SORT_KEY CURSOR_VALUE DIRECTION
+query() {
+    local name="$1" key="$2" cursor="$3" dir="$4" op=">"
+    if [ "$dir" = "DESC" ]; then
+        op="<"
+    fi
+    cat << SQL
+-- name: ${name} :many
+SELECT u.id, u.email, u.name, u.version, u.created_at, u.deleted_at, u.last_login_at, uc.is_admin
+FROM users u
+JOIN user_companies uc ON u.id = uc.user_id
+WHERE uc.company_id = sqlc.arg('company_id')
+  AND (
+      sqlc.arg('status')::text = 'all'
+      OR (sqlc.arg('status')::text = 'active' AND u.deleted_at IS NULL AND uc.active)
+      OR (sqlc.arg('status')::text = 'deleted' AND (u.deleted_at IS NOT NULL OR NOT uc.active))
+  )
+  AND (sqlc.narg('is_admin')::boolean IS NULL OR COALESCE(uc.is_admin, FALSE) = sqlc.narg('is_admin')::boolean)
+  AND (
+      sqlc.narg('team_id')::integer IS NULL
+      OR EXISTS (
+          SELECT 1
+          FROM team_members tm
+          JOIN teams t ON t.id = tm.team_id
+          WHERE tm.team_id = sqlc.narg('team_id')::integer AND tm.user_id = u.id AND t.company_id = uc.company_id
+      )
+  )
+  AND (
+      sqlc.narg('search')::text IS NULL
+      OR lower(u.email) LIKE sqlc.narg('search')::text || '%'
+      OR lower(u.name) LIKE sqlc.narg('search')::text || '%'
+  )
+  AND (
+      sqlc.narg('cursor_id')::integer IS NULL
+      OR (${key}, u.id) ${op} (${cursor}, sqlc.narg('cursor_id')::integer)
+  )
+ORDER BY ${key} ${dir}, u.id ${dir}
+LIMIT sqlc.arg('page_limit')::integer;
+SQL
+}
+
+CREATED_AT="COALESCE(u.created_at, '-infinity'::timestamp)"
+CURSOR_TIME="COALESCE(sqlc.narg('cursor_time')::timestamp, '-infinity'::timestamp)"
+CURSOR_TEXT="lower(sqlc.narg('cursor_value')::text)"
+
+{
+    echo "-- Code generated by scripts/gen-list-users.sh. DO NOT EDIT."
+    echo
+    query ListUsersByCreatedAtAsc "$CREATED_AT" "$CURSOR_TIME" ASC
+    echo
+    query ListUsersByCreatedAtDesc "$CREATED_AT" "$CURSOR_TIME" DESC
+    echo
+    query ListUsersByNameAsc "lower(u.name)" "$CURSOR_TEXT" ASC
+    echo
+    query ListUsersByNameDesc "lower(u.name)" "$CURSOR_TEXT" DESC
+    echo
+    query ListUsersByEmailAsc "lower(u.email)" "$CURSOR_TEXT" ASC
+    echo
+    query ListUsersByEmailDesc "lower(u.email)" "$CURSOR_TEXT" DESC
+} > "$OUT"
+
+echo "✅ Generated $OUT"